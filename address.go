@@ -0,0 +1,163 @@
+package sagapay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// NativeContractAddress is the contract address used for a network's native coin
+const NativeContractAddress = "0"
+
+// ValidateAddress checks that addr is a well-formed address for the given network.
+// The check is offline and covers:
+//   - ERC20, BEP20 and POLYGON: 0x-prefixed hex addresses, with EIP-55
+//     checksum verification for mixed-case addresses
+//   - TRC20: Base58Check addresses starting with T
+//   - SOLANA: base58 encoded 32-byte public keys
+//
+// Errors match ErrInvalidAddress, or ErrUnsupportedNetwork for unknown networks.
+func ValidateAddress(network NetworkType, addr string) error {
+	switch network {
+	case NetworkTypeERC20, NetworkTypeBEP20, NetworkTypePOLYGON:
+		return validateEVMAddress(addr)
+	case NetworkTypeTRC20:
+		return validateTronAddress(addr)
+	case NetworkTypeSOLANA:
+		return validateSolanaAddress(addr)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedNetwork, network)
+	}
+}
+
+// ValidateContractAddress is like ValidateAddress but also accepts "0" for the native coin
+func ValidateContractAddress(network NetworkType, addr string) error {
+	if addr == NativeContractAddress {
+		return nil
+	}
+	return ValidateAddress(network, addr)
+}
+
+// NormalizeAddress returns the canonical form of an address or contract
+// address for comparison. EVM addresses are case-insensitive and are
+// lowercased; TRON and Solana base58 addresses are case-sensitive and are
+// returned unchanged.
+func NormalizeAddress(network NetworkType, addr string) string {
+	switch network {
+	case NetworkTypeERC20, NetworkTypeBEP20, NetworkTypePOLYGON:
+		return strings.ToLower(addr)
+	}
+	return addr
+}
+
+// ChecksumAddress returns the EIP-55 mixed-case checksum form of an EVM address
+func ChecksumAddress(addr string) (string, error) {
+	hexAddr, err := evmHex(addr)
+	if err != nil {
+		return "", err
+	}
+	return "0x" + eip55(strings.ToLower(hexAddr)), nil
+}
+
+// validateEVMAddress checks an EVM hex address and its EIP-55 checksum, if present
+func validateEVMAddress(addr string) error {
+	hexAddr, err := evmHex(addr)
+	if err != nil {
+		return err
+	}
+
+	// All-lowercase and all-uppercase addresses carry no checksum
+	lower, upper := strings.ToLower(hexAddr), strings.ToUpper(hexAddr)
+	if hexAddr == lower || hexAddr == upper {
+		return nil
+	}
+	if eip55(lower) != hexAddr {
+		return fmt.Errorf("%w: %q has an invalid EIP-55 checksum", ErrInvalidAddress, addr)
+	}
+	return nil
+}
+
+// evmHex returns the 40 hex digits of an EVM address without the 0x prefix
+func evmHex(addr string) (string, error) {
+	if len(addr) != 42 || !strings.HasPrefix(addr, "0x") && !strings.HasPrefix(addr, "0X") {
+		return "", fmt.Errorf("%w: %q is not a 0x-prefixed 20-byte hex address", ErrInvalidAddress, addr)
+	}
+	hexAddr := addr[2:]
+	if _, err := hex.DecodeString(hexAddr); err != nil {
+		return "", fmt.Errorf("%w: %q is not a 0x-prefixed 20-byte hex address", ErrInvalidAddress, addr)
+	}
+	return hexAddr, nil
+}
+
+// eip55 applies the EIP-55 checksum casing to a lowercase hex address
+func eip55(lower string) string {
+	hash := keccak256([]byte(lower))
+	out := []byte(lower)
+	for i, c := range out {
+		if c < 'a' {
+			continue
+		}
+		nibble := hash[i/2]
+		if i%2 == 0 {
+			nibble >>= 4
+		}
+		if nibble&0x0f >= 8 {
+			out[i] = c - 'a' + 'A'
+		}
+	}
+	return string(out)
+}
+
+// validateTronAddress checks a Base58Check TRON address
+func validateTronAddress(addr string) error {
+	if !strings.HasPrefix(addr, "T") {
+		return fmt.Errorf("%w: %q is not a TRON address starting with T", ErrInvalidAddress, addr)
+	}
+	decoded, err := base58Decode(addr)
+	if err != nil || len(decoded) != 25 || decoded[0] != 0x41 {
+		return fmt.Errorf("%w: %q is not a TRON address", ErrInvalidAddress, addr)
+	}
+
+	first := sha256.Sum256(decoded[:21])
+	second := sha256.Sum256(first[:])
+	if !bytes.Equal(second[:4], decoded[21:]) {
+		return fmt.Errorf("%w: %q has an invalid Base58Check checksum", ErrInvalidAddress, addr)
+	}
+	return nil
+}
+
+// validateSolanaAddress checks a base58 encoded 32-byte Solana public key
+func validateSolanaAddress(addr string) error {
+	decoded, err := base58Decode(addr)
+	if err != nil || len(decoded) != 32 {
+		return fmt.Errorf("%w: %q is not a base58 encoded 32-byte public key", ErrInvalidAddress, addr)
+	}
+	return nil
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58Decode decodes a Bitcoin-alphabet base58 string
+func base58Decode(s string) ([]byte, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty base58 string")
+	}
+
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, r := range s {
+		digit := strings.IndexRune(base58Alphabet, r)
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", r)
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+
+	// Each leading '1' encodes a leading zero byte
+	zeros := len(s) - len(strings.TrimLeft(s, "1"))
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
@@ -0,0 +1,78 @@
+package sagapay
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestKeccak256(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"},
+		{"abc", "4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45"},
+		{"The quick brown fox jumps over the lazy dog", "4d741b6f1eb29cb2a9b9911c82f56fa8d73b04959d3d9d222895df6c0b28aa15"},
+	}
+	for _, tt := range tests {
+		if got := hex.EncodeToString(keccak256([]byte(tt.input))); got != tt.want {
+			t.Errorf("keccak256(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+// The test vectors of EIP-55
+var eip55Vectors = []string{
+	"0x52908400098527886E0F7030069857D2E4169EE7",
+	"0x8617E340B3D01FA5F11F306F4090FD50E238070D",
+	"0xde709f2102306220921060314715629080e2fb77",
+	"0x27b1fdb04752bbc536007a920d24acb045561c26",
+	"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+	"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+	"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+	"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+}
+
+func TestChecksumAddress(t *testing.T) {
+	for _, want := range eip55Vectors {
+		// All-uppercase and all-lowercase vectors carry no checksum
+		hexAddr := want[2:]
+		if hexAddr == strings.ToUpper(hexAddr) || hexAddr == strings.ToLower(hexAddr) {
+			continue
+		}
+		got, err := ChecksumAddress(strings.ToLower(want))
+		if err != nil {
+			t.Fatalf("ChecksumAddress(%s): %v", want, err)
+		}
+		if got != want {
+			t.Errorf("ChecksumAddress(%s) = %s, want %s", strings.ToLower(want), got, want)
+		}
+	}
+}
+
+func TestValidateAddressEIP55(t *testing.T) {
+	for _, addr := range eip55Vectors {
+		if err := ValidateAddress(NetworkTypeERC20, addr); err != nil {
+			t.Errorf("ValidateAddress(%s): %v", addr, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		addr string
+	}{
+		{"flipped checksum case", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD"},
+		{"too short", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeA"},
+		{"missing prefix", "005aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"},
+		{"not hex", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateAddress(NetworkTypeERC20, tt.addr); !errors.Is(err, ErrInvalidAddress) {
+				t.Errorf("ValidateAddress(%s) = %v, want ErrInvalidAddress", tt.addr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package sagapay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ErrInvalidAmount is matched by every amount parsing or precision error
+var ErrInvalidAmount = errors.New("sagapay: invalid amount")
+
+// MaxDecimals is the largest number of token decimals an Amount accepts
+const MaxDecimals = 36
+
+// Amount is an exact, non-negative decimal amount of a token.
+//
+// Amounts never go through floating point. They are stored as an integer
+// number of units scaled by a power of ten, so "0.1" + "0.2" is exactly "0.3".
+// The zero value is 0. In JSON an Amount is encoded as a decimal string,
+// matching the form used by the SagaPay API.
+type Amount struct {
+	// unscaled is the amount multiplied by 10^scale; nil means zero
+	unscaled *big.Int
+
+	// scale is the number of fractional digits
+	scale int
+}
+
+// ParseAmount parses a decimal string such as "10", "1.5" or "0.000001".
+// Signs, exponents, NaN and infinities are rejected.
+func ParseAmount(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Amount{}, fmt.Errorf("%w: empty string", ErrInvalidAmount)
+	}
+
+	intPart, fracPart, hasDot := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" || hasDot && strings.Contains(fracPart, ".") {
+		return Amount{}, fmt.Errorf("%w: %q is not a decimal number", ErrInvalidAmount, s)
+	}
+	for _, r := range intPart + fracPart {
+		if r < '0' || r > '9' {
+			if r == '-' {
+				return Amount{}, fmt.Errorf("%w: %q is negative", ErrInvalidAmount, s)
+			}
+			return Amount{}, fmt.Errorf("%w: %q is not a decimal number", ErrInvalidAmount, s)
+		}
+	}
+
+	unscaled, ok := new(big.Int).SetString(intPart+fracPart, 10)
+	if !ok {
+		return Amount{}, fmt.Errorf("%w: %q is not a decimal number", ErrInvalidAmount, s)
+	}
+
+	return Amount{unscaled: unscaled, scale: len(fracPart)}.normalize(), nil
+}
+
+// ParseAmountDecimals parses a decimal string and rejects it if it has more
+// fractional digits than decimals allows
+func ParseAmountDecimals(s string, decimals int) (Amount, error) {
+	a, err := ParseAmount(s)
+	if err != nil {
+		return Amount{}, err
+	}
+	if err := a.checkPrecision(decimals); err != nil {
+		return Amount{}, err
+	}
+	return a, nil
+}
+
+// MustParseAmount is like ParseAmount but panics if s is not a valid amount
+func MustParseAmount(s string) Amount {
+	a, err := ParseAmount(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// NewAmountFromBaseUnits converts an integer number of base units (wei, sun,
+// lamports, ...) to an Amount using the token's decimals
+func NewAmountFromBaseUnits(units *big.Int, decimals int) (Amount, error) {
+	if units == nil {
+		return Amount{}, nil
+	}
+	if units.Sign() < 0 {
+		return Amount{}, fmt.Errorf("%w: %s base units is negative", ErrInvalidAmount, units)
+	}
+	if decimals < 0 || decimals > MaxDecimals {
+		return Amount{}, fmt.Errorf("%w: unsupported decimals %d", ErrInvalidAmount, decimals)
+	}
+	return Amount{unscaled: new(big.Int).Set(units), scale: decimals}.normalize(), nil
+}
+
+// ParseBaseUnits parses an integer string of base units and converts it to an
+// Amount using the token's decimals
+func ParseBaseUnits(s string, decimals int) (Amount, error) {
+	s = strings.TrimSpace(s)
+	units, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return Amount{}, fmt.Errorf("%w: %q is not an integer number of base units", ErrInvalidAmount, s)
+	}
+	return NewAmountFromBaseUnits(units, decimals)
+}
+
+// BaseUnits converts the amount to an integer number of base units using the
+// token's decimals. It fails if the amount has more precision than decimals allows.
+func (a Amount) BaseUnits(decimals int) (*big.Int, error) {
+	if err := a.checkPrecision(decimals); err != nil {
+		return nil, err
+	}
+	units := new(big.Int).Set(a.int())
+	return units.Mul(units, pow10(decimals-a.scale)), nil
+}
+
+// Add returns a + b
+func (a Amount) Add(b Amount) Amount {
+	x, y, scale := align(a, b)
+	return Amount{unscaled: x.Add(x, y), scale: scale}.normalize()
+}
+
+// Sub returns a - b, or an error if the result would be negative
+func (a Amount) Sub(b Amount) (Amount, error) {
+	x, y, scale := align(a, b)
+	if x.Cmp(y) < 0 {
+		return Amount{}, fmt.Errorf("%w: %s - %s is negative", ErrInvalidAmount, a, b)
+	}
+	return Amount{unscaled: x.Sub(x, y), scale: scale}.normalize(), nil
+}
+
+// Diff returns the absolute difference between a and b
+func (a Amount) Diff(b Amount) Amount {
+	x, y, scale := align(a, b)
+	return Amount{unscaled: x.Sub(x, y).Abs(x), scale: scale}.normalize()
+}
+
+// Cmp compares a and b and returns -1, 0 or +1
+func (a Amount) Cmp(b Amount) int {
+	x, y, _ := align(a, b)
+	return x.Cmp(y)
+}
+
+// Equal reports whether a and b represent the same value
+func (a Amount) Equal(b Amount) bool {
+	return a.Cmp(b) == 0
+}
+
+// IsZero reports whether the amount is zero
+func (a Amount) IsZero() bool {
+	return a.unscaled == nil || a.unscaled.Sign() == 0
+}
+
+// Decimals returns the number of significant fractional digits
+func (a Amount) Decimals() int {
+	return a.normalize().scale
+}
+
+// String returns the amount as a decimal string without trailing zeros
+func (a Amount) String() string {
+	a = a.normalize()
+	digits := a.int().String()
+	if a.scale == 0 {
+		return digits
+	}
+	if len(digits) <= a.scale {
+		digits = strings.Repeat("0", a.scale-len(digits)+1) + digits
+	}
+	point := len(digits) - a.scale
+	return digits[:point] + "." + digits[point:]
+}
+
+// StringFixed returns the amount padded with trailing zeros to at least places
+// fractional digits. Digits beyond places are never dropped.
+func (a Amount) StringFixed(places int) string {
+	s := a.String()
+	scale := a.Decimals()
+	if scale >= places {
+		return s
+	}
+	if scale == 0 {
+		s += "."
+	}
+	return s + strings.Repeat("0", places-scale)
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (a Amount) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (a *Amount) UnmarshalText(text []byte) error {
+	parsed, err := ParseAmount(string(text))
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// MarshalJSON encodes the amount as a JSON string
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON decodes the amount from a JSON string or number
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		data = []byte(s)
+	}
+	return a.UnmarshalText(data)
+}
+
+// checkPrecision fails if the amount has more fractional digits than decimals
+func (a Amount) checkPrecision(decimals int) error {
+	if decimals < 0 || decimals > MaxDecimals {
+		return fmt.Errorf("%w: unsupported decimals %d", ErrInvalidAmount, decimals)
+	}
+	if scale := a.Decimals(); scale > decimals {
+		return fmt.Errorf("%w: %s has %d decimal places, token allows %d", ErrInvalidAmount, a, scale, decimals)
+	}
+	return nil
+}
+
+// int returns the unscaled value, treating nil as zero
+func (a Amount) int() *big.Int {
+	if a.unscaled == nil {
+		return new(big.Int)
+	}
+	return a.unscaled
+}
+
+// normalize strips trailing fractional zeros
+func (a Amount) normalize() Amount {
+	if a.IsZero() {
+		return Amount{}
+	}
+	unscaled := new(big.Int).Set(a.unscaled)
+	scale := a.scale
+	ten := big.NewInt(10)
+	rem := new(big.Int)
+	for scale > 0 {
+		quo, r := new(big.Int).QuoRem(unscaled, ten, rem)
+		if r.Sign() != 0 {
+			break
+		}
+		unscaled = quo
+		scale--
+	}
+	return Amount{unscaled: unscaled, scale: scale}
+}
+
+// align returns copies of the unscaled values of a and b at a common scale
+func align(a, b Amount) (*big.Int, *big.Int, int) {
+	scale := max(a.scale, b.scale)
+	x := new(big.Int).Mul(a.int(), pow10(scale-a.scale))
+	y := new(big.Int).Mul(b.int(), pow10(scale-b.scale))
+	return x, y, scale
+}
+
+// pow10 returns 10^n
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// ParseAmount parses a display amount such as "1.5" and rejects it if it has
+// more precision than the token's decimals allow
+func (t Token) ParseAmount(s string) (Amount, error) {
+	return ParseAmountDecimals(s, t.Decimals)
+}
+
+// ParseBaseUnits converts an integer string of base units to an Amount using the token's decimals
+func (t Token) ParseBaseUnits(s string) (Amount, error) {
+	return ParseBaseUnits(s, t.Decimals)
+}
+
+// BaseUnits converts an amount to base units using the token's decimals
+func (t Token) BaseUnits(a Amount) (*big.Int, error) {
+	return a.BaseUnits(t.Decimals)
+}
+
+// AmountValue parses the transaction amount. If the token's decimals are
+// known the amount is also checked against them.
+func (t Transaction) AmountValue() (Amount, error) {
+	if t.Token.Decimals > 0 {
+		return t.Token.ParseAmount(t.Amount)
+	}
+	return ParseAmount(t.Amount)
+}
+
+// AmountValue parses the webhook amount
+func (p WebhookPayload) AmountValue() (Amount, error) {
+	return ParseAmount(p.Amount)
+}
+
+// AmountValue parses the expected deposit amount
+func (r DepositResponse) AmountValue() (Amount, error) {
+	return ParseAmount(r.Amount)
+}
+
+// RawAmount converts the raw balance, expressed in base units, using the given token decimals
+func (b Balance) RawAmount(decimals int) (Amount, error) {
+	return ParseBaseUnits(b.Raw, decimals)
+}
+
+// FormattedAmount parses the formatted balance
+func (b Balance) FormattedAmount() (Amount, error) {
+	return ParseAmount(b.Formatted)
+}
+
+// BalanceAmount returns the wallet balance in display units. The raw balance
+// is converted with the token's decimals; the formatted balance is used if
+// the raw balance is missing.
+func (r WalletBalanceResponse) BalanceAmount() (Amount, error) {
+	if r.Balance.Raw == "" {
+		return r.Balance.FormattedAmount()
+	}
+	return r.Balance.RawAmount(r.Token.Decimals)
+}
@@ -0,0 +1,114 @@
+package sagapay
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		input    string
+		want     string
+		decimals int
+	}{
+		{"0", "0", 0},
+		{"10", "10", 0},
+		{"1.5", "1.5", 1},
+		{"1.50000", "1.5", 1},
+		{"0.000001", "0.000001", 6},
+		{".5", "0.5", 1},
+		{"7.", "7", 0},
+		{"007.250", "7.25", 2},
+		{" 3 ", "3", 0},
+		{"123456789012345678901234567890.123456789012345678", "123456789012345678901234567890.123456789012345678", 18},
+	}
+	for _, tt := range tests {
+		a, err := ParseAmount(tt.input)
+		if err != nil {
+			t.Errorf("ParseAmount(%q): %v", tt.input, err)
+			continue
+		}
+		if got := a.String(); got != tt.want {
+			t.Errorf("ParseAmount(%q).String() = %q, want %q", tt.input, got, tt.want)
+		}
+		if got := a.Decimals(); got != tt.decimals {
+			t.Errorf("ParseAmount(%q).Decimals() = %d, want %d", tt.input, got, tt.decimals)
+		}
+	}
+}
+
+func TestParseAmountInvalid(t *testing.T) {
+	for _, input := range []string{"", " ", ".", "-1", "+1", "1e6", "1.2.3", "NaN", "Inf", "1,5", "0x10"} {
+		if _, err := ParseAmount(input); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("ParseAmount(%q) = %v, want ErrInvalidAmount", input, err)
+		}
+	}
+}
+
+func TestAmountStringFixed(t *testing.T) {
+	tests := []struct {
+		amount string
+		places int
+		want   string
+	}{
+		{"0", 2, "0.00"},
+		{"1", 2, "1.00"},
+		{"1.5", 2, "1.50"},
+		{"1.234", 2, "1.234"},
+		{"100", 0, "100"},
+	}
+	for _, tt := range tests {
+		if got := MustParseAmount(tt.amount).StringFixed(tt.places); got != tt.want {
+			t.Errorf("%s.StringFixed(%d) = %q, want %q", tt.amount, tt.places, got, tt.want)
+		}
+	}
+}
+
+func TestAmountBaseUnits(t *testing.T) {
+	tests := []struct {
+		amount   string
+		decimals int
+		units    string
+	}{
+		{"1", 18, "1000000000000000000"},
+		{"0.000001", 6, "1"},
+		{"25.5", 6, "25500000"},
+		{"0", 9, "0"},
+	}
+	for _, tt := range tests {
+		units, err := MustParseAmount(tt.amount).BaseUnits(tt.decimals)
+		if err != nil {
+			t.Fatalf("%s.BaseUnits(%d): %v", tt.amount, tt.decimals, err)
+		}
+		if units.String() != tt.units {
+			t.Errorf("%s.BaseUnits(%d) = %s, want %s", tt.amount, tt.decimals, units, tt.units)
+		}
+
+		n, _ := new(big.Int).SetString(tt.units, 10)
+		back, err := NewAmountFromBaseUnits(n, tt.decimals)
+		if err != nil {
+			t.Fatalf("NewAmountFromBaseUnits(%s, %d): %v", tt.units, tt.decimals, err)
+		}
+		if !back.Equal(MustParseAmount(tt.amount)) {
+			t.Errorf("NewAmountFromBaseUnits(%s, %d) = %s, want %s", tt.units, tt.decimals, back, tt.amount)
+		}
+	}
+
+	if _, err := MustParseAmount("0.0000001").BaseUnits(6); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("BaseUnits beyond the token's precision = %v, want ErrInvalidAmount", err)
+	}
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	sum := MustParseAmount("0.1").Add(MustParseAmount("0.2"))
+	if sum.String() != "0.3" {
+		t.Errorf("0.1 + 0.2 = %s, want 0.3", sum)
+	}
+	if _, err := MustParseAmount("1").Sub(MustParseAmount("2")); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("1 - 2 = %v, want ErrInvalidAmount", err)
+	}
+	if d := MustParseAmount("1").Diff(MustParseAmount("2.5")); d.String() != "1.5" {
+		t.Errorf("|1 - 2.5| = %s, want 1.5", d)
+	}
+}
@@ -0,0 +1,370 @@
+package sagapay
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// API is the set of SagaPay operations. *Client implements it; depend on API
+// instead of *Client to substitute a mock in tests (see sagapaytest.MockAPI)
+// or to wrap the client in the decorators below.
+type API interface {
+	CreateDeposit(ctx context.Context, params CreateDepositParams) (*DepositResponse, error)
+	CreateWithdrawal(ctx context.Context, params CreateWithdrawalParams) (*WithdrawalResponse, error)
+	CheckTransactionStatus(ctx context.Context, address string, transactionType TransactionType) (*TransactionStatusResponse, error)
+	FetchWalletBalance(ctx context.Context, address string, networkType NetworkType, contractAddress string) (*WalletBalanceResponse, error)
+}
+
+var _ API = (*Client)(nil)
+
+var (
+	// ErrReadOnly is returned by ReadOnly for calls that would create a deposit or withdrawal
+	ErrReadOnly = errors.New("sagapay: read-only client")
+
+	// ErrDryRun is returned by DryRun for withdrawals, after they pass validation
+	ErrDryRun = errors.New("sagapay: dry run, withdrawal not sent")
+)
+
+// ReadOnly wraps api so that only CheckTransactionStatus and
+// FetchWalletBalance reach it. CreateDeposit and CreateWithdrawal fail with
+// ErrReadOnly. Use it for dashboards and reporting jobs that hold real
+// credentials but must never move funds.
+func ReadOnly(api API) API {
+	return readOnlyAPI{api}
+}
+
+// readOnlyAPI refuses every call that writes
+type readOnlyAPI struct {
+	API
+}
+
+func (a readOnlyAPI) CreateDeposit(ctx context.Context, params CreateDepositParams) (*DepositResponse, error) {
+	return nil, fmt.Errorf("%w: %s refused", ErrReadOnly, EndpointCreateDeposit)
+}
+
+func (a readOnlyAPI) CreateWithdrawal(ctx context.Context, params CreateWithdrawalParams) (*WithdrawalResponse, error) {
+	return nil, fmt.Errorf("%w: %s refused", ErrReadOnly, EndpointCreateWithdrawal)
+}
+
+// DryRun wraps api so that withdrawals are validated but never sent: a valid
+// withdrawal fails with ErrDryRun and an invalid one with its *ValidationError.
+// Every other call passes through, so a dry run still creates deposits and
+// reads real balances.
+func DryRun(api API) API {
+	return dryRunAPI{api}
+}
+
+// dryRunAPI refuses withdrawals after validating them
+type dryRunAPI struct {
+	API
+}
+
+func (a dryRunAPI) CreateWithdrawal(ctx context.Context, params CreateWithdrawalParams) (*WithdrawalResponse, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%w: %s of token %s to %s on %s", ErrDryRun,
+		params.Amount, params.ContractAddress, MaskValue(params.Address), params.NetworkType)
+}
+
+// LoggingAPI wraps api and logs every call to logger once it returns, with
+// its duration and error. Addresses are masked with MaskValue. Unlike
+// Config.Logger, which logs each HTTP attempt of a *Client, it logs one
+// record per call and works with any API. A nil logger uses slog.Default().
+func LoggingAPI(api API, logger *slog.Logger) API {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return loggingAPI{api: api, logger: logger}
+}
+
+// loggingAPI logs the calls made through it
+type loggingAPI struct {
+	api    API
+	logger *slog.Logger
+}
+
+func (a loggingAPI) CreateDeposit(ctx context.Context, params CreateDepositParams) (*DepositResponse, error) {
+	start := time.Now()
+	resp, err := a.api.CreateDeposit(ctx, params)
+	attrs := []slog.Attr{slog.String("network", string(params.NetworkType))}
+	if resp != nil {
+		attrs = append(attrs, slog.String("id", resp.ID), slog.String("address", MaskValue(resp.Address)))
+	}
+	a.log(ctx, EndpointCreateDeposit, start, err, attrs...)
+	return resp, err
+}
+
+func (a loggingAPI) CreateWithdrawal(ctx context.Context, params CreateWithdrawalParams) (*WithdrawalResponse, error) {
+	start := time.Now()
+	resp, err := a.api.CreateWithdrawal(ctx, params)
+	attrs := []slog.Attr{
+		slog.String("network", string(params.NetworkType)),
+		slog.String("address", MaskValue(params.Address)),
+		slog.String("amount", params.Amount),
+	}
+	if resp != nil {
+		attrs = append(attrs, slog.String("id", resp.ID))
+	}
+	a.log(ctx, EndpointCreateWithdrawal, start, err, attrs...)
+	return resp, err
+}
+
+func (a loggingAPI) CheckTransactionStatus(ctx context.Context, address string, transactionType TransactionType) (*TransactionStatusResponse, error) {
+	start := time.Now()
+	resp, err := a.api.CheckTransactionStatus(ctx, address, transactionType)
+	attrs := []slog.Attr{slog.String("address", MaskValue(address))}
+	if resp != nil {
+		attrs = append(attrs, slog.Int("transactions", len(resp.Transactions)))
+	}
+	a.log(ctx, EndpointCheckTransactionStatus, start, err, attrs...)
+	return resp, err
+}
+
+func (a loggingAPI) FetchWalletBalance(ctx context.Context, address string, networkType NetworkType, contractAddress string) (*WalletBalanceResponse, error) {
+	start := time.Now()
+	resp, err := a.api.FetchWalletBalance(ctx, address, networkType, contractAddress)
+	attrs := []slog.Attr{
+		slog.String("network", string(networkType)),
+		slog.String("address", MaskValue(address)),
+	}
+	a.log(ctx, EndpointFetchWalletBalance, start, err, attrs...)
+	return resp, err
+}
+
+// log writes the record of a call: info on success, error on failure
+func (a loggingAPI) log(ctx context.Context, endpoint string, start time.Time, err error, attrs ...slog.Attr) {
+	level, msg := slog.LevelInfo, "sagapay call"
+	if err != nil {
+		level, msg = slog.LevelError, "sagapay call failed"
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	attrs = append([]slog.Attr{
+		slog.String("endpoint", endpoint),
+		slog.Duration("latency", time.Since(start)),
+	}, attrs...)
+	a.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// DefaultCacheTTL is the default time a CachingAPI keeps a response
+const DefaultCacheTTL = 30 * time.Second
+
+// CacheConfig configures a CachingAPI
+type CacheConfig struct {
+	// TTL is how long a response is reused. Defaults to DefaultCacheTTL.
+	TTL time.Duration
+
+	// MaxEntries bounds the number of cached responses; the least recently
+	// used are evicted first. Zero means no limit.
+	MaxEntries int
+}
+
+// CachingAPI wraps an API and caches the responses of CheckTransactionStatus
+// and FetchWalletBalance for a short time, so that pages and jobs polling the
+// same address share one request: concurrent calls for a response that is
+// not cached wait for a single request to the wrapped API. Errors are not
+// cached and deposits and withdrawals always pass through. Cached responses
+// are shared between callers and must not be modified. It is safe for
+// concurrent use.
+type CachingAPI struct {
+	API
+	config CacheConfig
+	now    func() time.Time
+
+	mu       sync.Mutex
+	order    *list.List
+	entries  map[any]*list.Element
+	inFlight map[any]*cacheCall
+}
+
+// cacheEntry is a cached response and when it expires
+type cacheEntry struct {
+	key     any
+	value   any
+	expires time.Time
+}
+
+// cacheCall is a request to the wrapped API that concurrent callers wait for
+type cacheCall struct {
+	done  chan struct{}
+	value any
+	err   error
+}
+
+// NewCachingAPI creates a caching wrapper around api
+func NewCachingAPI(api API, config CacheConfig) *CachingAPI {
+	if config.TTL <= 0 {
+		config.TTL = DefaultCacheTTL
+	}
+	return &CachingAPI{
+		API:      api,
+		config:   config,
+		now:      time.Now,
+		order:    list.New(),
+		entries:  make(map[any]*list.Element),
+		inFlight: make(map[any]*cacheCall),
+	}
+}
+
+// CheckTransactionStatus returns the cached transactions of the address, or
+// fetches them if they are not cached or have expired
+func (a *CachingAPI) CheckTransactionStatus(ctx context.Context, address string, transactionType TransactionType) (*TransactionStatusResponse, error) {
+	key := TransactionStatusParams{Address: address, TransactionType: transactionType}
+	v, err := a.load(ctx, key, func() (any, error) {
+		return a.API.CheckTransactionStatus(ctx, address, transactionType)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*TransactionStatusResponse), nil
+}
+
+// FetchWalletBalance returns the cached balance, or fetches it if it is not
+// cached or has expired
+func (a *CachingAPI) FetchWalletBalance(ctx context.Context, address string, networkType NetworkType, contractAddress string) (*WalletBalanceResponse, error) {
+	key := WalletBalanceParams{Address: address, NetworkType: networkType, ContractAddress: contractAddress}
+	v, err := a.load(ctx, key, func() (any, error) {
+		return a.API.FetchWalletBalance(ctx, address, networkType, contractAddress)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*WalletBalanceResponse), nil
+}
+
+// Invalidate drops the cached responses for an address, for example after a
+// webhook reports a new transaction to it. A request already in flight for
+// the address is not cached when it returns.
+func (a *CachingAPI) Invalidate(address string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, elem := range a.entries {
+		if cacheKeyAddress(key) == address {
+			a.order.Remove(elem)
+			delete(a.entries, key)
+		}
+	}
+	for key := range a.inFlight {
+		if cacheKeyAddress(key) == address {
+			delete(a.inFlight, key)
+		}
+	}
+}
+
+// Purge drops every cached response
+func (a *CachingAPI) Purge() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.order.Init()
+	clear(a.entries)
+	clear(a.inFlight)
+}
+
+// cacheKeyAddress returns the address of a cache key
+func cacheKeyAddress(key any) string {
+	switch k := key.(type) {
+	case TransactionStatusParams:
+		return k.Address
+	case WalletBalanceParams:
+		return k.Address
+	}
+	return ""
+}
+
+// load returns the unexpired cached value of key, or waits for the request
+// already in flight for it, or calls fetch and caches its result
+func (a *CachingAPI) load(ctx context.Context, key any, fetch func() (any, error)) (any, error) {
+	for {
+		a.mu.Lock()
+		if v, ok := a.get(key); ok {
+			a.mu.Unlock()
+			return v, nil
+		}
+		call, waiting := a.inFlight[key]
+		if !waiting {
+			call = &cacheCall{done: make(chan struct{})}
+			a.inFlight[key] = call
+		}
+		a.mu.Unlock()
+
+		if !waiting {
+			a.run(key, call, fetch)
+			return call.value, call.err
+		}
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// A request given up by its own caller is not a result for this one
+		if call.err != nil && (errors.Is(call.err, context.Canceled) || errors.Is(call.err, context.DeadlineExceeded)) && ctx.Err() == nil {
+			continue
+		}
+		return call.value, call.err
+	}
+}
+
+// run makes the request of a load and caches its result. Callers waiting for
+// it are released even if fetch panics.
+func (a *CachingAPI) run(key any, call *cacheCall, fetch func() (any, error)) {
+	returned := false
+	defer func() {
+		if !returned {
+			call.err = errors.New("sagapay: cached call panicked")
+		}
+		a.mu.Lock()
+		// Invalidate or Purge may have dropped the call while it ran
+		if a.inFlight[key] == call {
+			delete(a.inFlight, key)
+			if call.err == nil {
+				a.put(key, call.value)
+			}
+		}
+		a.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.value, call.err = fetch()
+	returned = true
+}
+
+// get returns the unexpired cached value of key and marks it recently used.
+// The caller holds a.mu.
+func (a *CachingAPI) get(key any) (any, bool) {
+	elem, ok := a.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !a.now().Before(entry.expires) {
+		a.order.Remove(elem)
+		delete(a.entries, key)
+		return nil, false
+	}
+	a.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+// put caches value under key, evicting the least recently used entries past
+// MaxEntries. The caller holds a.mu.
+func (a *CachingAPI) put(key, value any) {
+	entry := &cacheEntry{key: key, value: value, expires: a.now().Add(a.config.TTL)}
+	if elem, ok := a.entries[key]; ok {
+		elem.Value = entry
+		a.order.MoveToFront(elem)
+	} else {
+		a.entries[key] = a.order.PushFront(entry)
+	}
+
+	for a.config.MaxEntries > 0 && a.order.Len() > a.config.MaxEntries {
+		oldest := a.order.Back()
+		a.order.Remove(oldest)
+		delete(a.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
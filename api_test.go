@@ -0,0 +1,325 @@
+package sagapay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubAPI is an API that counts its calls and answers them with status and
+// balance, blocking while gate is set until it is closed
+type stubAPI struct {
+	calls   atomic.Int32
+	gate    chan struct{}
+	err     error
+	balance string
+}
+
+func (a *stubAPI) wait(ctx context.Context) error {
+	a.calls.Add(1)
+	if a.gate != nil {
+		select {
+		case <-a.gate:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return a.err
+}
+
+func (a *stubAPI) CreateDeposit(ctx context.Context, params CreateDepositParams) (*DepositResponse, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	return &DepositResponse{ID: "dep-1", Address: "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"}, nil
+}
+
+func (a *stubAPI) CreateWithdrawal(ctx context.Context, params CreateWithdrawalParams) (*WithdrawalResponse, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	return &WithdrawalResponse{ID: "wd-1"}, nil
+}
+
+func (a *stubAPI) CheckTransactionStatus(ctx context.Context, address string, transactionType TransactionType) (*TransactionStatusResponse, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	return &TransactionStatusResponse{Transactions: []Transaction{{ID: "tx-" + address}}}, nil
+}
+
+func (a *stubAPI) FetchWalletBalance(ctx context.Context, address string, networkType NetworkType, contractAddress string) (*WalletBalanceResponse, error) {
+	if err := a.wait(ctx); err != nil {
+		return nil, err
+	}
+	return &WalletBalanceResponse{Address: address, Balance: Balance{Raw: a.balance}}, nil
+}
+
+// validWithdrawal returns withdrawal params that pass validation
+func validWithdrawal() CreateWithdrawalParams {
+	return CreateWithdrawalParams{
+		NetworkType:     NetworkTypeBEP20,
+		ContractAddress: NativeContractAddress,
+		Address:         "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		Amount:          "10",
+		IPNUrl:          "https://example.com/ipn",
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	stub := &stubAPI{}
+	api := ReadOnly(stub)
+	ctx := context.Background()
+
+	if _, err := api.CreateDeposit(ctx, CreateDepositParams{}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("CreateDeposit = %v, want ErrReadOnly", err)
+	}
+	if _, err := api.CreateWithdrawal(ctx, validWithdrawal()); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("CreateWithdrawal = %v, want ErrReadOnly", err)
+	}
+	if stub.calls.Load() != 0 {
+		t.Fatalf("%d writes reached the wrapped API", stub.calls.Load())
+	}
+
+	if _, err := api.CheckTransactionStatus(ctx, "0xabc", TransactionTypeDeposit); err != nil {
+		t.Error(err)
+	}
+	if _, err := api.FetchWalletBalance(ctx, "0xabc", NetworkTypeBEP20, NativeContractAddress); err != nil {
+		t.Error(err)
+	}
+	if stub.calls.Load() != 2 {
+		t.Errorf("%d reads reached the wrapped API, want 2", stub.calls.Load())
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	stub := &stubAPI{}
+	api := DryRun(stub)
+	ctx := context.Background()
+
+	_, err := api.CreateWithdrawal(ctx, validWithdrawal())
+	if !errors.Is(err, ErrDryRun) {
+		t.Errorf("CreateWithdrawal = %v, want ErrDryRun", err)
+	}
+	if strings.Contains(err.Error(), validWithdrawal().Address) {
+		t.Errorf("error %q shows the full address", err)
+	}
+
+	invalid := validWithdrawal()
+	invalid.Amount = ""
+	var verr *ValidationError
+	if _, err := api.CreateWithdrawal(ctx, invalid); !errors.As(err, &verr) || verr.Field("amount") == nil {
+		t.Errorf("CreateWithdrawal of invalid params = %v, want an amount ValidationError", err)
+	}
+	if stub.calls.Load() != 0 {
+		t.Fatal("a withdrawal reached the wrapped API")
+	}
+
+	if _, err := api.CreateDeposit(ctx, CreateDepositParams{}); err != nil {
+		t.Errorf("CreateDeposit = %v, want it passed through", err)
+	}
+}
+
+func TestLoggingAPI(t *testing.T) {
+	var buf bytes.Buffer
+	stub := &stubAPI{}
+	api := LoggingAPI(stub, slog.New(slog.NewTextHandler(&buf, nil)))
+	ctx := context.Background()
+
+	api.CreateWithdrawal(ctx, validWithdrawal())
+	stub.err = errors.New("connection reset")
+	api.FetchWalletBalance(ctx, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", NetworkTypeBEP20, NativeContractAddress)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("%d records, want 2:\n%s", len(lines), buf.String())
+	}
+	for _, want := range []string{"level=INFO", `msg="sagapay call"`, "endpoint=" + EndpointCreateWithdrawal, "id=wd-1", "address=0x5a…eAed", "amount=10"} {
+		if !strings.Contains(lines[0], want) {
+			t.Errorf("first record %q does not contain %q", lines[0], want)
+		}
+	}
+	for _, want := range []string{"level=ERROR", "endpoint=" + EndpointFetchWalletBalance, `error="connection reset"`} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("second record %q does not contain %q", lines[1], want)
+		}
+	}
+	if strings.Contains(buf.String(), "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed") {
+		t.Error("log contains a full address")
+	}
+}
+
+func TestCachingAPI(t *testing.T) {
+	stub := &stubAPI{balance: "1"}
+	api := NewCachingAPI(stub, CacheConfig{TTL: time.Minute})
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	api.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	fetch := func(address string) *WalletBalanceResponse {
+		t.Helper()
+		resp, err := api.FetchWalletBalance(ctx, address, NetworkTypeBEP20, NativeContractAddress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	first := fetch("0xabc")
+	if fetch("0xabc") != first || stub.calls.Load() != 1 {
+		t.Errorf("a cached balance was fetched again (%d calls)", stub.calls.Load())
+	}
+	api.CheckTransactionStatus(ctx, "0xabc", TransactionTypeDeposit)
+	if stub.calls.Load() != 2 {
+		t.Errorf("transaction status shared the balance entry (%d calls)", stub.calls.Load())
+	}
+
+	// Expired entries are fetched again
+	now = now.Add(time.Minute)
+	if fetch("0xabc") == first || stub.calls.Load() != 3 {
+		t.Errorf("an expired balance was reused (%d calls)", stub.calls.Load())
+	}
+
+	// Invalidate drops every response for the address
+	api.Invalidate("0xabc")
+	fetch("0xabc")
+	api.CheckTransactionStatus(ctx, "0xabc", TransactionTypeDeposit)
+	if stub.calls.Load() != 5 {
+		t.Errorf("%d calls after Invalidate, want 5", stub.calls.Load())
+	}
+
+	// Errors are not cached
+	stub.err = errors.New("unavailable")
+	if _, err := api.FetchWalletBalance(ctx, "0xdef", NetworkTypeBEP20, NativeContractAddress); err == nil {
+		t.Fatal("expected an error")
+	}
+	stub.err = nil
+	fetch("0xdef")
+	if stub.calls.Load() != 7 {
+		t.Errorf("%d calls after an error, want 7", stub.calls.Load())
+	}
+
+	// Writes always pass through
+	api.CreateDeposit(ctx, CreateDepositParams{})
+	api.CreateDeposit(ctx, CreateDepositParams{})
+	if stub.calls.Load() != 9 {
+		t.Errorf("%d calls after two deposits, want 9", stub.calls.Load())
+	}
+}
+
+func TestCachingAPIEvictsLeastRecentlyUsed(t *testing.T) {
+	stub := &stubAPI{}
+	api := NewCachingAPI(stub, CacheConfig{TTL: time.Hour, MaxEntries: 2})
+	ctx := context.Background()
+	status := func(address string) {
+		t.Helper()
+		if _, err := api.CheckTransactionStatus(ctx, address, TransactionTypeDeposit); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status("a")
+	status("b")
+	status("a") // a is now more recently used than b
+	status("c") // evicts b
+	if stub.calls.Load() != 3 {
+		t.Fatalf("%d calls, want 3", stub.calls.Load())
+	}
+	status("a")
+	status("c")
+	if stub.calls.Load() != 3 {
+		t.Errorf("a recently used entry was evicted (%d calls)", stub.calls.Load())
+	}
+	status("b")
+	if stub.calls.Load() != 4 {
+		t.Errorf("the least recently used entry was kept (%d calls)", stub.calls.Load())
+	}
+	if len(api.entries) != 2 || api.order.Len() != 2 {
+		t.Errorf("%d entries and %d list elements, want 2", len(api.entries), api.order.Len())
+	}
+}
+
+func TestCachingAPICoalescesRequests(t *testing.T) {
+	stub := &stubAPI{gate: make(chan struct{})}
+	api := NewCachingAPI(stub, CacheConfig{})
+
+	var wg sync.WaitGroup
+	responses := make([]*TransactionStatusResponse, 10)
+	for i := range responses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := api.CheckTransactionStatus(context.Background(), "0xabc", TransactionTypeDeposit)
+			if err != nil {
+				t.Error(err)
+			}
+			responses[i] = resp
+		}()
+	}
+	// Let the callers queue up behind the first request
+	for {
+		api.mu.Lock()
+		call := api.inFlight[TransactionStatusParams{Address: "0xabc", TransactionType: TransactionTypeDeposit}]
+		api.mu.Unlock()
+		if call != nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(stub.gate)
+	wg.Wait()
+
+	if n := stub.calls.Load(); n != 1 {
+		t.Errorf("%d requests for concurrent callers, want 1", n)
+	}
+	for i, resp := range responses {
+		if resp != responses[0] {
+			t.Errorf("caller %d got a different response", i)
+		}
+	}
+}
+
+func TestCachingAPIWaiterOutlivesCancelledRequest(t *testing.T) {
+	stub := &stubAPI{gate: make(chan struct{})}
+	api := NewCachingAPI(stub, CacheConfig{})
+	key := TransactionStatusParams{Address: "0xabc", TransactionType: TransactionTypeDeposit}
+
+	// The first caller gives up; a caller waiting on it makes its own request
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := api.CheckTransactionStatus(ctx, "0xabc", TransactionTypeDeposit)
+		first <- err
+	}()
+	for {
+		api.mu.Lock()
+		_, ok := api.inFlight[key]
+		api.mu.Unlock()
+		if ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	second := make(chan error, 1)
+	go func() {
+		_, err := api.CheckTransactionStatus(context.Background(), "0xabc", TransactionTypeDeposit)
+		second <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("first caller = %v, want context.Canceled", err)
+	}
+	close(stub.gate)
+	if err := <-second; err != nil {
+		t.Errorf("waiting caller = %v, want its own request to succeed", err)
+	}
+}
@@ -0,0 +1,205 @@
+package sagapay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// DefaultBatchConcurrency is the default number of parallel requests made by FetchWalletBalances
+const DefaultBatchConcurrency = 8
+
+// BalanceQuery identifies a wallet balance to fetch with FetchWalletBalances
+type BalanceQuery = WalletBalanceParams
+
+// BalanceResult is the outcome of one query of FetchWalletBalances
+type BalanceResult struct {
+	Query BalanceQuery
+
+	// Response is the balance, if the query succeeded
+	Response *WalletBalanceResponse
+
+	// Err is the error of the query, if it failed or was skipped
+	Err error
+}
+
+// BalanceResults are the results of FetchWalletBalances, in query order
+type BalanceResults []BalanceResult
+
+// BalanceTotal is the sum of the balances of a token across addresses
+type BalanceTotal struct {
+	Token Token
+
+	// Total is the sum of the raw balances, in display units
+	Total Amount
+
+	// Addresses is the number of distinct addresses summed
+	Addresses int
+}
+
+// FetchWalletBalances fetches many wallet balances in parallel, with at most
+// Config.BatchConcurrency requests in flight. Identical queries are fetched
+// once, comparing addresses as NormalizeAddress does. The results are in query order, with a per-query error for queries
+// that failed. An authentication failure (ErrUnauthorized or ErrForbidden)
+// stops the batch: queries not yet made fail with that error, which is also
+// returned. Otherwise the returned error is nil unless ctx is done.
+func (c *Client) FetchWalletBalances(ctx context.Context, queries []BalanceQuery) (BalanceResults, error) {
+	// Fetch each distinct query once
+	index := make(map[BalanceQuery]int, len(queries))
+	var unique []BalanceQuery
+	for _, q := range queries {
+		if _, ok := index[balanceKey(q)]; !ok {
+			index[balanceKey(q)] = len(unique)
+			unique = append(unique, q)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		fatal     error
+		fatalOnce sync.Once
+		wg        sync.WaitGroup
+	)
+	fetched := make([]BalanceResult, len(unique))
+	jobs := make(chan int)
+
+	for w := 0; w < min(c.batchConcurrency, len(unique)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				q := unique[i]
+				resp, err := c.FetchWalletBalance(ctx, q.Address, q.NetworkType, q.ContractAddress)
+				fetched[i] = BalanceResult{Query: q, Response: resp, Err: err}
+
+				// Every other query would fail the same way
+				if errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrForbidden) {
+					fatalOnce.Do(func() {
+						fatal = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := range unique {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Report why queries that were skipped or interrupted did not complete
+	for i := range fetched {
+		r := &fetched[i]
+		r.Query = unique[i]
+		if r.Response != nil || r.Err != nil && !errors.Is(r.Err, context.Canceled) {
+			continue
+		}
+		switch {
+		case fatal != nil:
+			r.Err = fatal
+		case r.Err == nil:
+			r.Err = ctx.Err()
+		}
+	}
+
+	results := make(BalanceResults, len(queries))
+	for i, q := range queries {
+		results[i] = fetched[index[balanceKey(q)]]
+		results[i].Query = q
+	}
+
+	if fatal != nil {
+		return results, fatal
+	}
+	return results, ctx.Err()
+}
+
+// balanceKey returns a query with its addresses normalized, so queries that
+// differ only in the case of an EVM address compare equal
+func balanceKey(q BalanceQuery) BalanceQuery {
+	q.Address = NormalizeAddress(q.NetworkType, q.Address)
+	q.ContractAddress = NormalizeAddress(q.NetworkType, q.ContractAddress)
+	return q
+}
+
+// Failed returns the results that have an error
+func (r BalanceResults) Failed() BalanceResults {
+	var failed BalanceResults
+	for _, result := range r {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Totals sums the raw balances of the successful results per token, using
+// each token's decimals. Duplicate queries, including ones that differ only
+// in the case of an EVM address, are counted once. The totals are
+// ordered by network and contract address.
+func (r BalanceResults) Totals() ([]BalanceTotal, error) {
+	type tokenKey struct {
+		network  NetworkType
+		contract string
+	}
+
+	seen := make(map[BalanceQuery]bool, len(r))
+	totals := make(map[tokenKey]*BalanceTotal)
+	for _, result := range r {
+		key := balanceKey(result.Query)
+		if result.Response == nil || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		resp := result.Response
+		amount, err := resp.Balance.RawAmount(resp.Token.Decimals)
+		if err != nil {
+			return nil, fmt.Errorf("balance of %s: %w", resp.Address, err)
+		}
+
+		contract := resp.Token.ContractAddress
+		if contract == "" {
+			contract = resp.ContractAddress
+		}
+		token := tokenKey{result.Query.NetworkType, NormalizeAddress(result.Query.NetworkType, contract)}
+		total, ok := totals[token]
+		if !ok {
+			total = &BalanceTotal{Token: resp.Token}
+			totals[token] = total
+		} else if total.Token.Decimals != resp.Token.Decimals {
+			return nil, fmt.Errorf("balance of %s: token %s reported with %d and %d decimals",
+				resp.Address, resp.Token.Symbol, total.Token.Decimals, resp.Token.Decimals)
+		}
+		total.Total = total.Total.Add(amount)
+		total.Addresses++
+	}
+
+	keys := make([]tokenKey, 0, len(totals))
+	for key := range totals {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].network != keys[j].network {
+			return keys[i].network < keys[j].network
+		}
+		return keys[i].contract < keys[j].contract
+	})
+
+	result := make([]BalanceTotal, len(keys))
+	for i, key := range keys {
+		result[i] = *totals[key]
+	}
+	return result, nil
+}
@@ -0,0 +1,87 @@
+package sagapay_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/halfindex/sagapay-go-sdk"
+	"github.com/halfindex/sagapay-go-sdk/sagapaytest"
+)
+
+func TestFetchWalletBalancesMixedCase(t *testing.T) {
+	srv := sagapaytest.NewServer(sagapaytest.Config{})
+	defer srv.Close()
+
+	const (
+		checksummed = "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+		usdt        = "0x55d398326f99059fF775485246999027B3197955"
+		tron        = "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+	)
+	srv.SetBalance(checksummed, sagapay.NetworkTypeBEP20, sagapay.NativeContractAddress, "5000000000000000000")
+	srv.SetBalance(checksummed, sagapay.NetworkTypeBEP20, usdt, "2000000000000000000")
+	srv.SetBalance(tron, sagapay.NetworkTypeTRC20, sagapay.NativeContractAddress, "1000000")
+
+	var requests atomic.Int32
+	config := srv.ClientConfig()
+	config.Middleware = []sagapay.Middleware{
+		func(next sagapay.Doer) sagapay.Doer {
+			return sagapay.DoerFunc(func(ctx context.Context, call *sagapay.Call) error {
+				requests.Add(1)
+				return next.Do(ctx, call)
+			})
+		},
+	}
+	client, err := sagapay.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lower := strings.ToLower(checksummed)
+	queries := []sagapay.BalanceQuery{
+		{Address: checksummed, NetworkType: sagapay.NetworkTypeBEP20, ContractAddress: sagapay.NativeContractAddress},
+		{Address: lower, NetworkType: sagapay.NetworkTypeBEP20, ContractAddress: sagapay.NativeContractAddress},
+		{Address: checksummed, NetworkType: sagapay.NetworkTypeBEP20, ContractAddress: usdt},
+		{Address: lower, NetworkType: sagapay.NetworkTypeBEP20, ContractAddress: strings.ToLower(usdt)},
+		{Address: tron, NetworkType: sagapay.NetworkTypeTRC20, ContractAddress: sagapay.NativeContractAddress},
+	}
+	results, err := client.FetchWalletBalances(context.Background(), queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// EVM addresses differing only in case are fetched once
+	if n := requests.Load(); n != 3 {
+		t.Errorf("%d requests, want 3", n)
+	}
+	for i, result := range results {
+		if result.Err != nil {
+			t.Errorf("result %d: %v", i, result.Err)
+		}
+		if result.Query != queries[i] {
+			t.Errorf("result %d: query = %+v, want %+v", i, result.Query, queries[i])
+		}
+	}
+	if results[1].Response != results[0].Response {
+		t.Error("the lowercase query did not share the checksummed query's response")
+	}
+
+	totals, err := results.Totals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, total := range totals {
+		got = append(got, fmt.Sprintf("%s %s %s %d", total.Token.NetworkType, total.Token.ContractAddress, total.Total, total.Addresses))
+	}
+	want := []string{
+		"BEP20 0 5 1",
+		"BEP20 " + usdt + " 2 1",
+		"TRC20 0 1 1",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("totals:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
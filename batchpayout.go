@@ -0,0 +1,521 @@
+package sagapay
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PayoutRow is one withdrawal of a batch payout
+type PayoutRow struct {
+	// Line is the row's line in the source file, for error messages
+	Line int `json:"-"`
+
+	NetworkType     NetworkType `json:"network"`
+	ContractAddress string      `json:"contract"`
+	Address         string      `json:"address"`
+	Amount          string      `json:"amount"`
+	UDF             string      `json:"udf,omitempty"`
+}
+
+// payoutColumns are the columns of a batch payout CSV file
+var payoutColumns = []string{"network", "contract", "address", "amount", "udf"}
+
+// ReadPayoutCSV reads batch payout rows from CSV. The first row is a header
+// naming the columns network, contract, address, amount and, optionally,
+// udf, in any order; other columns are ignored.
+func ReadPayoutCSV(r io.Reader) ([]PayoutRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payout CSV header: %w", err)
+	}
+	index := make(map[string]int)
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range payoutColumns[:4] {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("payout CSV header is missing the %q column", name)
+		}
+	}
+
+	var rows []PayoutRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read payout CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		get := func(name string) string {
+			if i, ok := index[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		rows = append(rows, PayoutRow{
+			Line:            line,
+			NetworkType:     NetworkType(strings.ToUpper(get("network"))),
+			ContractAddress: get("contract"),
+			Address:         get("address"),
+			Amount:          get("amount"),
+			UDF:             get("udf"),
+		})
+	}
+}
+
+// ReadPayoutJSONL reads batch payout rows from JSON lines, one object per
+// line with the keys network, contract, address, amount and udf
+func ReadPayoutJSONL(r io.Reader) ([]PayoutRow, error) {
+	var rows []PayoutRow
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var row PayoutRow
+		if err := json.Unmarshal([]byte(text), &row); err != nil {
+			return nil, fmt.Errorf("failed to read payout JSONL: line %d: %w", line, err)
+		}
+		row.Line = line
+		row.NetworkType = NetworkType(strings.ToUpper(string(row.NetworkType)))
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read payout JSONL: %w", err)
+	}
+	return rows, nil
+}
+
+// PayoutTotal is the total of a batch's payouts of one token
+type PayoutTotal struct {
+	NetworkType     NetworkType `json:"network"`
+	ContractAddress string      `json:"contract"`
+	Total           Amount      `json:"total"`
+
+	// Count is the number of payouts of the token
+	Count int `json:"count"`
+}
+
+// BatchPayoutConfig configures a BatchPayout
+type BatchPayoutConfig struct {
+	// BatchID names the batch, e.g. "affiliates-2026-10". It is part of every
+	// idempotency key, so rerunning a batch ID never pays a row twice while
+	// next month's batch with the same rows pays again. Required.
+	BatchID string
+
+	// IPNUrl receives the webhooks of every withdrawal. Required.
+	IPNUrl string
+
+	// JournalPath is the file progress is recorded in. Required.
+	JournalPath string
+
+	// Concurrency bounds the withdrawals in flight (default DefaultBatchConcurrency)
+	Concurrency int
+
+	// OnResult, if set, is called after each row is processed. Calls are not concurrent.
+	OnResult func(result BatchPayoutResult, done, total int)
+}
+
+// BatchPayoutResult is the outcome of one row of a batch payout
+type BatchPayoutResult struct {
+	Row            PayoutRow
+	IdempotencyKey string
+
+	// Withdrawal is the API response. For rows submitted by an earlier run
+	// only ID and Status are known.
+	Withdrawal *WithdrawalResponse
+
+	// Resumed is true for rows submitted by an earlier run and skipped
+	Resumed bool
+
+	// Err is the error of the row, if it failed or was not attempted
+	Err error
+}
+
+// BatchPayoutResults are the results of a batch payout, in row order
+type BatchPayoutResults []BatchPayoutResult
+
+// Failed returns the results that have an error
+func (r BatchPayoutResults) Failed() BatchPayoutResults {
+	var failed BatchPayoutResults
+	for _, result := range r {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// BatchPayout pays out a list of withdrawals, such as a monthly affiliate
+// payout, from a validated plan. Progress is journaled so an interrupted run
+// can be started again: rows already submitted are skipped, and the others
+// are resent with the same idempotency keys, so no row is paid twice.
+type BatchPayout struct {
+	client API
+	config BatchPayoutConfig
+	rows   []PayoutRow
+	keys   []string
+	totals []PayoutTotal
+}
+
+// NewBatchPayout validates every row up front and returns the batch, or a
+// *ValidationError listing every invalid row, with fields named like
+// "line 3: address". Nothing is sent until Run.
+func NewBatchPayout(client API, rows []PayoutRow, config BatchPayoutConfig) (*BatchPayout, error) {
+	if config.Concurrency <= 0 {
+		config.Concurrency = DefaultBatchConcurrency
+	}
+
+	verr := &ValidationError{}
+	if config.BatchID == "" {
+		verr.add("batchId", "is required")
+	}
+	if config.IPNUrl == "" {
+		verr.add("ipnUrl", "is required")
+	}
+	if config.JournalPath == "" {
+		verr.add("journalPath", "is required")
+	}
+	if len(rows) == 0 {
+		verr.add("rows", "must not be empty")
+	}
+
+	type tokenKey struct {
+		network  NetworkType
+		contract string
+	}
+	totals := make(map[tokenKey]*PayoutTotal)
+	occurrences := make(map[string]int)
+	b := &BatchPayout{client: client, config: config, rows: rows, keys: make([]string, len(rows))}
+
+	for i, row := range rows {
+		prefix := fmt.Sprintf("line %d: ", row.Line)
+		params := row.params(config.IPNUrl)
+		if err := params.Validate(); err != nil {
+			var rowErr *ValidationError
+			if errors.As(err, &rowErr) {
+				for _, field := range rowErr.Fields {
+					if field.Field == "ipnUrl" {
+						continue
+					}
+					field.Field = prefix + field.Field
+					verr.Fields = append(verr.Fields, field)
+				}
+			}
+			continue
+		}
+
+		amount, _ := ParseAmount(row.Amount)
+		key := tokenKey{row.NetworkType, NormalizeAddress(row.NetworkType, row.ContractAddress)}
+		total, ok := totals[key]
+		if !ok {
+			total = &PayoutTotal{NetworkType: row.NetworkType, ContractAddress: row.ContractAddress}
+			totals[key] = total
+		}
+		total.Total = total.Total.Add(amount)
+		total.Count++
+
+		// Identical rows are distinct payouts, told apart by occurrence
+		content := strings.Join([]string{
+			string(row.NetworkType), key.contract, NormalizeAddress(row.NetworkType, row.Address),
+			amount.String(), row.UDF,
+		}, "|")
+		occurrences[content]++
+		b.keys[i] = uuid.NewSHA1(uuid.NameSpaceURL,
+			[]byte(fmt.Sprintf("sagapay-batch:%s|%s|%d", config.BatchID, content, occurrences[content]))).String()
+	}
+	if err := verr.err(); err != nil {
+		return nil, err
+	}
+
+	for _, total := range totals {
+		b.totals = append(b.totals, *total)
+	}
+	sort.Slice(b.totals, func(i, j int) bool {
+		if b.totals[i].NetworkType != b.totals[j].NetworkType {
+			return b.totals[i].NetworkType < b.totals[j].NetworkType
+		}
+		return b.totals[i].ContractAddress < b.totals[j].ContractAddress
+	})
+	return b, nil
+}
+
+// Rows returns the rows of the batch
+func (b *BatchPayout) Rows() []PayoutRow {
+	return b.rows
+}
+
+// Totals returns the total amount and count of payouts per token, ordered by
+// network and contract address
+func (b *BatchPayout) Totals() []PayoutTotal {
+	return b.totals
+}
+
+// IdempotencyKey returns the idempotency key of row i. Keys are derived from
+// the batch ID and the row's contents, not its position, so reordering the
+// file between runs does not change them.
+func (b *BatchPayout) IdempotencyKey(i int) string {
+	return b.keys[i]
+}
+
+// Run submits every row not already submitted according to the journal,
+// with at most Config.Concurrency withdrawals in flight, and returns the
+// results in row order. An authentication failure (ErrUnauthorized or
+// ErrForbidden) stops the batch: rows not yet sent fail with that error,
+// which is also returned. Otherwise the returned error is nil unless the
+// journal cannot be written or ctx is done; check the per-row errors.
+func (b *BatchPayout) Run(ctx context.Context) (BatchPayoutResults, error) {
+	journal, err := openPayoutJournal(b.config.JournalPath, b.config.BatchID)
+	if err != nil {
+		return nil, err
+	}
+	defer journal.close()
+
+	results := make(BatchPayoutResults, len(b.rows))
+	var pending []int
+	for i, row := range b.rows {
+		results[i] = BatchPayoutResult{Row: row, IdempotencyKey: b.keys[i]}
+		if entry, ok := journal.submitted[b.keys[i]]; ok {
+			results[i].Withdrawal = &WithdrawalResponse{ID: entry.WithdrawalID, Status: entry.WithdrawalStatus, IdempotencyKey: b.keys[i]}
+			results[i].Resumed = true
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu         sync.Mutex
+		done       int
+		fatal      error
+		journalErr error
+		wg         sync.WaitGroup
+	)
+	for _, result := range results {
+		if result.Resumed {
+			done++
+			if b.config.OnResult != nil {
+				b.config.OnResult(result, done, len(b.rows))
+			}
+		}
+	}
+
+	jobs := make(chan int)
+	for w := 0; w < min(b.config.Concurrency, len(pending)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				row := b.rows[i]
+				if err := journal.write(payoutJournalEntry{Key: b.keys[i], Line: row.Line, Status: journalStarted}); err != nil {
+					mu.Lock()
+					journalErr = err
+					mu.Unlock()
+					cancel()
+					continue
+				}
+
+				params := row.params(b.config.IPNUrl)
+				params.IdempotencyKey = b.keys[i]
+				resp, err := b.client.CreateWithdrawal(ctx, params)
+
+				entry := payoutJournalEntry{Key: b.keys[i], Line: row.Line, Status: journalSubmitted}
+				if err != nil {
+					entry.Status, entry.Error = journalFailed, err.Error()
+				} else {
+					entry.WithdrawalID, entry.WithdrawalStatus = resp.ID, resp.Status
+				}
+				writeErr := journal.write(entry)
+
+				mu.Lock()
+				results[i].Withdrawal, results[i].Err = resp, err
+				if writeErr != nil && journalErr == nil {
+					journalErr = writeErr
+					cancel()
+				}
+				if errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrForbidden) {
+					if fatal == nil {
+						fatal = err
+						cancel()
+					}
+				}
+				done++
+				if b.config.OnResult != nil {
+					b.config.OnResult(results[i], done, len(b.rows))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, i := range pending {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Report why rows that were skipped did not complete
+	for _, i := range pending {
+		r := &results[i]
+		if r.Withdrawal != nil || r.Err != nil && !errors.Is(r.Err, context.Canceled) {
+			continue
+		}
+		switch {
+		case journalErr != nil:
+			r.Err = journalErr
+		case fatal != nil:
+			r.Err = fatal
+		case r.Err == nil:
+			r.Err = ctx.Err()
+		}
+	}
+
+	switch {
+	case journalErr != nil:
+		return results, journalErr
+	case fatal != nil:
+		return results, fatal
+	}
+	return results, ctx.Err()
+}
+
+// params returns the withdrawal parameters of a row
+func (r PayoutRow) params(ipnURL string) CreateWithdrawalParams {
+	return CreateWithdrawalParams{
+		NetworkType:     r.NetworkType,
+		ContractAddress: r.ContractAddress,
+		Address:         r.Address,
+		Amount:          r.Amount,
+		IPNUrl:          ipnURL,
+		UDF:             r.UDF,
+	}
+}
+
+// Journal entry statuses
+const (
+	journalStarted   = "started"
+	journalSubmitted = "submitted"
+	journalFailed    = "failed"
+)
+
+// payoutJournalEntry is a line of a batch payout journal
+type payoutJournalEntry struct {
+	BatchID          string            `json:"batchId,omitempty"`
+	Key              string            `json:"key,omitempty"`
+	Line             int               `json:"line,omitempty"`
+	Status           string            `json:"status,omitempty"`
+	WithdrawalID     string            `json:"withdrawalId,omitempty"`
+	WithdrawalStatus TransactionStatus `json:"withdrawalStatus,omitempty"`
+	Error            string            `json:"error,omitempty"`
+	At               time.Time         `json:"at"`
+}
+
+// payoutJournal appends batch payout progress to a JSON lines file. The
+// first line names the batch, so a journal is never reused for another.
+type payoutJournal struct {
+	mu        sync.Mutex
+	file      *os.File
+	submitted map[string]payoutJournalEntry
+}
+
+// openPayoutJournal opens or creates a journal and loads the rows it records
+// as submitted. It fails with an error matching ErrStoreLocked if another
+// process has the journal open.
+func openPayoutJournal(path, batchID string) (*payoutJournal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open payout journal: %w", err)
+	}
+
+	// Two runs sharing a journal could both resend a row before either records it
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to lock payout journal %s: %w", path, err)
+	}
+	j := &payoutJournal{file: file, submitted: make(map[string]payoutJournalEntry)}
+
+	// A torn last line from a crash is dropped; the row is resent with its key
+	empty := true
+	var owner string
+	err = readJSONLines(file, func(line int, data []byte) error {
+		var entry payoutJournalEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		if empty {
+			empty = false
+			owner = entry.BatchID
+			return nil
+		}
+		if entry.Status == journalSubmitted {
+			j.submitted[entry.Key] = entry
+		}
+		return nil
+	})
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read payout journal: %w", err)
+	}
+	if !empty && owner != batchID {
+		file.Close()
+		return nil, fmt.Errorf("payout journal %s belongs to batch %q, not %q", path, owner, batchID)
+	}
+
+	if empty {
+		if err := j.write(payoutJournalEntry{BatchID: batchID}); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+// write appends an entry to the journal and syncs it
+func (j *payoutJournal) write(entry payoutJournalEntry) error {
+	entry.At = time.Now().UTC()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode payout journal entry: %w", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write payout journal: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync payout journal: %w", err)
+	}
+	return nil
+}
+
+// close closes the journal file
+func (j *payoutJournal) close() error {
+	return j.file.Close()
+}
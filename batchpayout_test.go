@@ -0,0 +1,168 @@
+package sagapay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestPayoutJournalResume(t *testing.T) {
+	const header = `{"batchId":"b1","at":"2026-10-01T00:00:00Z"}` + "\n"
+	submitted := func(key string) string {
+		return `{"key":"` + key + `","status":"submitted","at":"2026-10-01T00:00:00Z"}`
+	}
+
+	tests := []struct {
+		name      string
+		contents  string
+		want      []string // keys loaded as submitted
+		wantError string
+	}{
+		{
+			name:     "empty",
+			contents: "",
+		},
+		{
+			name:     "complete",
+			contents: header + submitted("k1") + "\n" + `{"key":"k2","status":"started","at":"2026-10-01T00:00:00Z"}` + "\n",
+			want:     []string{"k1"},
+		},
+		{
+			name:     "torn last line",
+			contents: header + submitted("k1") + "\n" + `{"key":"k2","sta`,
+			want:     []string{"k1"},
+		},
+		{
+			name:     "last line missing its newline",
+			contents: header + submitted("k1"),
+			want:     []string{"k1"},
+		},
+		{
+			name:      "corrupt earlier line",
+			contents:  header + `{"key":` + "\n" + submitted("k1") + "\n",
+			wantError: "line 2",
+		},
+		{
+			name:      "other batch",
+			contents:  `{"batchId":"b0","at":"2026-10-01T00:00:00Z"}` + "\n",
+			wantError: `belongs to batch "b0"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "journal.jsonl")
+			if err := os.WriteFile(path, []byte(tt.contents), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			j, err := openPayoutJournal(path, "b1")
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("openPayoutJournal = %v, want an error containing %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("openPayoutJournal: %v", err)
+			}
+			checkSubmitted(t, j, tt.want)
+
+			// The next run appends on a fresh line and sees both entries
+			if err := j.write(payoutJournalEntry{Key: "k3", Status: journalSubmitted}); err != nil {
+				t.Fatal(err)
+			}
+			j.close()
+			j, err = openPayoutJournal(path, "b1")
+			if err != nil {
+				t.Fatalf("reopening: %v", err)
+			}
+			defer j.close()
+			checkSubmitted(t, j, append(tt.want, "k3"))
+		})
+	}
+}
+
+func checkSubmitted(t *testing.T, j *payoutJournal, want []string) {
+	t.Helper()
+	var got []string
+	for key := range j.submitted {
+		got = append(got, key)
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("submitted = %v, want %v", got, want)
+	}
+}
+
+// batchRows returns n valid payout rows
+func batchRows(n int) []PayoutRow {
+	rows := make([]PayoutRow, n)
+	for i := range rows {
+		rows[i] = PayoutRow{
+			Line:            i + 2,
+			NetworkType:     NetworkTypeBEP20,
+			ContractAddress: NativeContractAddress,
+			Address:         "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+			Amount:          fmt.Sprint(i + 1),
+		}
+	}
+	return rows
+}
+
+func TestBatchPayoutResumeProgress(t *testing.T) {
+	ctx := context.Background()
+	stub := &stubAPI{}
+	config := BatchPayoutConfig{
+		BatchID:     "b1",
+		IPNUrl:      "https://example.com/ipn",
+		JournalPath: filepath.Join(t.TempDir(), "journal.jsonl"),
+		Concurrency: 1,
+	}
+
+	// The first run submits two of the three rows
+	first, err := NewBatchPayout(stub, batchRows(3)[:2], config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := first.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var progress []string
+	config.OnResult = func(result BatchPayoutResult, done, total int) {
+		progress = append(progress, fmt.Sprintf("%d/%d resumed=%t", done, total, result.Resumed))
+	}
+	batch, err := NewBatchPayout(stub, batchRows(3), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := batch.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := stub.calls.Load(); n != 3 {
+		t.Errorf("%d withdrawals sent, want 3", n)
+	}
+	if len(results.Failed()) != 0 {
+		t.Errorf("failed rows: %v", results.Failed())
+	}
+	want := "1/3 resumed=true,2/3 resumed=true,3/3 resumed=false"
+	if got := strings.Join(progress, ","); got != want {
+		t.Errorf("progress %s, want %s", got, want)
+	}
+}
+
+func TestNewBatchPayoutUnsupportedNetwork(t *testing.T) {
+	rows := batchRows(1)
+	rows[0].NetworkType = "DOGE"
+	_, err := NewBatchPayout(&stubAPI{}, rows, BatchPayoutConfig{BatchID: "b1", IPNUrl: "https://example.com/ipn", JournalPath: "journal.jsonl"})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Field("line 2: networkType") == nil {
+		t.Errorf("NewBatchPayout = %v, want a line 2 networkType error", err)
+	}
+}
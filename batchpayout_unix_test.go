@@ -0,0 +1,27 @@
+//go:build unix
+
+package sagapay
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestPayoutJournalLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := openPayoutJournal(path, "b1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openPayoutJournal(path, "b1"); !errors.Is(err, ErrStoreLocked) {
+		t.Errorf("second openPayoutJournal = %v, want ErrStoreLocked", err)
+	}
+	j.close()
+
+	j, err = openPayoutJournal(path, "b1")
+	if err != nil {
+		t.Fatalf("reopening after close: %v", err)
+	}
+	j.close()
+}
@@ -10,17 +10,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 const (
 	// DefaultBaseURL is the default base URL for the SagaPay API
 	DefaultBaseURL = "https://api2.sagapay.net"
-	
+
 	// DefaultTimeout is the default timeout for API requests
 	DefaultTimeout = 30 * time.Second
+
+	// IdempotencyKeyHeader is the request header carrying the idempotency key
+	IdempotencyKeyHeader = "Idempotency-Key"
 )
 
 // Client is the SagaPay API client
@@ -34,6 +40,31 @@ type Client struct {
 	// API credentials
 	apiKey    string
 	apiSecret string
+
+	// Retry policy applied to retryable requests
+	retry RetryPolicy
+
+	// Middleware chain ending in the client's own transport
+	doer Doer
+
+	// Structured logging of HTTP attempts
+	logger    *slog.Logger
+	logBodies bool
+	redaction RedactionPolicy
+
+	// Metrics receiving call latencies, result codes and retries
+	metrics Metrics
+
+	// Client-side rate limits, shared by all goroutines, and the clock they run on
+	limiter          *limiter
+	endpointLimiters map[string]*limiter
+	now              func() time.Time
+
+	// Parallel requests made by batch calls
+	batchConcurrency int
+
+	// Policy withdrawals are checked against before they are sent
+	withdrawalPolicy *WithdrawalPolicy
 }
 
 // Config contains the configuration options for the SagaPay client
@@ -52,6 +83,47 @@ type Config struct {
 
 	// HTTPClient is the HTTP client to use for API requests
 	HTTPClient *http.Client
+
+	// RetryPolicy controls how failed requests are retried.
+	// If nil, DefaultRetryPolicy is used; pass NoRetry() to disable retries.
+	RetryPolicy *RetryPolicy
+
+	// Middleware wraps every API call. The first middleware is the outermost.
+	Middleware []Middleware
+
+	// Logger receives a record for every HTTP attempt with the method,
+	// endpoint, status, latency, attempt number and request ID. Credentials
+	// and withdrawal addresses are masked. If nil, nothing is logged.
+	Logger *slog.Logger
+
+	// LogBodies adds request and response bodies to log records, redacted
+	// with RedactionPolicy
+	LogBodies bool
+
+	// RedactionPolicy adds body fields to redact when LogBodies is set. It is
+	// applied on top of DefaultRedactionPolicy and can only tighten it, so
+	// addresses and transaction hashes are always masked.
+	RedactionPolicy RedactionPolicy
+
+	// Metrics receives the latency and result code of every API call and a
+	// count of retries. If nil, no metrics are recorded.
+	Metrics Metrics
+
+	// RateLimit limits the rate and concurrency of all requests. If nil,
+	// requests are only held back when the API answers 429 with Retry-After.
+	RateLimit *RateLimit
+
+	// EndpointRateLimits adds limits for individual endpoints, keyed by
+	// endpoint name (e.g. EndpointFetchWalletBalance), on top of RateLimit
+	EndpointRateLimits map[string]RateLimit
+
+	// BatchConcurrency bounds the parallel requests made by batch calls such
+	// as FetchWalletBalances (default DefaultBatchConcurrency)
+	BatchConcurrency int
+
+	// WithdrawalPolicy, if set, is checked by CreateWithdrawal before the
+	// request is sent. Rejected withdrawals fail with a *PolicyError.
+	WithdrawalPolicy *WithdrawalPolicy
 }
 
 // NewClient creates a new SagaPay API client
@@ -85,66 +157,119 @@ func NewClient(config Config) (*Client, error) {
 		}
 	}
 
-	return &Client{
+	retry := DefaultRetryPolicy()
+	if config.RetryPolicy != nil {
+		retry = *config.RetryPolicy
+	}
+
+	c := &Client{
 		client:    httpClient,
 		baseURL:   parsedURL,
 		apiKey:    config.APIKey,
 		apiSecret: config.APISecret,
-	}, nil
+		retry:     retry,
+		logger:    config.Logger,
+		logBodies: config.LogBodies,
+		redaction: DefaultRedactionPolicy().tighten(config.RedactionPolicy),
+		metrics:   config.Metrics,
+		now:       time.Now,
+
+		batchConcurrency: config.BatchConcurrency,
+		withdrawalPolicy: config.WithdrawalPolicy,
+	}
+	if c.batchConcurrency <= 0 {
+		c.batchConcurrency = DefaultBatchConcurrency
+	}
+
+	var rateLimit RateLimit
+	if config.RateLimit != nil {
+		rateLimit = *config.RateLimit
+	}
+	c.limiter = newLimiter(rateLimit, c.now())
+	c.endpointLimiters = make(map[string]*limiter, len(config.EndpointRateLimits))
+	for endpoint, rl := range config.EndpointRateLimits {
+		c.endpointLimiters[endpoint] = newLimiter(rl, c.now())
+	}
+	c.doer = chain(DoerFunc(c.transport), config.Middleware)
+
+	return c, nil
 }
 
-// CreateDeposit creates a new deposit address for receiving cryptocurrency
+// CreateDeposit creates a new deposit address for receiving cryptocurrency.
+// If params.IdempotencyKey is empty a new key is generated; it is returned in
+// DepositResponse.IdempotencyKey, or in a *RequestError if the request
+// fails, so the request can be safely resent.
 func (c *Client) CreateDeposit(ctx context.Context, params CreateDepositParams) (*DepositResponse, error) {
-	endpoint := "/create-deposit"
-	
 	// Validate params
 	if err := params.Validate(); err != nil {
 		return nil, err
 	}
 
+	if params.IdempotencyKey == "" {
+		params.IdempotencyKey = NewIdempotencyKey()
+	}
+
 	var response DepositResponse
-	err := c.sendRequest(ctx, http.MethodPost, endpoint, params, &response)
+	err := c.sendRequest(ctx, EndpointCreateDeposit, http.MethodPost, params, &response)
 	if err != nil {
-		return nil, err
+		return nil, &RequestError{IdempotencyKey: params.IdempotencyKey, Err: err}
 	}
+	response.IdempotencyKey = params.IdempotencyKey
 
 	return &response, nil
 }
 
-// CreateWithdrawal creates a cryptocurrency withdrawal request
+// CreateWithdrawal creates a cryptocurrency withdrawal request.
+// If params.IdempotencyKey is empty a new key is generated; it is returned in
+// WithdrawalResponse.IdempotencyKey, or in a *RequestError if the request
+// fails (see IdempotencyKeyOf). Reuse it after a timeout so the payout is
+// never created twice; to survive a crash, generate the key with
+// NewIdempotencyKey and persist it before calling.
+//
+// With Config.WithdrawalPolicy set the withdrawal is reserved against the
+// policy first, and released again if the API definitely did not make it.
 func (c *Client) CreateWithdrawal(ctx context.Context, params CreateWithdrawalParams) (*WithdrawalResponse, error) {
-	endpoint := "/create-withdrawal"
-	
 	// Validate params
 	if err := params.Validate(); err != nil {
 		return nil, err
 	}
 
+	if params.IdempotencyKey == "" {
+		params.IdempotencyKey = NewIdempotencyKey()
+	}
+
+	if c.withdrawalPolicy != nil {
+		if err := c.withdrawalPolicy.Reserve(ctx, params); err != nil {
+			return nil, err
+		}
+	}
+
 	var response WithdrawalResponse
-	err := c.sendRequest(ctx, http.MethodPost, endpoint, params, &response)
+	err := c.sendRequest(ctx, EndpointCreateWithdrawal, http.MethodPost, params, &response)
 	if err != nil {
-		return nil, err
+		if c.withdrawalPolicy != nil && notSent(err) {
+			c.withdrawalPolicy.Release(context.WithoutCancel(ctx), params)
+		}
+		return nil, &RequestError{IdempotencyKey: params.IdempotencyKey, Err: err}
 	}
+	response.IdempotencyKey = params.IdempotencyKey
 
 	return &response, nil
 }
 
 // CheckTransactionStatus gets the status of transactions for a specific blockchain address
 func (c *Client) CheckTransactionStatus(ctx context.Context, address string, transactionType TransactionType) (*TransactionStatusResponse, error) {
-	endpoint := "/check-transaction-status"
-
 	// Validate params
 	if address == "" {
-		return nil, fmt.Errorf("address is required")
+		verr := &ValidationError{}
+		verr.add("address", "is required")
+		return nil, verr
 	}
 
-	// Build query parameters
-	queryParams := url.Values{}
-	queryParams.Add("address", address)
-	queryParams.Add("type", string(transactionType))
+	params := TransactionStatusParams{Address: address, TransactionType: transactionType}
 
 	var response TransactionStatusResponse
-	err := c.sendRequestWithQuery(ctx, http.MethodGet, endpoint, queryParams, nil, &response)
+	err := c.sendRequest(ctx, EndpointCheckTransactionStatus, http.MethodGet, params, &response)
 	if err != nil {
 		return nil, err
 	}
@@ -154,23 +279,17 @@ func (c *Client) CheckTransactionStatus(ctx context.Context, address string, tra
 
 // FetchWalletBalance gets the balance of a specific wallet address for a token or native currency
 func (c *Client) FetchWalletBalance(ctx context.Context, address string, networkType NetworkType, contractAddress string) (*WalletBalanceResponse, error) {
-	endpoint := "/fetch-wallet-balance"
-
 	// Validate params
 	if address == "" {
-		return nil, fmt.Errorf("address is required")
+		verr := &ValidationError{}
+		verr.add("address", "is required")
+		return nil, verr
 	}
 
-	// Build query parameters
-	queryParams := url.Values{}
-	queryParams.Add("address", address)
-	queryParams.Add("networkType", string(networkType))
-	if contractAddress != "" {
-		queryParams.Add("contractAddress", contractAddress)
-	}
+	params := WalletBalanceParams{Address: address, NetworkType: networkType, ContractAddress: contractAddress}
 
 	var response WalletBalanceResponse
-	err := c.sendRequestWithQuery(ctx, http.MethodGet, endpoint, queryParams, nil, &response)
+	err := c.sendRequest(ctx, EndpointFetchWalletBalance, http.MethodGet, params, &response)
 	if err != nil {
 		return nil, err
 	}
@@ -178,39 +297,168 @@ func (c *Client) FetchWalletBalance(ctx context.Context, address string, network
 	return &response, nil
 }
 
-// sendRequest sends an API request and parses the response
-func (c *Client) sendRequest(ctx context.Context, method, path string, body interface{}, v interface{}) error {
-	return c.sendRequestWithQuery(ctx, method, path, nil, body, v)
+// sendRequest sends an API call through the middleware chain and decodes the response into v
+func (c *Client) sendRequest(ctx context.Context, endpoint, method string, params interface{}, v interface{}) error {
+	return c.doer.Do(ctx, &Call{
+		Endpoint: endpoint,
+		Method:   method,
+		Params:   params,
+		Response: v,
+		params:   params,
+		Header:   make(http.Header),
+	})
 }
 
-// sendRequestWithQuery sends an API request with query parameters and parses the response
-func (c *Client) sendRequestWithQuery(ctx context.Context, method, path string, query url.Values, body interface{}, v interface{}) error {
+// queryRequest is implemented by params sent as query parameters
+type queryRequest interface {
+	query() url.Values
+}
+
+// idempotentRequest is implemented by request bodies that carry an idempotency key
+type idempotentRequest interface {
+	idempotencyKey() string
+}
+
+// NewIdempotencyKey generates a new random idempotency key
+func NewIdempotencyKey() string {
+	return uuid.NewString()
+}
+
+// transport sends an API call and records its metrics. It is the innermost Doer.
+func (c *Client) transport(ctx context.Context, call *Call) error {
+	start := time.Now()
+	err := c.roundTrip(ctx, call)
+	if c.metrics != nil {
+		c.metrics.ObserveRequest(call.Endpoint, MetricsCode(err), time.Since(start))
+	}
+	return err
+}
+
+// roundTrip sends an API call and parses the response.
+// GET requests and requests carrying an idempotency key are retried according to the client's RetryPolicy.
+func (c *Client) roundTrip(ctx context.Context, call *Call) error {
 	// Create the request URL
-	u, err := url.Parse(path)
+	u, err := url.Parse("/" + call.Endpoint)
 	if err != nil {
 		return err
 	}
 
 	u = c.baseURL.ResolveReference(u)
 
-	// Add query parameters if any
-	if query != nil {
-		u.RawQuery = query.Encode()
+	// GET params are sent as query parameters, anything else as the JSON body
+	var body interface{}
+	if q, ok := call.params.(queryRequest); ok {
+		u.RawQuery = q.query().Encode()
+	} else {
+		body = call.params
 	}
 
-	// Create the request body if any
-	var buf io.ReadWriter
+	// Encode the request body once so it can be replayed on every attempt
+	var payload []byte
 	if body != nil {
-		buf = new(bytes.Buffer)
+		buf := new(bytes.Buffer)
 		if err := json.NewEncoder(buf).Encode(body); err != nil {
 			return err
 		}
+		payload = buf.Bytes()
+	}
+
+	// Requests carrying an idempotency key send it as a header
+	idempotencyKey := ""
+	if r, ok := body.(idempotentRequest); ok {
+		idempotencyKey = r.idempotencyKey()
+	}
+
+	// Only retry requests that cannot have side effects when repeated
+	attempts := 1
+	if (call.Method == http.MethodGet || idempotencyKey != "") && c.retry.MaxAttempts > 1 {
+		attempts = c.retry.MaxAttempts
+	}
+
+	for attempt := 1; ; attempt++ {
+		call.Attempts = attempt
+		req, err := c.newRequest(ctx, call, u.String(), payload, idempotencyKey)
+		if err != nil {
+			return err
+		}
+
+		// Wait for the client's rate limits and a free request slot
+		release, err := c.acquire(ctx, call.Endpoint)
+		if err != nil {
+			return err
+		}
+
+		start := time.Now()
+		resp, err := c.client.Do(req)
+
+		// Hold back every caller for as long as the API asks, within reason.
+		// A longer wait is returned to the caller as ErrRateLimited instead.
+		var wait time.Duration
+		tooLong := false
+		if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+			now := c.now()
+			if d := retryAfter(resp.Header, now); d > c.retry.maxRetryAfter() {
+				tooLong = true
+			} else if d > 0 {
+				c.pause(call.Endpoint, now.Add(d))
+				wait = d
+			}
+		}
+
+		retry := attempt < attempts && !tooLong && ctx.Err() == nil && c.retry.shouldRetry(resp, err)
+		if retry {
+			wait = max(wait, c.retry.backoff(attempt))
+			if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+				// Waiting would outlive the context; return this attempt's result instead
+				retry = false
+			}
+		}
+		if retry {
+			c.logAttempt(ctx, attemptLog{call: call, attempt: attempt, req: req, payload: payload, resp: resp, err: err, elapsed: time.Since(start), retrying: true})
+			if resp != nil {
+				// Drain the body so the connection can be reused
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			release()
+			if c.metrics != nil {
+				c.metrics.IncRetry(call.Endpoint)
+			}
+			if err := sleep(ctx, wait); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			release()
+			c.logAttempt(ctx, attemptLog{call: call, attempt: attempt, req: req, payload: payload, err: err, elapsed: time.Since(start)})
+			return err
+		}
+
+		call.StatusCode = resp.StatusCode
+		call.ResponseHeader = resp.Header
+		if id := requestID(resp.Header); id != "" {
+			call.RequestID = id
+		}
+		body, err := c.parseResponse(resp, call.Response)
+		release()
+		c.logAttempt(ctx, attemptLog{call: call, attempt: attempt, req: req, payload: payload, resp: resp, respBody: body, err: err, elapsed: time.Since(start)})
+		return err
+	}
+}
+
+// newRequest builds the HTTP request for a single attempt
+func (c *Client) newRequest(ctx context.Context, call *Call, rawURL string, payload []byte, idempotencyKey string) (*http.Request, error) {
+	// Create a fresh body reader for every attempt
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
 	}
 
 	// Create the HTTP request
-	req, err := http.NewRequestWithContext(ctx, method, u.String(), buf)
+	req, err := http.NewRequestWithContext(ctx, call.Method, rawURL, body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Set headers
@@ -218,28 +466,39 @@ func (c *Client) sendRequestWithQuery(ctx context.Context, method, path string,
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("x-api-key", c.apiKey)
 	req.Header.Set("x-api-secret", c.apiSecret)
+	if idempotencyKey != "" {
+		req.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+	}
+	for name, values := range call.Header {
+		req.Header[name] = values
+	}
+
+	return req, nil
+}
 
-	// Send the request
-	resp, err := c.client.Do(req)
+// parseResponse decodes an API response into v, or returns the API error it
+// carries. It returns the response body for logging.
+func (c *Client) parseResponse(resp *http.Response, v interface{}) ([]byte, error) {
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		if resp.StatusCode >= 400 {
+			return nil, fmt.Errorf("HTTP error: %d - failed to read error response: %w", resp.StatusCode, err)
+		}
+		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
-	defer resp.Body.Close()
 
 	// Parse the response
 	if resp.StatusCode >= 400 {
-		var apiErr APIError
-		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil {
-			return fmt.Errorf("HTTP error: %d - failed to parse error response", resp.StatusCode)
-		}
-		return &apiErr
+		return body, newAPIError(resp, body)
 	}
 
 	if v != nil {
-		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
-			return err
+		if err := json.Unmarshal(body, v); err != nil {
+			return body, err
 		}
 	}
 
-	return nil
-}
\ No newline at end of file
+	return body, nil
+}
@@ -0,0 +1,198 @@
+package sagapay_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/halfindex/sagapay-go-sdk"
+	"github.com/halfindex/sagapay-go-sdk/sagapaytest"
+)
+
+// newTestClient returns a client for the fake server that retries quickly
+// and reports the attempts of its last call
+func newTestClient(t *testing.T, srv *sagapaytest.Server) (*sagapay.Client, *int) {
+	t.Helper()
+	attempts := new(int)
+	config := srv.ClientConfig()
+	config.RetryPolicy = &sagapay.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+	config.Middleware = []sagapay.Middleware{func(next sagapay.Doer) sagapay.Doer {
+		return sagapay.DoerFunc(func(ctx context.Context, call *sagapay.Call) error {
+			err := next.Do(ctx, call)
+			*attempts = call.Attempts
+			return err
+		})
+	}}
+	client, err := sagapay.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, attempts
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		failures []int
+		attempts int
+		wantErr  error
+	}{
+		{"GET recovers", "/check-transaction-status", []int{503, 502}, 3, nil},
+		{"GET gives up", "/check-transaction-status", []int{503, 503, 503}, 3, sagapay.ErrServer},
+		{"GET client error", "/check-transaction-status", []int{404}, 1, sagapay.ErrNotFound},
+		{"POST with key recovers", "/create-deposit", []int{500}, 2, nil},
+		{"POST client error", "/create-deposit", []int{403}, 1, sagapay.ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := sagapaytest.NewServer(sagapaytest.Config{})
+			defer srv.Close()
+			client, attempts := newTestClient(t, srv)
+			for _, code := range tt.failures {
+				srv.FailNext(tt.endpoint, code)
+			}
+
+			var err error
+			if tt.endpoint == "/create-deposit" {
+				_, err = client.CreateDeposit(context.Background(), depositParams(""))
+			} else {
+				_, err = client.CheckTransactionStatus(context.Background(), "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", sagapay.TransactionTypeDeposit)
+			}
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if *attempts != tt.attempts {
+				t.Errorf("%d attempts, want %d", *attempts, tt.attempts)
+			}
+		})
+	}
+}
+
+func depositParams(key string) sagapay.CreateDepositParams {
+	return sagapay.CreateDepositParams{
+		NetworkType:     sagapay.NetworkTypeBEP20,
+		ContractAddress: sagapay.NativeContractAddress,
+		Amount:          "10",
+		IPNUrl:          "https://example.com/ipn",
+		IdempotencyKey:  key,
+	}
+}
+
+func TestClientRetryRespectsContext(t *testing.T) {
+	srv := sagapaytest.NewServer(sagapaytest.Config{})
+	defer srv.Close()
+	config := srv.ClientConfig()
+	config.RetryPolicy = &sagapay.RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour}
+	client, err := sagapay.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.FailNext("/check-transaction-status", http.StatusServiceUnavailable)
+
+	// The backoff would outlive the deadline, so the 503 is returned at once
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err = client.CheckTransactionStatus(ctx, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", sagapay.TransactionTypeDeposit)
+	if !errors.Is(err, sagapay.ErrServer) {
+		t.Errorf("err = %v, want ErrServer", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("returned after %s, want at once", elapsed)
+	}
+}
+
+func TestIdempotencyKeyOnFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		failures []int
+	}{
+		{"given key, client error", "order-1", []int{400}},
+		{"given key, retries exhausted", "order-2", []int{503, 503, 503}},
+		{"generated key, client error", "", []int{422}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := sagapaytest.NewServer(sagapaytest.Config{})
+			defer srv.Close()
+			client, _ := newTestClient(t, srv)
+			for _, code := range tt.failures {
+				srv.FailNext("/create-deposit", code)
+			}
+
+			_, err := client.CreateDeposit(context.Background(), depositParams(tt.key))
+			var reqErr *sagapay.RequestError
+			if !errors.As(err, &reqErr) {
+				t.Fatalf("err = %v, want a *RequestError", err)
+			}
+			key := sagapay.IdempotencyKeyOf(err)
+			if key == "" || tt.key != "" && key != tt.key {
+				t.Fatalf("IdempotencyKeyOf = %q, want %q", key, tt.key)
+			}
+			var apiErr *sagapay.APIError
+			if !errors.As(err, &apiErr) {
+				t.Errorf("err = %v, want it to unwrap to an *APIError", err)
+			}
+
+			// Resending with the returned key succeeds and is answered with it
+			resp, err := client.CreateDeposit(context.Background(), depositParams(key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.IdempotencyKey != key {
+				t.Errorf("IdempotencyKey = %q, want %q", resp.IdempotencyKey, key)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeyReplaysConcurrentPOSTs(t *testing.T) {
+	srv := sagapaytest.NewServer(sagapaytest.Config{})
+	defer srv.Close()
+	client, err := sagapay.NewClient(srv.ClientConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addresses := make([]string, 10)
+	errs := make([]error, len(addresses))
+	var wg sync.WaitGroup
+	for i := range addresses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.CreateDeposit(context.Background(), depositParams("order-1"))
+			if err == nil {
+				addresses[i] = resp.Address
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+
+	for i, address := range addresses {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if address != addresses[0] {
+			t.Errorf("request %d got address %s, want %s: the key created two deposits", i, address, addresses[0])
+		}
+	}
+
+	// A different key creates a different deposit
+	resp, err := client.CreateDeposit(context.Background(), depositParams("order-2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Address == addresses[0] {
+		t.Error("a new idempotency key replayed the old deposit")
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/halfindex/sagapay-go-sdk"
+	"github.com/halfindex/sagapay-go-sdk/qr"
+)
+
+// requestTimeout bounds every API command
+const requestTimeout = 60 * time.Second
+
+// commandContext returns a context cancelled on interrupt or after the request timeout
+func commandContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+func (c *command) depositCreate(args []string) error {
+	fs := c.newFlagSet("deposit create")
+	common := addCommonFlags(fs)
+	var params sagapay.CreateDepositParams
+	var network, addressType string
+	fs.StringVar(&network, "network", "", "network type: ERC20, BEP20, TRC20, POLYGON or SOLANA")
+	fs.StringVar(&params.ContractAddress, "contract", sagapay.NativeContractAddress, "token contract address, or 0 for the native coin")
+	fs.StringVar(&params.Amount, "amount", "", "expected deposit amount")
+	fs.StringVar(&params.IPNUrl, "ipn-url", "", "URL for webhook notifications")
+	fs.StringVar(&params.UDF, "udf", "", "user-defined field, e.g. an order ID")
+	fs.StringVar(&addressType, "type", "", "address type: TEMPORARY or PERMANENT")
+	fs.StringVar(&params.IdempotencyKey, "idempotency-key", "", "idempotency key (generated if empty)")
+	showQR := fs.Bool("qr", false, "print the deposit address as a QR code after the table")
+	var qrOpts qrFlags
+	fs.StringVar(&qrOpts.level, "qr-level", "M", "QR error correction level: L, M, Q or H")
+	fs.BoolVar(&qrOpts.invert, "qr-invert", false, "swap dark and light in the QR code")
+	qrOpts.quietZone = qr.DefaultQuietZone
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	params.NetworkType = sagapay.NetworkType(network)
+	params.Type = sagapay.AddressType(addressType)
+
+	client, err := common.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	resp, err := client.CreateDeposit(ctx, params)
+	if err != nil {
+		c.printRetryKey(err, "deposit")
+		return err
+	}
+
+	err = printer{c.stdout, common.output}.print(struct {
+		*sagapay.DepositResponse
+		IdempotencyKey string `json:"idempotencyKey"`
+	}{resp, resp.IdempotencyKey}, []field{
+		{"ID", resp.ID},
+		{"Address", resp.Address},
+		{"Amount", resp.Amount},
+		{"Status", string(resp.Status)},
+		{"Expires At", resp.ExpiresAt.Format(time.RFC3339)},
+		{"Idempotency Key", resp.IdempotencyKey},
+	})
+	if err != nil || !*showQR || common.output == "json" {
+		return err
+	}
+
+	code, err := qrOpts.code(resp.Address)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(c.stdout, "\n"+code.Terminal(qrOpts.quietZone, qrOpts.invert))
+	return err
+}
+
+func (c *command) withdrawCreate(args []string) error {
+	fs := c.newFlagSet("withdraw create")
+	common := addCommonFlags(fs)
+	var params sagapay.CreateWithdrawalParams
+	var network string
+	fs.StringVar(&network, "network", "", "network type: ERC20, BEP20, TRC20, POLYGON or SOLANA")
+	fs.StringVar(&params.ContractAddress, "contract", sagapay.NativeContractAddress, "token contract address, or 0 for the native coin")
+	fs.StringVar(&params.Address, "address", "", "destination address")
+	fs.StringVar(&params.Amount, "amount", "", "amount to withdraw")
+	fs.StringVar(&params.IPNUrl, "ipn-url", "", "URL for webhook notifications")
+	fs.StringVar(&params.UDF, "udf", "", "user-defined field")
+	fs.StringVar(&params.IdempotencyKey, "idempotency-key", "", "idempotency key; reuse it to retry safely (generated if empty)")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	params.NetworkType = sagapay.NetworkType(network)
+
+	client, err := common.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	resp, err := client.CreateWithdrawal(ctx, params)
+	if err != nil {
+		c.printRetryKey(err, "withdrawal")
+		return err
+	}
+
+	return printer{c.stdout, common.output}.print(struct {
+		*sagapay.WithdrawalResponse
+		IdempotencyKey string `json:"idempotencyKey"`
+	}{resp, resp.IdempotencyKey}, []field{
+		{"ID", resp.ID},
+		{"Status", string(resp.Status)},
+		{"Fee", resp.Fee},
+		{"Idempotency Key", resp.IdempotencyKey},
+	})
+}
+
+// printRetryKey prints the idempotency key a failed request was sent with,
+// so the operator can retry it without creating a duplicate
+func (c *command) printRetryKey(err error, what string) {
+	if key := sagapay.IdempotencyKeyOf(err); key != "" {
+		fmt.Fprintf(c.stderr, "Idempotency key: %s\nRetry with --idempotency-key %s to avoid a duplicate %s.\n", key, key, what)
+	}
+}
+
+func (c *command) txStatus(args []string) error {
+	fs := c.newFlagSet("tx status")
+	common := addCommonFlags(fs)
+	txType := fs.String("type", string(sagapay.TransactionTypeDeposit), "transaction type: deposit or withdrawal")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("%w: expected \"tx status <address>\"", errUsage)
+	}
+	if *txType != string(sagapay.TransactionTypeDeposit) && *txType != string(sagapay.TransactionTypeWithdrawal) {
+		return fmt.Errorf("%w: --type must be deposit or withdrawal, got %q", errUsage, *txType)
+	}
+
+	client, err := common.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	resp, err := client.CheckTransactionStatus(ctx, positional[0], sagapay.TransactionType(*txType))
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, len(resp.Transactions))
+	for i, tx := range resp.Transactions {
+		rows[i] = []string{
+			tx.ID,
+			string(tx.TransactionType),
+			string(tx.Status),
+			tx.Amount,
+			tx.Token.Symbol,
+			tx.TxHash,
+			tx.UpdatedAt.Format(time.RFC3339),
+		}
+	}
+	return printer{c.stdout, common.output}.printRows(resp,
+		[]string{"ID", "TYPE", "STATUS", "AMOUNT", "TOKEN", "TX HASH", "UPDATED"}, rows)
+}
+
+func (c *command) balance(args []string) error {
+	fs := c.newFlagSet("balance")
+	common := addCommonFlags(fs)
+	network := fs.String("network", "", "network type: ERC20, BEP20, TRC20, POLYGON or SOLANA")
+	contract := fs.String("contract", "", "token contract address, or 0 for the native coin")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("%w: expected \"balance <address>\"", errUsage)
+	}
+	if *network == "" {
+		return fmt.Errorf("%w: --network is required", errUsage)
+	}
+
+	client, err := common.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	resp, err := client.FetchWalletBalance(ctx, positional[0], sagapay.NetworkType(*network), *contract)
+	if err != nil {
+		return err
+	}
+
+	return printer{c.stdout, common.output}.print(resp, []field{
+		{"Address", resp.Address},
+		{"Network", string(resp.NetworkType)},
+		{"Token", fmt.Sprintf("%s (%s)", resp.Token.Symbol, resp.Token.Name)},
+		{"Decimals", strconv.Itoa(resp.Token.Decimals)},
+		{"Balance", resp.Balance.Formatted},
+		{"Raw", resp.Balance.Raw},
+	})
+}
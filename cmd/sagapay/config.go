@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/halfindex/sagapay-go-sdk"
+)
+
+// Environment variables
+const (
+	envAPIKey    = "SAGAPAY_API_KEY"
+	envAPISecret = "SAGAPAY_API_SECRET"
+	envBaseURL   = "SAGAPAY_BASE_URL"
+	envProfile   = "SAGAPAY_PROFILE"
+	envConfig    = "SAGAPAY_CONFIG"
+)
+
+// profile holds the credentials stored in the profile file
+type profile struct {
+	APIKey    string `json:"apiKey"`
+	APISecret string `json:"apiSecret"`
+	BaseURL   string `json:"baseUrl,omitempty"`
+}
+
+// commonFlags are accepted by every subcommand
+type commonFlags struct {
+	profile string
+	config  string
+	output  string
+	baseURL string
+}
+
+// addCommonFlags registers the common flags on a flag set
+func addCommonFlags(fs *flag.FlagSet) *commonFlags {
+	f := &commonFlags{}
+	fs.StringVar(&f.profile, "profile", os.Getenv(envProfile), "profile to load credentials from")
+	fs.StringVar(&f.config, "config", os.Getenv(envConfig), "path to the profile file (default ~/.config/sagapay/profiles.json)")
+	fs.StringVar(&f.output, "output", "table", "output format: table or json")
+	fs.StringVar(&f.baseURL, "base-url", "", "API base URL")
+	return f
+}
+
+// validate checks the common flag values
+func (f *commonFlags) validate() error {
+	if f.output != "table" && f.output != "json" {
+		return fmt.Errorf("%w: --output must be table or json, got %q", errUsage, f.output)
+	}
+	return nil
+}
+
+// credentials resolves the API credentials. Environment variables override
+// the profile, and --base-url overrides both.
+func (f *commonFlags) credentials() (profile, error) {
+	var creds profile
+
+	p, err := f.loadProfile()
+	if err != nil {
+		return creds, err
+	}
+	if p != nil {
+		creds = *p
+	}
+
+	if v := os.Getenv(envAPIKey); v != "" {
+		creds.APIKey = v
+	}
+	if v := os.Getenv(envAPISecret); v != "" {
+		creds.APISecret = v
+	}
+	if v := os.Getenv(envBaseURL); v != "" {
+		creds.BaseURL = v
+	}
+	if f.baseURL != "" {
+		creds.BaseURL = f.baseURL
+	}
+
+	return creds, nil
+}
+
+// client creates an API client from the resolved credentials
+func (f *commonFlags) client() (*sagapay.Client, error) {
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+
+	creds, err := f.credentials()
+	if err != nil {
+		return nil, err
+	}
+	if creds.APIKey == "" || creds.APISecret == "" {
+		return nil, fmt.Errorf("%w: API credentials are required; set %s and %s or use --profile", errUsage, envAPIKey, envAPISecret)
+	}
+
+	return sagapay.NewClient(sagapay.Config{
+		BaseURL:   creds.BaseURL,
+		APIKey:    creds.APIKey,
+		APISecret: creds.APISecret,
+	})
+}
+
+// loadProfile reads the selected profile. It returns nil if no profile file
+// exists and no profile was explicitly requested.
+func (f *commonFlags) loadProfile() (*profile, error) {
+	path := f.config
+	if path == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, nil
+		}
+		path = filepath.Join(dir, "sagapay", "profiles.json")
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && f.profile == "" && f.config == "" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile file: %w", err)
+	}
+
+	var profiles map[string]profile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse profile file %s: %w", path, err)
+	}
+
+	name := f.profile
+	if name == "" {
+		name = "default"
+	}
+	p, ok := profiles[name]
+	if !ok {
+		if f.profile == "" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w: profile %q not found in %s", errUsage, name, path)
+	}
+	return &p, nil
+}
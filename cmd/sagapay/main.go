@@ -0,0 +1,190 @@
+// Command sagapay is a command-line client for the SagaPay API.
+//
+// Usage:
+//
+//	sagapay deposit create --network BEP20 --contract 0 --amount 1.5 --ipn-url https://example.com/webhook
+//	sagapay withdraw create --network ERC20 --contract 0x... --address 0x... --amount 10 --ipn-url https://example.com/webhook
+//	sagapay tx status <address> --type deposit|withdrawal
+//	sagapay balance <address> --network ERC20 --contract 0x...
+//	sagapay webhook verify --secret <secret> --signature <signature> < body.json
+//	sagapay webhook listen --addr :8080
+//	sagapay payout batch payouts.csv --batch-id affiliates-2026-10 --ipn-url https://example.com/webhook --yes
+//	sagapay reconcile expected.csv --tolerance 0.01
+//	sagapay qr <text> --level M --format terminal|png|svg
+//
+// Credentials are read from the SAGAPAY_API_KEY and SAGAPAY_API_SECRET
+// environment variables, or from a profile in ~/.config/sagapay/profiles.json
+// selected with --profile or SAGAPAY_PROFILE. Output is a table by default;
+// pass --output json for JSON.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/halfindex/sagapay-go-sdk"
+)
+
+// Exit codes
+const (
+	exitOK                 = 0
+	exitError              = 1
+	exitUsage              = 2
+	exitValidation         = 3
+	exitAPI                = 4
+	exitVerificationFailed = 5
+)
+
+// errUsage marks errors caused by invalid command-line usage
+var errUsage = errors.New("usage error")
+
+const usage = `Usage: sagapay <command> [arguments] [flags]
+
+Commands:
+  deposit create    Create a deposit address
+  withdraw create   Create a withdrawal
+  tx status         Check the transactions of an address
+  balance           Fetch the balance of an address
+  webhook verify    Verify a webhook body read from stdin
+  webhook listen    Print incoming webhooks
+  payout batch      Validate and submit withdrawals from a CSV or JSONL file
+  reconcile         Match expected payments from a CSV or JSONL file against transactions
+  qr                Encode text, such as an address or payment URI, as a QR code
+
+Common flags:
+  --profile name    Profile to load credentials from (env SAGAPAY_PROFILE)
+  --output format   Output format: table or json (default table)
+  --base-url url    API base URL (env SAGAPAY_BASE_URL)
+
+Run "sagapay <command> -h" for the flags of a command.
+
+Exit codes:
+  0 success, 1 error, 2 usage error, 3 validation error,
+  4 API error, 5 webhook verification failed
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command line and returns the process exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(stderr, usage)
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	cmd := &command{stdin: stdin, stdout: stdout, stderr: stderr}
+	err := cmd.dispatch(args)
+	if err == nil {
+		return exitOK
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+
+	fmt.Fprintf(stderr, "sagapay: %v\n", err)
+	return exitCode(err)
+}
+
+// exitCode maps an error to the process exit code
+func exitCode(err error) int {
+	var apiErr *sagapay.APIError
+	switch {
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.Is(err, sagapay.ErrValidation):
+		return exitValidation
+	case errors.As(err, &apiErr):
+		return exitAPI
+	case errors.Is(err, errVerificationFailed):
+		return exitVerificationFailed
+	default:
+		return exitError
+	}
+}
+
+// command holds the I/O streams shared by every subcommand
+type command struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// dispatch runs the subcommand named by the first arguments
+func (c *command) dispatch(args []string) error {
+	switch args[0] {
+	case "deposit":
+		if len(args) < 2 || args[1] != "create" {
+			return fmt.Errorf("%w: expected \"deposit create\"", errUsage)
+		}
+		return c.depositCreate(args[2:])
+	case "withdraw":
+		if len(args) < 2 || args[1] != "create" {
+			return fmt.Errorf("%w: expected \"withdraw create\"", errUsage)
+		}
+		return c.withdrawCreate(args[2:])
+	case "tx":
+		if len(args) < 2 || args[1] != "status" {
+			return fmt.Errorf("%w: expected \"tx status\"", errUsage)
+		}
+		return c.txStatus(args[2:])
+	case "balance":
+		return c.balance(args[1:])
+	case "webhook":
+		if len(args) < 2 {
+			return fmt.Errorf("%w: expected \"webhook verify\" or \"webhook listen\"", errUsage)
+		}
+		switch args[1] {
+		case "verify":
+			return c.webhookVerify(args[2:])
+		case "listen":
+			return c.webhookListen(args[2:])
+		}
+		return fmt.Errorf("%w: unknown webhook command %q", errUsage, args[1])
+	case "payout":
+		if len(args) < 2 || args[1] != "batch" {
+			return fmt.Errorf("%w: expected \"payout batch\"", errUsage)
+		}
+		return c.payoutBatch(args[2:])
+	case "reconcile":
+		return c.reconcile(args[1:])
+	case "qr":
+		return c.qr(args[1:])
+	default:
+		return fmt.Errorf("%w: unknown command %q", errUsage, args[0])
+	}
+}
+
+// newFlagSet creates a flag set for a subcommand that reports errors instead of exiting
+func (c *command) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("sagapay "+name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	return fs
+}
+
+// parseFlags parses flags that may be interleaved with positional arguments
+// and returns the positional arguments
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: %v", errUsage, err)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/halfindex/sagapay-go-sdk/sagapaytest"
+)
+
+// runCLI runs the command line and returns the exit code, stdout and stderr
+func runCLI(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+// useServer points the CLI at a fake server through the environment
+func useServer(t *testing.T) *sagapaytest.Server {
+	t.Helper()
+	srv := sagapaytest.NewServer(sagapaytest.Config{})
+	t.Cleanup(srv.Close)
+	config := srv.ClientConfig()
+	t.Setenv(envAPIKey, config.APIKey)
+	t.Setenv(envAPISecret, config.APISecret)
+	t.Setenv(envBaseURL, config.BaseURL)
+	isolateConfig(t)
+	return srv
+}
+
+// signature returns the webhook signature of body under secret
+func signature(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// isolateConfig hides any profile file of the user running the tests
+func isolateConfig(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("AppData", dir)
+	t.Setenv(envProfile, "")
+	t.Setenv(envConfig, "")
+}
+
+func TestParseFlags(t *testing.T) {
+	fs := (&command{stderr: new(bytes.Buffer)}).newFlagSet("test")
+	network := fs.String("network", "", "")
+	yes := fs.Bool("yes", false, "")
+
+	positional, err := parseFlags(fs, []string{"a.csv", "--network", "BEP20", "b.csv", "--yes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.csv", "b.csv"}; !reflect.DeepEqual(positional, want) {
+		t.Errorf("positional = %q, want %q", positional, want)
+	}
+	if *network != "BEP20" || !*yes {
+		t.Errorf("network = %q, yes = %v", *network, *yes)
+	}
+
+	if _, err := parseFlags(fs, []string{"--unknown"}); !errors.Is(err, errUsage) {
+		t.Errorf("unknown flag: err = %v, want a usage error", err)
+	}
+}
+
+func TestRunUsage(t *testing.T) {
+	useServer(t)
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"no arguments", nil, exitUsage},
+		{"help", []string{"help"}, exitOK},
+		{"command help", []string{"deposit", "create", "-h"}, exitOK},
+		{"unknown command", []string{"refund"}, exitUsage},
+		{"missing subcommand", []string{"deposit"}, exitUsage},
+		{"unknown flag", []string{"balance", "0xabc", "--bogus"}, exitUsage},
+		{"bad output", []string{"balance", "0xabc", "--network", "ERC20", "--output", "yaml"}, exitUsage},
+		{"missing address", []string{"tx", "status"}, exitUsage},
+		{"bad type", []string{"tx", "status", "0xabc", "--type", "refund"}, exitUsage},
+		{"missing network", []string{"balance", "0xabc"}, exitUsage},
+		{"missing signature", []string{"webhook", "verify", "--secret", "s"}, exitUsage},
+		{"invalid params", []string{"deposit", "create", "--network", "BEP20", "--amount", "-1", "--ipn-url", "https://example.com"}, exitValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _, stderr := runCLI(t, "", tt.args...); code != tt.want {
+				t.Errorf("exit code = %d, want %d; stderr:\n%s", code, tt.want, stderr)
+			}
+		})
+	}
+}
+
+func TestRunMissingCredentials(t *testing.T) {
+	t.Setenv(envAPIKey, "")
+	t.Setenv(envAPISecret, "")
+	isolateConfig(t)
+
+	code, _, stderr := runCLI(t, "", "balance", "0xabc", "--network", "ERC20")
+	if code != exitUsage || !strings.Contains(stderr, envAPIKey) {
+		t.Errorf("exit code = %d, stderr = %q", code, stderr)
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	os.WriteFile(path, []byte(`{
+		"default": {"apiKey": "default-key", "apiSecret": "default-secret"},
+		"live": {"apiKey": "live-key", "apiSecret": "live-secret", "baseUrl": "https://live.example.com"}
+	}`), 0o600)
+
+	tests := []struct {
+		name    string
+		flags   commonFlags
+		env     map[string]string
+		want    profile
+		wantErr bool
+	}{
+		{"default profile", commonFlags{config: path}, nil, profile{"default-key", "default-secret", ""}, false},
+		{"named profile", commonFlags{config: path, profile: "live"}, nil, profile{"live-key", "live-secret", "https://live.example.com"}, false},
+		{"environment overrides profile", commonFlags{config: path, profile: "live"}, map[string]string{envAPIKey: "env-key", envBaseURL: "https://env.example.com"}, profile{"env-key", "live-secret", "https://env.example.com"}, false},
+		{"flag overrides environment", commonFlags{config: path, baseURL: "https://flag.example.com"}, map[string]string{envBaseURL: "https://env.example.com"}, profile{"default-key", "default-secret", "https://flag.example.com"}, false},
+		{"unknown profile", commonFlags{config: path, profile: "staging"}, nil, profile{}, true},
+		{"missing file", commonFlags{config: path + ".missing"}, nil, profile{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{envAPIKey, envAPISecret, envBaseURL} {
+				t.Setenv(name, tt.env[name])
+			}
+			got, err := tt.flags.credentials()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("credentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("credentials() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDepositCreate(t *testing.T) {
+	srv := useServer(t)
+	code, stdout, stderr := runCLI(t, "", "deposit", "create",
+		"--network", "BEP20", "--amount", "1.5", "--ipn-url", "https://example.com/webhook",
+		"--idempotency-key", "order-1", "--output", "json")
+	if code != exitOK {
+		t.Fatalf("exit code = %d; stderr:\n%s", code, stderr)
+	}
+
+	var resp struct {
+		Address        string `json:"address"`
+		IdempotencyKey string `json:"idempotencyKey"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &resp); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, stdout)
+	}
+	if resp.IdempotencyKey != "order-1" {
+		t.Errorf("idempotencyKey = %q, want order-1", resp.IdempotencyKey)
+	}
+	deposit, ok := srv.Deposit(resp.Address)
+	if !ok || deposit.Amount != "1.5" {
+		t.Errorf("server deposit = %+v, %v", deposit, ok)
+	}
+}
+
+func TestDepositCreateAPIError(t *testing.T) {
+	srv := useServer(t)
+	srv.FailNext("/create-deposit", http.StatusBadRequest)
+
+	code, _, stderr := runCLI(t, "", "deposit", "create",
+		"--network", "BEP20", "--amount", "1.5", "--ipn-url", "https://example.com/webhook",
+		"--idempotency-key", "order-1")
+	if code != exitAPI {
+		t.Errorf("exit code = %d, want %d", code, exitAPI)
+	}
+	if !strings.Contains(stderr, "--idempotency-key order-1") {
+		t.Errorf("stderr does not show the retry key:\n%s", stderr)
+	}
+}
+
+func TestWebhookVerify(t *testing.T) {
+	useServer(t)
+	body := `{"id":"tx-1","type":"deposit","status":"COMPLETED","amount":"10"}`
+	tests := []struct {
+		name   string
+		secret string
+		want   int
+	}{
+		{"second secret", "old", exitOK},
+		{"unknown secret", "other", exitVerificationFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := runCLI(t, body, "webhook", "verify",
+				"--secret", "new", "--secret", "old", "--signature", signature(tt.secret, body))
+			if code != tt.want {
+				t.Fatalf("exit code = %d, want %d; stderr:\n%s", code, tt.want, stderr)
+			}
+			if tt.want == exitOK && !strings.Contains(stdout, "secret #1") {
+				t.Errorf("output does not name the matching secret:\n%s", stdout)
+			}
+		})
+	}
+}
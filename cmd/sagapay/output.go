@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// field is a labelled value printed in table output
+type field struct {
+	label string
+	value string
+}
+
+// printer writes command results as a table or as JSON
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+// print writes v as indented JSON, or the given fields as a two-column table
+func (p printer) print(v any, fields []field) error {
+	if p.format == "json" {
+		return p.json(v)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	for _, f := range fields {
+		fmt.Fprintf(tw, "%s\t%s\n", f.label, f.value)
+	}
+	return tw.Flush()
+}
+
+// printRows writes v as indented JSON, or the given rows as a table with a header
+func (p printer) printRows(v any, header []string, rows [][]string) error {
+	if p.format == "json" {
+		return p.json(v)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// json writes v as indented JSON
+func (p printer) json(v any) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/halfindex/sagapay-go-sdk"
+)
+
+func (c *command) payoutBatch(args []string) error {
+	fs := c.newFlagSet("payout batch")
+	common := addCommonFlags(fs)
+	var config sagapay.BatchPayoutConfig
+	fs.StringVar(&config.BatchID, "batch-id", "", "name of the batch, part of every idempotency key (required)")
+	fs.StringVar(&config.IPNUrl, "ipn-url", "", "URL for webhook notifications (required)")
+	fs.StringVar(&config.JournalPath, "journal", "", "progress journal (default <file>.journal)")
+	fs.IntVar(&config.Concurrency, "concurrency", sagapay.DefaultBatchConcurrency, "withdrawals in flight")
+	format := fs.String("format", "", "input format: csv or jsonl (default from the file extension)")
+	yes := fs.Bool("yes", false, "submit the withdrawals; without it the batch is only validated")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("%w: expected \"payout batch <file>\"", errUsage)
+	}
+	if err := common.validate(); err != nil {
+		return err
+	}
+	path := positional[0]
+	if config.JournalPath == "" {
+		config.JournalPath = path + ".journal"
+	}
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".jsonl", ".ndjson":
+			*format = "jsonl"
+		default:
+			*format = "csv"
+		}
+	}
+	if *format != "csv" && *format != "jsonl" {
+		return fmt.Errorf("%w: --format must be csv or jsonl, got %q", errUsage, *format)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	var rows []sagapay.PayoutRow
+	if *format == "jsonl" {
+		rows, err = sagapay.ReadPayoutJSONL(file)
+	} else {
+		rows, err = sagapay.ReadPayoutCSV(file)
+	}
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	out := printer{c.stdout, common.output}
+	if !*yes {
+		// Validate only, so the totals can be checked before paying
+		batch, err := sagapay.NewBatchPayout(nil, rows, config)
+		if err != nil {
+			return err
+		}
+		if err := c.printTotals(out, batch); err != nil {
+			return err
+		}
+		if common.output != "json" {
+			fmt.Fprintf(c.stderr, "\n%d withdrawals validated. Run again with --yes to submit them.\n", len(rows))
+		}
+		return nil
+	}
+
+	config.OnResult = func(result sagapay.BatchPayoutResult, done, total int) {
+		state := "submitted " + withdrawalID(result.Withdrawal)
+		switch {
+		case result.Err != nil:
+			state = "FAILED: " + result.Err.Error()
+		case result.Resumed:
+			state = "already submitted " + withdrawalID(result.Withdrawal)
+		}
+		fmt.Fprintf(c.stderr, "[%d/%d] line %d: %s %s to %s: %s\n", done, total,
+			result.Row.Line, result.Row.Amount, result.Row.NetworkType, sagapay.MaskValue(result.Row.Address), state)
+	}
+	client, err := common.client()
+	if err != nil {
+		return err
+	}
+	batch, err := sagapay.NewBatchPayout(client, rows, config)
+	if err != nil {
+		return err
+	}
+
+	// No request timeout: a large batch takes as long as it takes, and an
+	// interrupted one is resumed from the journal
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	results, runErr := batch.Run(ctx)
+
+	type resultJSON struct {
+		sagapay.PayoutRow
+		Line           int    `json:"line"`
+		Status         string `json:"status"`
+		WithdrawalID   string `json:"withdrawalId,omitempty"`
+		IdempotencyKey string `json:"idempotencyKey"`
+		Error          string `json:"error,omitempty"`
+	}
+	resultsJSON := make([]resultJSON, len(results))
+	rowsOut := make([][]string, len(results))
+	for i, result := range results {
+		r := resultJSON{
+			PayoutRow:      result.Row,
+			Line:           result.Row.Line,
+			Status:         "SUBMITTED",
+			WithdrawalID:   withdrawalID(result.Withdrawal),
+			IdempotencyKey: result.IdempotencyKey,
+		}
+		detail := r.WithdrawalID
+		switch {
+		case result.Err != nil:
+			r.Status, r.Error, detail = "FAILED", result.Err.Error(), result.Err.Error()
+		case result.Resumed:
+			r.Status = "RESUMED"
+		}
+		resultsJSON[i] = r
+		rowsOut[i] = []string{strconv.Itoa(result.Row.Line), string(result.Row.NetworkType),
+			result.Row.Address, result.Row.Amount, r.Status, detail}
+	}
+	if err := out.printRows(resultsJSON, []string{"LINE", "NETWORK", "ADDRESS", "AMOUNT", "STATUS", "WITHDRAWAL"}, rowsOut); err != nil {
+		return err
+	}
+
+	if runErr != nil {
+		return runErr
+	}
+	if failed := len(results.Failed()); failed > 0 {
+		return fmt.Errorf("%d of %d withdrawals failed; run the same command again to retry them, journal %s",
+			failed, len(results), config.JournalPath)
+	}
+	return nil
+}
+
+// printTotals prints the per-token totals of a batch
+func (c *command) printTotals(out printer, batch *sagapay.BatchPayout) error {
+	totals := batch.Totals()
+	rows := make([][]string, len(totals))
+	for i, total := range totals {
+		rows[i] = []string{string(total.NetworkType), total.ContractAddress, strconv.Itoa(total.Count), total.Total.String()}
+	}
+	return out.printRows(totals, []string{"NETWORK", "CONTRACT", "COUNT", "TOTAL"}, rows)
+}
+
+// withdrawalID returns the ID of a withdrawal, or "" if there is none
+func withdrawalID(w *sagapay.WithdrawalResponse) string {
+	if w == nil {
+		return ""
+	}
+	return w.ID
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/halfindex/sagapay-go-sdk/qr"
+)
+
+// qrFlags are the rendering options of QR codes
+type qrFlags struct {
+	level     string
+	quietZone int
+	invert    bool
+}
+
+// code encodes text with the chosen error correction level
+func (f *qrFlags) code(text string) (*qr.Code, error) {
+	level, err := qr.ParseLevel(f.level)
+	if err != nil {
+		return nil, fmt.Errorf("%w: --level: %v", errUsage, err)
+	}
+	return qr.Encode(text, level)
+}
+
+func (c *command) qr(args []string) error {
+	fs := c.newFlagSet("qr")
+	var flags qrFlags
+	fs.StringVar(&flags.level, "level", "M", "error correction level: L, M, Q or H")
+	fs.IntVar(&flags.quietZone, "quiet-zone", qr.DefaultQuietZone, "width of the light border in modules")
+	fs.BoolVar(&flags.invert, "invert", false, "swap dark and light, for terminals with light text on a dark background")
+	format := fs.String("format", "terminal", "output format: terminal, png or svg")
+	scale := fs.Int("scale", 8, "pixels per module in PNG output")
+	out := fs.String("o", "", "write to a file instead of stdout")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("%w: expected \"qr <text>\"", errUsage)
+	}
+	if *format != "terminal" && *format != "png" && *format != "svg" {
+		return fmt.Errorf("%w: --format must be terminal, png or svg, got %q", errUsage, *format)
+	}
+	if *scale < 1 {
+		return fmt.Errorf("%w: --scale must be at least 1", errUsage)
+	}
+	if flags.quietZone < 0 {
+		return fmt.Errorf("%w: --quiet-zone must not be negative", errUsage)
+	}
+
+	code, err := flags.code(positional[0])
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = c.stdout
+	var file *os.File
+	if *out != "" {
+		if file, err = os.Create(*out); err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	switch *format {
+	case "png":
+		err = code.WritePNG(w, *scale, flags.quietZone)
+	case "svg":
+		_, err = io.WriteString(w, code.SVG(flags.quietZone))
+	default:
+		_, err = io.WriteString(w, code.Terminal(flags.quietZone, flags.invert))
+	}
+	if err != nil {
+		return err
+	}
+	if file != nil {
+		return file.Close()
+	}
+	return nil
+}
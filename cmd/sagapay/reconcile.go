@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/halfindex/sagapay-go-sdk"
+	"github.com/halfindex/sagapay-go-sdk/reconcile"
+)
+
+func (c *command) reconcile(args []string) error {
+	fs := c.newFlagSet("reconcile")
+	common := addCommonFlags(fs)
+	var config reconcile.Config
+	tolerance := fs.String("tolerance", "0", "largest amount difference that still matches")
+	tolerancePercent := fs.String("tolerance-percent", "0", "tolerance as a percentage of the expected amount")
+	txType := fs.String("type", string(sagapay.TransactionTypeDeposit), "transaction type: deposit or withdrawal")
+	fs.IntVar(&config.Concurrency, "concurrency", sagapay.DefaultBatchConcurrency, "requests in flight")
+	format := fs.String("format", "", "input format: csv or jsonl (default from the file extension)")
+	reportPath := fs.String("report", "", "also write the full report to this file, as CSV or as JSON if it ends in .json")
+	udfsPath := fs.String("udfs", "", "JSON lines file of received webhook payloads, to match payments by UDF")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("%w: expected \"reconcile <file>\"", errUsage)
+	}
+	if err := common.validate(); err != nil {
+		return err
+	}
+	if *txType != string(sagapay.TransactionTypeDeposit) && *txType != string(sagapay.TransactionTypeWithdrawal) {
+		return fmt.Errorf("%w: --type must be deposit or withdrawal, got %q", errUsage, *txType)
+	}
+	config.TransactionType = sagapay.TransactionType(*txType)
+	if config.Tolerance, err = sagapay.ParseAmount(*tolerance); err != nil {
+		return fmt.Errorf("%w: --tolerance: %v", errUsage, err)
+	}
+	if config.TolerancePercent, err = sagapay.ParseAmount(*tolerancePercent); err != nil {
+		return fmt.Errorf("%w: --tolerance-percent: %v", errUsage, err)
+	}
+	path := positional[0]
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".jsonl", ".ndjson":
+			*format = "jsonl"
+		default:
+			*format = "csv"
+		}
+	}
+	if *format != "csv" && *format != "jsonl" {
+		return fmt.Errorf("%w: --format must be csv or jsonl, got %q", errUsage, *format)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	var expected []reconcile.Expected
+	if *format == "jsonl" {
+		expected, err = reconcile.ReadExpectedJSONL(file)
+	} else {
+		expected, err = reconcile.ReadExpectedCSV(file)
+	}
+	file.Close()
+	if err != nil {
+		return err
+	}
+	if *udfsPath != "" {
+		file, err := os.Open(*udfsPath)
+		if err != nil {
+			return err
+		}
+		config.UDFs, err = reconcile.ReadWebhookUDFs(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	client, err := common.client()
+	if err != nil {
+		return err
+	}
+	// No request timeout: the run makes one request per address
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, runErr := reconcile.Run(ctx, client, expected, config)
+	if report == nil {
+		return runErr
+	}
+
+	if *reportPath != "" {
+		if err := writeReport(report, *reportPath); err != nil {
+			return err
+		}
+	}
+	if common.output == "json" {
+		if err := report.WriteJSON(c.stdout); err != nil {
+			return err
+		}
+	} else {
+		// The payments that need a look, then the totals
+		problems := report.Filter(reconcile.StatusAmountMismatch, reconcile.StatusMissing,
+			reconcile.StatusUnexpected, reconcile.StatusError)
+		if len(problems) > 0 {
+			rows := make([][]string, len(problems))
+			for i, result := range problems {
+				rows[i] = resultRow(result)
+			}
+			out := printer{c.stdout, common.output}
+			if err := out.printRows(nil, []string{"STATUS", "UDF", "NETWORK", "ADDRESS", "EXPECTED", "RECEIVED", "TRANSACTION"}, rows); err != nil {
+				return err
+			}
+			fmt.Fprintln(c.stdout)
+		}
+		if err := report.WriteSummary(c.stdout); err != nil {
+			return err
+		}
+	}
+
+	if runErr != nil {
+		return runErr
+	}
+	if failed := len(report.Filter(reconcile.StatusError)); failed > 0 {
+		return fmt.Errorf("%d expected payments could not be checked", failed)
+	}
+	return nil
+}
+
+// resultRow formats a reconciliation result as a table row
+func resultRow(result reconcile.Result) []string {
+	var udf, network, address, expected, received, detail string
+	if e := result.Expected; e != nil {
+		udf, network, address, expected = e.UDF, string(e.NetworkType), e.Address, e.Amount
+	}
+	if tx := result.Transaction; tx != nil {
+		if result.Expected == nil {
+			network, address = string(tx.NetworkType), tx.Address
+		}
+		received = tx.Amount
+		detail = tx.ID + " " + string(tx.Status)
+	}
+	if result.Err != nil {
+		detail = result.Err.Error()
+	}
+	return []string{string(result.Status), udf, network, address, expected, received, detail}
+}
+
+// writeReport writes the full report to path, as JSON if it ends in .json
+// and as CSV otherwise
+func writeReport(report *reconcile.Report, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = report.WriteJSON(file)
+	} else {
+		err = report.WriteCSV(file)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
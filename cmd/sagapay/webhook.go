@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/halfindex/sagapay-go-sdk"
+)
+
+// errVerificationFailed is returned when a webhook cannot be verified
+var errVerificationFailed = errors.New("webhook verification failed")
+
+// stringsFlag is a repeatable string flag
+type stringsFlag []string
+
+func (f *stringsFlag) String() string     { return strings.Join(*f, ",") }
+func (f *stringsFlag) Set(v string) error { *f = append(*f, v); return nil }
+
+// webhookSecrets returns the secrets given with --secret, falling back to the API secret
+func webhookSecrets(secrets stringsFlag, common *commonFlags) ([]string, error) {
+	if len(secrets) > 0 {
+		return secrets, nil
+	}
+	creds, err := common.credentials()
+	if err != nil {
+		return nil, err
+	}
+	if creds.APISecret == "" {
+		return nil, fmt.Errorf("%w: --secret is required; or set %s or use --profile", errUsage, envAPISecret)
+	}
+	return []string{creds.APISecret}, nil
+}
+
+func (c *command) webhookVerify(args []string) error {
+	fs := c.newFlagSet("webhook verify")
+	common := addCommonFlags(fs)
+	var secrets stringsFlag
+	fs.Var(&secrets, "secret", "webhook secret; repeat to try several (default API secret)")
+	signature := fs.String("signature", "", "value of the x-sagapay-signature header")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := common.validate(); err != nil {
+		return err
+	}
+	if *signature == "" {
+		return fmt.Errorf("%w: --signature is required", errUsage)
+	}
+
+	keys, err := webhookSecrets(secrets, common)
+	if err != nil {
+		return err
+	}
+
+	body, err := io.ReadAll(c.stdin)
+	if err != nil {
+		return fmt.Errorf("failed to read body from stdin: %w", err)
+	}
+
+	handler := sagapay.NewWebhookHandler(keys...)
+	keyID, ok := handler.MatchSignature(body, *signature)
+	if !ok {
+		return fmt.Errorf("%w: %w", errVerificationFailed, sagapay.ErrInvalidSignature)
+	}
+	payload, err := handler.ProcessWebhook(body, *signature)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errVerificationFailed, err)
+	}
+
+	return printer{c.stdout, common.output}.print(payload, append(payloadFields(payload),
+		field{"Verified With", "secret #" + keyID}))
+}
+
+func (c *command) webhookListen(args []string) error {
+	fs := c.newFlagSet("webhook listen")
+	common := addCommonFlags(fs)
+	var secrets stringsFlag
+	fs.Var(&secrets, "secret", "webhook secret; repeat to accept several (default API secret)")
+	addr := fs.String("addr", ":8080", "address to listen on")
+	path := fs.String("path", "/webhook", "URL path to accept webhooks on")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := common.validate(); err != nil {
+		return err
+	}
+
+	keys, err := webhookSecrets(secrets, common)
+	if err != nil {
+		return err
+	}
+
+	// Serialize output so concurrent deliveries do not interleave
+	var mu sync.Mutex
+	out := printer{c.stdout, common.output}
+
+	handler := sagapay.NewWebhookHandler(keys...)
+	handler.OnUnhandled(func(ctx context.Context, payload *sagapay.WebhookPayload) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if common.output == "json" {
+			return out.json(payload)
+		}
+		if err := out.print(payload, payloadFields(payload)); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintln(c.stdout)
+		return err
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle(*path, logRejected(handler, c.stderr, &mu))
+	server := &http.Server{Addr: *addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(c.stderr, "Listening for webhooks on %s%s\n", *addr, *path)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRejected logs requests the webhook handler did not accept
+func logRejected(next http.Handler, w io.Writer, mu *sync.Mutex) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: rw, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.status != http.StatusOK {
+			mu.Lock()
+			fmt.Fprintf(w, "rejected %s %s from %s: %d %s\n", r.Method, r.URL.Path, r.RemoteAddr, rec.status, http.StatusText(rec.status))
+			mu.Unlock()
+		}
+	})
+}
+
+// payloadFields returns the table fields of a webhook payload
+func payloadFields(payload *sagapay.WebhookPayload) []field {
+	return []field{
+		{"ID", payload.ID},
+		{"Type", string(payload.Type)},
+		{"Status", string(payload.Status)},
+		{"Address", payload.Address},
+		{"Network", string(payload.NetworkType)},
+		{"Amount", payload.Amount},
+		{"UDF", payload.UDF},
+		{"Tx Hash", payload.TxHash},
+		{"Timestamp", payload.Timestamp.Format(time.RFC3339)},
+	}
+}
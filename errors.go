@@ -0,0 +1,307 @@
+package sagapay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Sentinel errors that can be matched with errors.Is
+var (
+	// ErrValidation is matched by every *ValidationError
+	ErrValidation = errors.New("sagapay: validation failed")
+
+	// ErrUnauthorized is matched by API errors with status 401
+	ErrUnauthorized = errors.New("sagapay: unauthorized")
+
+	// ErrForbidden is matched by API errors with status 403
+	ErrForbidden = errors.New("sagapay: forbidden")
+
+	// ErrNotFound is matched by API errors with status 404
+	ErrNotFound = errors.New("sagapay: not found")
+
+	// ErrRateLimited is matched by API errors with status 429
+	ErrRateLimited = errors.New("sagapay: rate limited")
+
+	// ErrServer is matched by API errors with a 5xx status
+	ErrServer = errors.New("sagapay: server error")
+
+	// ErrInsufficientFunds is matched by API errors reporting an insufficient
+	// balance, by error code or message (see errorCodes and errorPhrases)
+	ErrInsufficientFunds = errors.New("sagapay: insufficient funds")
+
+	// ErrInvalidAddress is matched by API errors and validation errors for a
+	// malformed address
+	ErrInvalidAddress = errors.New("sagapay: invalid address")
+
+	// ErrUnsupportedNetwork is returned when a network type is not known to the SDK
+	ErrUnsupportedNetwork = errors.New("sagapay: unsupported network type")
+)
+
+// APIError represents an error response from the API
+type APIError struct {
+	// ErrorCode is the error code returned by the API
+	ErrorCode string `json:"error"`
+
+	// Message is the human readable error message returned by the API
+	Message string `json:"message"`
+
+	// Data contains additional error details, if any
+	Data interface{} `json:"data,omitempty"`
+
+	// StatusCode is the HTTP status code of the response
+	StatusCode int `json:"-"`
+
+	// RequestID is the request ID reported by the API, if any
+	RequestID string `json:"-"`
+
+	// Header contains the response headers
+	Header http.Header `json:"-"`
+
+	// RetryAfter is how long the API asked clients to wait before retrying, if it said
+	RetryAfter time.Duration `json:"-"`
+
+	// Body is the raw response body
+	Body []byte `json:"-"`
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	code := e.ErrorCode
+	if code == "" {
+		code = fmt.Sprintf("HTTP %d", e.StatusCode)
+	}
+	message := e.Message
+	if message == "" {
+		message = http.StatusText(e.StatusCode)
+	}
+	if e.RequestID != "" {
+		return fmt.Sprintf("API error: %s - %s (request ID %s)", code, message, e.RequestID)
+	}
+	return fmt.Sprintf("API error: %s - %s", code, message)
+}
+
+// RequestError is returned by CreateDeposit and CreateWithdrawal when the
+// request fails after it may have reached the API, e.g. on a timeout. It
+// carries the idempotency key the request was sent with, generated or not,
+// so the request can be resent without creating a second deposit or payout.
+// It unwraps to the underlying error.
+type RequestError struct {
+	// IdempotencyKey is the key the request was sent with
+	IdempotencyKey string
+
+	// Err is the underlying *APIError or transport error
+	Err error
+}
+
+// Error implements the error interface
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// IdempotencyKeyOf returns the idempotency key carried by a *RequestError in
+// err's chain, or "" if there is none
+func IdempotencyKeyOf(err error) string {
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.IdempotencyKey
+	}
+	return ""
+}
+
+// Is reports whether the error matches one of the sentinel errors
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServer:
+		return e.StatusCode >= 500
+	case ErrInsufficientFunds, ErrInvalidAddress:
+		return e.reason() == target
+	}
+	return false
+}
+
+// Temporary reports whether the error is caused by a condition that is expected to clear on its own
+func (e *APIError) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Retryable reports whether resending the same request may succeed
+func (e *APIError) Retryable() bool {
+	return e.Temporary() || e.StatusCode >= 500
+}
+
+// errorCodes maps the API error codes that identify a sentinel error
+var errorCodes = map[string]error{
+	"INSUFFICIENT_FUNDS":   ErrInsufficientFunds,
+	"INSUFFICIENT_BALANCE": ErrInsufficientFunds,
+	"INVALID_ADDRESS":      ErrInvalidAddress,
+	"INVALID_DESTINATION":  ErrInvalidAddress,
+}
+
+// errorPhrases is the fallback for the generic VALIDATION_ERROR code, which
+// the API also uses for balance and address problems: the first phrase found
+// in the lowercased message identifies the sentinel error. Messages are not a
+// stable interface, so the fallback is limited to that code; any other code
+// missing from errorCodes matches no sentinel. Entries are checked in order.
+var errorPhrases = []struct {
+	phrase string
+	err    error
+}{
+	{"insufficient", ErrInsufficientFunds},
+	{"invalid address", ErrInvalidAddress},
+	{"address is invalid", ErrInvalidAddress},
+	{"invalid destination", ErrInvalidAddress},
+}
+
+// validationErrorCode is the generic error code errorPhrases applies to
+const validationErrorCode = "VALIDATION_ERROR"
+
+// reason returns the sentinel error identified by the error code or, for
+// VALIDATION_ERROR, by the message; nil if there is none
+func (e *APIError) reason() error {
+	code := strings.ToUpper(e.ErrorCode)
+	if err, ok := errorCodes[code]; ok {
+		return err
+	}
+	if code != validationErrorCode {
+		return nil
+	}
+	message := strings.ToLower(e.Message)
+	for _, entry := range errorPhrases {
+		if strings.Contains(message, entry.phrase) {
+			return entry.err
+		}
+	}
+	return nil
+}
+
+// newAPIError builds an APIError from a failed HTTP response and its raw body
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		RequestID:  requestID(resp.Header),
+		Header:     resp.Header,
+		RetryAfter: retryAfter(resp.Header, time.Now()),
+		Body:       body,
+	}
+
+	// The body is not always JSON (e.g. proxy error pages); keep it raw in that case
+	var decoded APIError
+	if err := json.Unmarshal(body, &decoded); err == nil {
+		apiErr.ErrorCode = decoded.ErrorCode
+		apiErr.Message = decoded.Message
+		apiErr.Data = decoded.Data
+	}
+
+	return apiErr
+}
+
+// requestID returns the request ID from the response headers, if any
+func requestID(header http.Header) string {
+	for _, key := range []string{"X-Request-Id", "X-Sagapay-Request-Id", "X-Correlation-Id"} {
+		if id := header.Get(key); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// FieldError describes a single invalid field
+type FieldError struct {
+	// Field is the JSON name of the invalid field
+	Field string
+
+	// Message describes why the field is invalid
+	Message string
+
+	// Err is an optional sentinel error the field error matches, e.g. ErrInvalidAddress
+	Err error
+}
+
+// Error implements the error interface
+func (e *FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// Unwrap returns the sentinel error the field error matches
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is returned when request parameters fail validation.
+// It lists every failing field rather than only the first one.
+type ValidationError struct {
+	Fields []*FieldError
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Error()
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// Is reports whether target is ErrValidation
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// Unwrap returns the individual field errors
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Fields))
+	for i, field := range e.Fields {
+		errs[i] = field
+	}
+	return errs
+}
+
+// Field returns the error for the named field, or nil if the field is valid
+func (e *ValidationError) Field(name string) *FieldError {
+	for _, field := range e.Fields {
+		if field.Field == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// add records an invalid field
+func (e *ValidationError) add(field, message string) {
+	e.Fields = append(e.Fields, &FieldError{Field: field, Message: message})
+}
+
+// addErr records an invalid field caused by err
+func (e *ValidationError) addErr(field string, err error) {
+	e.Fields = append(e.Fields, &FieldError{Field: field, Message: "is invalid: " + err.Error(), Err: err})
+}
+
+// err returns the validation error, or nil if no field failed
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,41 @@
+package sagapay
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestAPIErrorIs(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     *APIError
+		target  error
+		matches bool
+	}{
+		{"insufficient funds code", &APIError{ErrorCode: "INSUFFICIENT_FUNDS"}, ErrInsufficientFunds, true},
+		{"insufficient balance code", &APIError{ErrorCode: "INSUFFICIENT_BALANCE"}, ErrInsufficientFunds, true},
+		{"lowercase code", &APIError{ErrorCode: "insufficient_funds"}, ErrInsufficientFunds, true},
+		{"invalid address code", &APIError{ErrorCode: "INVALID_ADDRESS"}, ErrInvalidAddress, true},
+		{"invalid destination code", &APIError{ErrorCode: "INVALID_DESTINATION"}, ErrInvalidAddress, true},
+		{"known code wins over message", &APIError{ErrorCode: "INVALID_ADDRESS", Message: "insufficient funds"}, ErrInsufficientFunds, false},
+		{"generic code, insufficient message", &APIError{ErrorCode: "VALIDATION_ERROR", Message: "Insufficient balance for withdrawal"}, ErrInsufficientFunds, true},
+		{"generic code, invalid address message", &APIError{ErrorCode: "VALIDATION_ERROR", Message: "Invalid address for network"}, ErrInvalidAddress, true},
+		{"generic code, address is invalid message", &APIError{ErrorCode: "VALIDATION_ERROR", Message: "address is invalid"}, ErrInvalidAddress, true},
+		{"generic code, invalid destination message", &APIError{ErrorCode: "VALIDATION_ERROR", Message: "invalid destination"}, ErrInvalidAddress, true},
+		{"no code, phrase in message", &APIError{Message: "invalid destination"}, ErrInvalidAddress, false},
+		{"other code, phrase in message", &APIError{ErrorCode: "BAD_REQUEST", Message: "insufficient balance"}, ErrInsufficientFunds, false},
+		{"unrelated message", &APIError{ErrorCode: "VALIDATION_ERROR", Message: "amount is required"}, ErrInvalidAddress, false},
+		{"phrase in code is not matched", &APIError{ErrorCode: "INSUFFICIENT_GAS_FOR_CALL"}, ErrInsufficientFunds, false},
+		{"unauthorized", &APIError{StatusCode: http.StatusUnauthorized}, ErrUnauthorized, true},
+		{"server error", &APIError{StatusCode: http.StatusBadGateway}, ErrServer, true},
+		{"not rate limited", &APIError{StatusCode: http.StatusBadRequest}, ErrRateLimited, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, tt.target); got != tt.matches {
+				t.Errorf("errors.Is(%v, %v) = %v, want %v", tt.err, tt.target, got, tt.matches)
+			}
+		})
+	}
+}
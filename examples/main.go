@@ -99,4 +99,4 @@ func main() {
 	fmt.Printf("  Address: %s\n", balanceResponse.Address)
 	fmt.Printf("  Token: %s (%s)\n", balanceResponse.Token.Symbol, balanceResponse.Token.Name)
 	fmt.Printf("  Balance: %s\n", balanceResponse.Balance.Formatted)
-}
\ No newline at end of file
+}
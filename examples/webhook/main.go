@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,66 +13,56 @@ func main() {
 	// Create a webhook handler
 	webhookHandler := sagapay.NewWebhookHandler("your-api-secret")
 
-	// Set up a handler for webhook notifications
-	http.HandleFunc("/webhook", func(w http.ResponseWriter, r *http.Request) {
-		// Only accept POST requests
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
+	// Handle completed deposits
+	webhookHandler.OnDepositCompleted(func(ctx context.Context, payload *sagapay.WebhookPayload) error {
+		log.Printf("Deposit %s completed: %s (order %s)", payload.ID, payload.Amount, payload.UDF)
 
-		// Process the webhook
-		payload, err := webhookHandler.HandleRequest(r)
-		if err != nil {
-			log.Printf("Error processing webhook: %v", err)
-			sagapay.SendErrorResponse(w, err)
-			return
-		}
+		// Your business logic here...
+		// For example, update order status in your database
+		// if err := markOrderPaid(ctx, payload.UDF); err != nil {
+		//     // Ask SagaPay to send the webhook again later
+		//     return sagapay.Redeliver(err)
+		// }
+		return nil
+	})
+
+	// Handle completed withdrawals
+	webhookHandler.OnWithdrawalCompleted(func(ctx context.Context, payload *sagapay.WebhookPayload) error {
+		log.Printf("Withdrawal %s completed: %s", payload.ID, payload.Amount)
 
-		// Log the webhook
-		log.Printf("Received webhook: ID=%s, Type=%s, Status=%s", payload.ID, payload.Type, payload.Status)
+		// Your business logic here...
+		// updateWithdrawalStatus(payload.UDF, "completed")
+		return nil
+	})
 
-		// Handle different transaction statuses
-		switch payload.Status {
-		case sagapay.TransactionStatusCompleted:
-			// Handle completed transaction
-			log.Printf("Transaction %s completed: %s %s", payload.ID, payload.Amount, payload.Type)
-			
-			// Your business logic here...
-			// For example, update order status in your database
-			// if payload.Type == sagapay.TransactionTypeDeposit {
-			//     updateOrderStatus(payload.UDF, "paid")
-			// } else {
-			//     updateWithdrawalStatus(payload.UDF, "completed")
-			// }
+	// Handle failed transactions of any type
+	webhookHandler.On("", sagapay.TransactionStatusFailed, func(ctx context.Context, payload *sagapay.WebhookPayload) error {
+		log.Printf("Transaction %s failed: %s %s", payload.ID, payload.Amount, payload.Type)
 
-		case sagapay.TransactionStatusFailed:
-			// Handle failed transaction
-			log.Printf("Transaction %s failed: %s %s", payload.ID, payload.Amount, payload.Type)
-			
-			// Your business logic here...
-			// updateTransactionStatus(payload.UDF, "failed")
+		// Your business logic here...
+		// updateTransactionStatus(payload.UDF, "failed")
+		return nil
+	})
 
-		case sagapay.TransactionStatusProcessing, sagapay.TransactionStatusPending:
-			// Handle pending/processing transaction
-			log.Printf("Transaction %s is %s: %s %s", payload.ID, payload.Status, payload.Amount, payload.Type)
-			
-			// Your business logic here...
-			// updateTransactionStatus(payload.UDF, string(payload.Status))
+	// Handle cancelled transactions of any type
+	webhookHandler.On("", sagapay.TransactionStatusCancelled, func(ctx context.Context, payload *sagapay.WebhookPayload) error {
+		log.Printf("Transaction %s cancelled: %s %s", payload.ID, payload.Amount, payload.Type)
 
-		case sagapay.TransactionStatusCancelled:
-			// Handle cancelled transaction
-			log.Printf("Transaction %s cancelled: %s %s", payload.ID, payload.Amount, payload.Type)
-			
-			// Your business logic here...
-			// updateTransactionStatus(payload.UDF, "cancelled")
-		}
+		// Your business logic here...
+		// updateTransactionStatus(payload.UDF, "cancelled")
+		return nil
+	})
 
-		// Send a success response
-		sagapay.SendSuccessResponse(w)
+	// Everything else, e.g. pending and processing updates
+	webhookHandler.OnUnhandled(func(ctx context.Context, payload *sagapay.WebhookPayload) error {
+		log.Printf("Transaction %s is %s: %s %s", payload.ID, payload.Status, payload.Amount, payload.Type)
+		return nil
 	})
 
+	// The handler verifies signatures, only accepts POST and sets the response status
+	http.Handle("/webhook", webhookHandler)
+
 	// Start the server
 	fmt.Println("Starting webhook server on :8080...")
 	log.Fatal(http.ListenAndServe(":8080", nil))
-}
\ No newline at end of file
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package sagapay
+
+import "os"
+
+// lockFile is a no-op where flock is not available; a store file must then
+// not be shared between processes
+func lockFile(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package sagapay
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on file, held until it is closed. It
+// fails with ErrStoreLocked if another process holds the lock.
+func lockFile(file *os.File) error {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrStoreLocked
+	}
+	return err
+}
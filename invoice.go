@@ -0,0 +1,457 @@
+package sagapay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// InvoiceStatus represents the payment outcome of an invoice
+type InvoiceStatus string
+
+// Invoice statuses
+const (
+	// InvoiceStatusOpen means no completed payment has been received yet
+	InvoiceStatusOpen InvoiceStatus = "OPEN"
+
+	// InvoiceStatusUnderpaid means less than the expected amount was received
+	InvoiceStatusUnderpaid InvoiceStatus = "UNDERPAID"
+
+	// InvoiceStatusPaid means exactly the expected amount was received before expiry
+	InvoiceStatusPaid InvoiceStatus = "PAID"
+
+	// InvoiceStatusOverpaid means more than the expected amount was received before expiry
+	InvoiceStatusOverpaid InvoiceStatus = "OVERPAID"
+
+	// InvoiceStatusExpired means nothing was received before the invoice expired
+	InvoiceStatusExpired InvoiceStatus = "EXPIRED"
+
+	// InvoiceStatusLatePaid means the expected amount was only reached after expiry
+	InvoiceStatusLatePaid InvoiceStatus = "LATE_PAID"
+)
+
+// IsPaid reports whether at least the expected amount was received, on time or late
+func (s InvoiceStatus) IsPaid() bool {
+	return s == InvoiceStatusPaid || s == InvoiceStatusOverpaid || s == InvoiceStatusLatePaid
+}
+
+// ErrInvoiceNotFound is returned when no invoice exists for an order ID
+var ErrInvoiceNotFound = errors.New("sagapay: invoice not found")
+
+// InvoicePayment is a deposit transaction counted towards an invoice
+type InvoicePayment struct {
+	TransactionID string            `json:"transactionId"`
+	Amount        Amount            `json:"amount"`
+	Status        TransactionStatus `json:"status"`
+	TxHash        string            `json:"txHash,omitempty"`
+	At            time.Time         `json:"at"`
+}
+
+// Invoice is an expected payment for an order, backed by a deposit address
+type Invoice struct {
+	// OrderID identifies the order; it is sent to SagaPay as the deposit UDF
+	OrderID string `json:"orderId"`
+
+	// Token is the token the invoice is payable in
+	Token Token `json:"token"`
+
+	// Amount is the expected amount
+	Amount Amount `json:"amount"`
+
+	// DepositID and Address identify the deposit created for the invoice
+	DepositID string `json:"depositId"`
+	Address   string `json:"address"`
+
+	CreatedAt time.Time `json:"createdAt"`
+
+	// ExpiresAt is when the deposit address expires. Zero means the invoice
+	// never expires, as for a PERMANENT address.
+	ExpiresAt time.Time `json:"expiresAt"`
+
+	// Status is the current payment outcome
+	Status InvoiceStatus `json:"status"`
+
+	// Received is the total of completed payments
+	Received Amount `json:"received"`
+
+	// Pending is the total of payments that are not yet final
+	Pending Amount `json:"pending"`
+
+	// PaidAt is when the received total first reached the expected amount
+	PaidAt time.Time `json:"paidAt"`
+
+	// Payments lists every deposit transaction seen for the invoice
+	Payments []InvoicePayment `json:"payments"`
+}
+
+// CreateInvoiceParams represents the parameters for creating an invoice
+type CreateInvoiceParams struct {
+	// OrderID identifies the order and is stored in the deposit UDF
+	OrderID string
+
+	// Token is the token to be paid; NetworkType, ContractAddress and Decimals are required
+	Token Token
+
+	// Amount is the expected amount
+	Amount Amount
+
+	// IPNUrl is the URL SagaPay sends webhooks for the deposit to
+	IPNUrl string
+
+	// Type is the deposit address type (default TEMPORARY)
+	Type AddressType
+}
+
+// Validate validates the create invoice parameters
+func (p *CreateInvoiceParams) Validate() error {
+	verr := &ValidationError{}
+
+	if p.OrderID == "" {
+		verr.add("orderId", "is required")
+	}
+	if p.Token.NetworkType == "" {
+		verr.add("token.networkType", "is required")
+	}
+	if p.Token.ContractAddress == "" {
+		verr.add("token.contractAddress", "is required")
+	}
+	if p.Amount.IsZero() {
+		verr.add("amount", "must be greater than zero")
+	} else if err := p.Amount.checkPrecision(p.Token.Decimals); err != nil {
+		verr.addErr("amount", err)
+	}
+	if p.IPNUrl == "" {
+		verr.add("ipnUrl", "is required")
+	}
+	return verr.err()
+}
+
+// InvoiceCallback is called when an invoice changes status
+type InvoiceCallback func(invoice Invoice, previous InvoiceStatus)
+
+// InvoiceService creates invoices and settles them from webhooks and polled
+// transactions. Invoices are kept in an InvoiceStore, in memory by default.
+// It is safe for concurrent use.
+type InvoiceService struct {
+	client API
+	store  InvoiceStore
+	now    func() time.Time
+
+	// mu serializes updates, which read, change and save an invoice
+	mu        sync.Mutex
+	callbacks []invoiceCallback
+}
+
+// invoiceCallback is a callback registered for a status, or any status if empty
+type invoiceCallback struct {
+	status InvoiceStatus
+	fn     InvoiceCallback
+}
+
+// NewInvoiceService creates an invoice service that creates deposits with
+// the given client and keeps invoices in memory
+func NewInvoiceService(client API) *InvoiceService {
+	return NewInvoiceServiceWithStore(client, NewMemoryInvoiceStore())
+}
+
+// NewInvoiceServiceWithStore creates an invoice service that keeps invoices
+// in store, e.g. a FileInvoiceStore, so they survive a restart
+func NewInvoiceServiceWithStore(client API, store InvoiceStore) *InvoiceService {
+	return &InvoiceService{client: client, store: store, now: time.Now}
+}
+
+// OnChange registers fn to be called whenever an invoice changes status
+func (s *InvoiceService) OnChange(fn InvoiceCallback) *InvoiceService {
+	return s.On("", fn)
+}
+
+// On registers fn to be called when an invoice moves to the given status
+func (s *InvoiceService) On(status InvoiceStatus, fn InvoiceCallback) *InvoiceService {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.callbacks = append(s.callbacks, invoiceCallback{status: status, fn: fn})
+	return s
+}
+
+// Create creates a deposit for the invoice, with the order ID in the UDF
+func (s *InvoiceService) Create(ctx context.Context, params CreateInvoiceParams) (*Invoice, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	addressType := params.Type
+	if addressType == "" {
+		addressType = AddressTypeTemporary
+	}
+
+	deposit, err := s.client.CreateDeposit(ctx, CreateDepositParams{
+		NetworkType:     params.Token.NetworkType,
+		ContractAddress: params.Token.ContractAddress,
+		Amount:          params.Amount.String(),
+		IPNUrl:          params.IPNUrl,
+		UDF:             params.OrderID,
+		Type:            addressType,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	invoice := &Invoice{
+		OrderID:   params.OrderID,
+		Token:     params.Token,
+		Amount:    params.Amount,
+		DepositID: deposit.ID,
+		Address:   deposit.Address,
+		CreatedAt: s.now(),
+		ExpiresAt: deposit.ExpiresAt,
+		Status:    InvoiceStatusOpen,
+	}
+	if err := s.store.Save(ctx, invoice); err != nil {
+		return nil, fmt.Errorf("invoice %s: failed to save: %w", invoice.OrderID, err)
+	}
+	return invoice, nil
+}
+
+// Invoice returns the invoice for an order ID
+func (s *InvoiceService) Invoice(orderID string) (*Invoice, error) {
+	return s.store.Get(context.Background(), orderID)
+}
+
+// HandleWebhook applies a deposit webhook to its invoice. Late updates that
+// would move a payment backwards are ignored. It can be registered directly
+// on a WebhookHandler:
+//
+//	webhookHandler.On(sagapay.TransactionTypeDeposit, "", invoices.HandleWebhook)
+//
+// A webhook for an address without an invoice fails with an error matching
+// ErrInvoiceNotFound, wrapped with Redeliver so SagaPay sends it again
+// rather than the payment being acknowledged and lost. Register it for
+// invoice deposits only if the same IPN URL receives other deposits.
+func (s *InvoiceService) HandleWebhook(ctx context.Context, payload *WebhookPayload) error {
+	if payload.Type != TransactionTypeDeposit {
+		return nil
+	}
+	return s.apply(ctx, payload.Address, payload.ID, payload.Status, payload.Amount, payload.TxHash, payload.Timestamp)
+}
+
+// ApplyTransaction applies a polled deposit transaction, e.g. from a Watcher
+// event. A transaction for an address without an invoice fails with an error
+// matching ErrInvoiceNotFound.
+func (s *InvoiceService) ApplyTransaction(tx Transaction) error {
+	return s.applyTransaction(context.Background(), tx)
+}
+
+// applyTransaction applies a polled deposit transaction
+func (s *InvoiceService) applyTransaction(ctx context.Context, tx Transaction) error {
+	if tx.TransactionType != "" && tx.TransactionType != TransactionTypeDeposit {
+		return nil
+	}
+	at := tx.CreatedAt
+	if tx.Status.IsTerminal() && !tx.UpdatedAt.IsZero() {
+		at = tx.UpdatedAt
+	}
+	return s.apply(ctx, tx.Address, tx.ID, tx.Status, tx.Amount, tx.TxHash, at)
+}
+
+// Refresh polls the deposit address of an invoice and applies its transactions
+func (s *InvoiceService) Refresh(ctx context.Context, orderID string) (*Invoice, error) {
+	invoice, err := s.store.Get(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.CheckTransactionStatus(ctx, invoice.Address, TransactionTypeDeposit)
+	if err != nil {
+		return nil, err
+	}
+	for _, tx := range resp.Transactions {
+		if tx.Address == "" {
+			tx.Address = invoice.Address
+		}
+		if err := s.applyTransaction(ctx, tx); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.store.Get(ctx, orderID)
+}
+
+// ExpireDue marks open invoices past their expiry as EXPIRED and returns them
+func (s *InvoiceService) ExpireDue(ctx context.Context) ([]Invoice, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	open, err := s.store.List(ctx, InvoiceStatusOpen)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	var changes []invoiceChange
+	for _, invoice := range open {
+		if !invoice.expired(now) {
+			continue
+		}
+		invoice.Status = InvoiceStatusExpired
+		if err := s.store.Save(ctx, invoice); err != nil {
+			err = fmt.Errorf("invoice %s: failed to save: %w", invoice.OrderID, err)
+			s.mu.Unlock()
+			s.notifyAll(changes)
+			return expiredInvoices(changes), err
+		}
+		changes = append(changes, invoiceChange{invoice.clone(), InvoiceStatusOpen})
+	}
+	s.mu.Unlock()
+
+	s.notifyAll(changes)
+	return expiredInvoices(changes), nil
+}
+
+// expiredInvoices returns the invoices of status changes
+func expiredInvoices(changes []invoiceChange) []Invoice {
+	expired := make([]Invoice, len(changes))
+	for i, change := range changes {
+		expired[i] = change.invoice
+	}
+	return expired
+}
+
+// invoiceChange is a status change to report to callbacks
+type invoiceChange struct {
+	invoice  Invoice
+	previous InvoiceStatus
+}
+
+// apply records a payment update and recomputes the invoice status
+func (s *InvoiceService) apply(ctx context.Context, address, txID string, status TransactionStatus, rawAmount, txHash string, at time.Time) error {
+	if !status.IsKnown() {
+		return fmt.Errorf("%w: %q for transaction %s", ErrUnknownStatus, status, txID)
+	}
+
+	s.mu.Lock()
+	invoice, err := s.store.GetByAddress(ctx, address)
+	if err != nil {
+		s.mu.Unlock()
+		return Redeliver(fmt.Errorf("payment %s: %w", txID, err))
+	}
+
+	amount, err := invoice.Token.ParseAmount(rawAmount)
+	if err != nil {
+		// Redeliver rather than acknowledge a payment that was not counted
+		s.mu.Unlock()
+		return Redeliver(fmt.Errorf("invoice %s: payment %s: %w", invoice.OrderID, txID, err))
+	}
+
+	payment := InvoicePayment{TransactionID: txID, Amount: amount, Status: status, TxHash: txHash, At: at}
+	replaced := false
+	for i := range invoice.Payments {
+		current := invoice.Payments[i]
+		if current.TransactionID != txID {
+			continue
+		}
+		if current.Status == status || !current.Status.CanTransitionTo(status) {
+			// Late or repeated update
+			s.mu.Unlock()
+			return nil
+		}
+		if payment.TxHash == "" {
+			payment.TxHash = current.TxHash
+		}
+		invoice.Payments[i] = payment
+		replaced = true
+	}
+	if !replaced {
+		invoice.Payments = append(invoice.Payments, payment)
+	}
+
+	previous := invoice.Status
+	invoice.settle(s.now())
+	if err := s.store.Save(ctx, invoice); err != nil {
+		s.mu.Unlock()
+		return Redeliver(fmt.Errorf("invoice %s: failed to save: %w", invoice.OrderID, err))
+	}
+	var change *invoiceChange
+	if invoice.Status != previous {
+		change = &invoiceChange{invoice.clone(), previous}
+	}
+	s.mu.Unlock()
+
+	if change != nil {
+		s.notify(*change)
+	}
+	return nil
+}
+
+// notifyAll reports status changes to the callbacks
+func (s *InvoiceService) notifyAll(changes []invoiceChange) {
+	for _, change := range changes {
+		s.notify(change)
+	}
+}
+
+// notify calls the callbacks registered for a status change
+func (s *InvoiceService) notify(change invoiceChange) {
+	s.mu.Lock()
+	callbacks := append([]invoiceCallback(nil), s.callbacks...)
+	s.mu.Unlock()
+
+	for _, cb := range callbacks {
+		if cb.status == "" || cb.status == change.invoice.Status {
+			cb.fn(change.invoice, change.previous)
+		}
+	}
+}
+
+// settle recomputes the received totals and the status of the invoice
+func (inv *Invoice) settle(now time.Time) {
+	// Count completed payments in the order they were made
+	completed := make([]InvoicePayment, 0, len(inv.Payments))
+	inv.Received = Amount{}
+	inv.Pending = Amount{}
+	for _, payment := range inv.Payments {
+		switch {
+		case payment.Status.IsSuccess():
+			completed = append(completed, payment)
+		case !payment.Status.IsTerminal():
+			inv.Pending = inv.Pending.Add(payment.Amount)
+		}
+	}
+	sort.SliceStable(completed, func(i, j int) bool { return completed[i].At.Before(completed[j].At) })
+
+	inv.PaidAt = time.Time{}
+	for _, payment := range completed {
+		inv.Received = inv.Received.Add(payment.Amount)
+		if inv.PaidAt.IsZero() && inv.Received.Cmp(inv.Amount) >= 0 {
+			inv.PaidAt = payment.At
+		}
+	}
+
+	switch cmp := inv.Received.Cmp(inv.Amount); {
+	case inv.Received.IsZero() && inv.expired(now):
+		inv.Status = InvoiceStatusExpired
+	case inv.Received.IsZero():
+		inv.Status = InvoiceStatusOpen
+	case cmp < 0:
+		inv.Status = InvoiceStatusUnderpaid
+	case !inv.ExpiresAt.IsZero() && inv.PaidAt.After(inv.ExpiresAt):
+		inv.Status = InvoiceStatusLatePaid
+	case cmp > 0:
+		inv.Status = InvoiceStatusOverpaid
+	default:
+		inv.Status = InvoiceStatusPaid
+	}
+}
+
+// expired reports whether the invoice has expired at the given time
+func (inv *Invoice) expired(now time.Time) bool {
+	return !inv.ExpiresAt.IsZero() && !now.Before(inv.ExpiresAt)
+}
+
+// clone returns a copy of the invoice that shares no mutable state
+func (inv *Invoice) clone() Invoice {
+	c := *inv
+	c.Payments = append([]InvoicePayment(nil), inv.Payments...)
+	return c
+}
@@ -0,0 +1,161 @@
+package sagapay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// InvoiceStore keeps the invoices of an InvoiceService. With a persistent
+// store, payments for invoices created before a restart are still settled.
+type InvoiceStore interface {
+	// Save creates or replaces an invoice
+	Save(ctx context.Context, invoice *Invoice) error
+
+	// Get returns a copy of the invoice for an order ID, or an error
+	// matching ErrInvoiceNotFound
+	Get(ctx context.Context, orderID string) (*Invoice, error)
+
+	// GetByAddress returns a copy of the invoice for a deposit address, or
+	// an error matching ErrInvoiceNotFound
+	GetByAddress(ctx context.Context, address string) (*Invoice, error)
+
+	// List returns copies of the invoices with a status, or of all invoices
+	// if status is empty, ordered by creation time
+	List(ctx context.Context, status InvoiceStatus) ([]*Invoice, error)
+}
+
+// MemoryInvoiceStore is an in-memory InvoiceStore, the default of NewInvoiceService
+type MemoryInvoiceStore struct {
+	mu        sync.Mutex
+	invoices  map[string]*Invoice // by order ID
+	byAddress map[string]string   // order IDs by address
+}
+
+// NewMemoryInvoiceStore creates an empty in-memory invoice store
+func NewMemoryInvoiceStore() *MemoryInvoiceStore {
+	return &MemoryInvoiceStore{
+		invoices:  make(map[string]*Invoice),
+		byAddress: make(map[string]string),
+	}
+}
+
+// Save creates or replaces an invoice
+func (s *MemoryInvoiceStore) Save(ctx context.Context, invoice *Invoice) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(invoice)
+	return nil
+}
+
+// put stores a copy of the invoice; the caller holds s.mu
+func (s *MemoryInvoiceStore) put(invoice *Invoice) {
+	c := invoice.clone()
+	s.invoices[c.OrderID] = &c
+	s.byAddress[c.Address] = c.OrderID
+}
+
+// Get returns a copy of the invoice for an order ID
+func (s *MemoryInvoiceStore) Get(ctx context.Context, orderID string) (*Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invoice, ok := s.invoices[orderID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrInvoiceNotFound, orderID)
+	}
+	c := invoice.clone()
+	return &c, nil
+}
+
+// GetByAddress returns a copy of the invoice for a deposit address
+func (s *MemoryInvoiceStore) GetByAddress(ctx context.Context, address string) (*Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	orderID, ok := s.byAddress[address]
+	if !ok {
+		return nil, fmt.Errorf("%w: no invoice for address %s", ErrInvoiceNotFound, address)
+	}
+	c := s.invoices[orderID].clone()
+	return &c, nil
+}
+
+// List returns copies of the invoices with a status, or of all invoices
+func (s *MemoryInvoiceStore) List(ctx context.Context, status InvoiceStatus) ([]*Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var invoices []*Invoice
+	for _, invoice := range s.invoices {
+		if status == "" || invoice.Status == status {
+			c := invoice.clone()
+			invoices = append(invoices, &c)
+		}
+	}
+	sort.Slice(invoices, func(i, j int) bool {
+		if !invoices[i].CreatedAt.Equal(invoices[j].CreatedAt) {
+			return invoices[i].CreatedAt.Before(invoices[j].CreatedAt)
+		}
+		return invoices[i].OrderID < invoices[j].OrderID
+	})
+	return invoices, nil
+}
+
+// FileInvoiceStore is an InvoiceStore backed by a JSON lines file. Every
+// saved invoice is appended as one line and synced to disk; on open the
+// latest version of each invoice wins. It guards against concurrent use
+// within one process only: do not share the file between processes.
+type FileInvoiceStore struct {
+	*MemoryInvoiceStore
+	file *os.File
+}
+
+// NewFileInvoiceStore opens or creates the invoice file at path and loads
+// the invoices it contains. A final line torn by a crash is discarded.
+func NewFileInvoiceStore(path string) (*FileInvoiceStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open invoice store: %w", err)
+	}
+
+	mem := NewMemoryInvoiceStore()
+	err = readJSONLines(file, func(line int, data []byte) error {
+		var invoice Invoice
+		if err := json.Unmarshal(data, &invoice); err != nil {
+			return err
+		}
+		mem.put(&invoice)
+		return nil
+	})
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read invoice store: %w", err)
+	}
+
+	return &FileInvoiceStore{MemoryInvoiceStore: mem, file: file}, nil
+}
+
+// Save appends the invoice to the file and replaces it in memory
+func (s *FileInvoiceStore) Save(ctx context.Context, invoice *Invoice) error {
+	line, err := json.Marshal(invoice)
+	if err != nil {
+		return fmt.Errorf("failed to encode invoice: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write invoice store: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync invoice store: %w", err)
+	}
+	s.put(invoice)
+	return nil
+}
+
+// Close closes the underlying file
+func (s *FileInvoiceStore) Close() error {
+	return s.file.Close()
+}
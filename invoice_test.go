@@ -0,0 +1,161 @@
+package sagapay
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testInvoiceService returns a service holding one open invoice for 10 units
+// expiring at expiresAt, with its clock set to now
+func testInvoiceService(t *testing.T, expiresAt time.Time, now *time.Time) *InvoiceService {
+	t.Helper()
+	s := NewInvoiceService(nil)
+	s.now = func() time.Time { return *now }
+	invoice := &Invoice{
+		OrderID:   "order-1",
+		Token:     Token{NetworkType: NetworkTypeBEP20, ContractAddress: NativeContractAddress, Decimals: 6},
+		Amount:    MustParseAmount("10"),
+		DepositID: "dep-1",
+		Address:   "0xabc",
+		ExpiresAt: expiresAt,
+		Status:    InvoiceStatusOpen,
+	}
+	if err := s.store.Save(context.Background(), invoice); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// pay applies a payment webhook to the invoice of testInvoiceService
+func pay(s *InvoiceService, id, amount string, status TransactionStatus, at time.Time) error {
+	return s.HandleWebhook(context.Background(), &WebhookPayload{
+		ID:        id,
+		Type:      TransactionTypeDeposit,
+		Status:    status,
+		Address:   "0xabc",
+		Amount:    amount,
+		Timestamp: at,
+	})
+}
+
+func TestInvoiceSettle(t *testing.T) {
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := start.Add(time.Hour)
+	type payment struct {
+		amount string
+		status TransactionStatus
+		after  time.Duration
+	}
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		payments  []payment
+		want      InvoiceStatus
+	}{
+		{"paid", expiresAt, []payment{{"10", TransactionStatusCompleted, time.Minute}}, InvoiceStatusPaid},
+		{"overpaid", expiresAt, []payment{{"10.5", TransactionStatusCompleted, time.Minute}}, InvoiceStatusOverpaid},
+		{"underpaid", expiresAt, []payment{{"4", TransactionStatusCompleted, time.Minute}}, InvoiceStatusUnderpaid},
+		{"pending only", expiresAt, []payment{{"10", TransactionStatusPending, time.Minute}}, InvoiceStatusOpen},
+		{"paid in parts", expiresAt, []payment{{"4", TransactionStatusCompleted, time.Minute}, {"6", TransactionStatusCompleted, 2 * time.Minute}}, InvoiceStatusPaid},
+		{"late", expiresAt, []payment{{"10", TransactionStatusCompleted, 2 * time.Hour}}, InvoiceStatusLatePaid},
+		{"expired", expiresAt, []payment{{"10", TransactionStatusFailed, 2 * time.Hour}}, InvoiceStatusExpired},
+		{"never expires", time.Time{}, []payment{{"10", TransactionStatusCompleted, 48 * time.Hour}}, InvoiceStatusPaid},
+		{"never expires unpaid", time.Time{}, []payment{{"10", TransactionStatusFailed, 48 * time.Hour}}, InvoiceStatusOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := start
+			s := testInvoiceService(t, tt.expiresAt, &now)
+			for i, p := range tt.payments {
+				now = start.Add(p.after)
+				if err := pay(s, string(rune('a'+i)), p.amount, p.status, now); err != nil {
+					t.Fatal(err)
+				}
+			}
+			invoice, err := s.Invoice("order-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if invoice.Status != tt.want {
+				t.Errorf("status = %s, want %s", invoice.Status, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvoiceExpireDue(t *testing.T) {
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	s := testInvoiceService(t, start.Add(time.Hour), &now)
+	s.store.Save(context.Background(), &Invoice{OrderID: "permanent", Address: "0xdef", Amount: MustParseAmount("1"), Status: InvoiceStatusOpen})
+
+	var changes []string
+	s.OnChange(func(invoice Invoice, previous InvoiceStatus) {
+		changes = append(changes, invoice.OrderID+":"+string(previous)+"->"+string(invoice.Status))
+	})
+
+	if expired, err := s.ExpireDue(context.Background()); err != nil || len(expired) != 0 {
+		t.Fatalf("ExpireDue before expiry = %v, %v", expired, err)
+	}
+
+	now = start.Add(time.Hour)
+	expired, err := s.ExpireDue(context.Background())
+	if err != nil || len(expired) != 1 || expired[0].OrderID != "order-1" {
+		t.Fatalf("ExpireDue = %v, %v, want order-1 only", expired, err)
+	}
+	if len(changes) != 1 || changes[0] != "order-1:OPEN->EXPIRED" {
+		t.Errorf("changes = %q", changes)
+	}
+
+	// An invoice without an expiry stays open
+	now = start.Add(365 * 24 * time.Hour)
+	if expired, err := s.ExpireDue(context.Background()); err != nil || len(expired) != 0 {
+		t.Errorf("ExpireDue of an invoice without expiry = %v, %v", expired, err)
+	}
+	if invoice, _ := s.Invoice("permanent"); invoice.Status != InvoiceStatusOpen {
+		t.Errorf("status = %s, want OPEN", invoice.Status)
+	}
+}
+
+func TestInvoiceWebhookErrors(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	s := testInvoiceService(t, now.Add(time.Hour), &now)
+
+	tests := []struct {
+		name    string
+		payload WebhookPayload
+	}{
+		{"unknown address", WebhookPayload{ID: "a", Type: TransactionTypeDeposit, Status: TransactionStatusCompleted, Address: "0xother", Amount: "10"}},
+		{"unparsable amount", WebhookPayload{ID: "a", Type: TransactionTypeDeposit, Status: TransactionStatusCompleted, Address: "0xabc", Amount: "ten"}},
+		{"too precise amount", WebhookPayload{ID: "a", Type: TransactionTypeDeposit, Status: TransactionStatusCompleted, Address: "0xabc", Amount: "1.0000001"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.HandleWebhook(context.Background(), &tt.payload); !IsRedelivery(err) {
+				t.Errorf("HandleWebhook = %v, want a redelivery", err)
+			}
+		})
+	}
+
+	invoice, _ := s.Invoice("order-1")
+	if len(invoice.Payments) != 0 || invoice.Status != InvoiceStatusOpen {
+		t.Errorf("invoice = %+v, want no payments recorded", invoice)
+	}
+}
+
+func TestInvoiceIgnoresLateUpdates(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	s := testInvoiceService(t, now.Add(time.Hour), &now)
+
+	if err := pay(s, "a", "10", TransactionStatusCompleted, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := pay(s, "a", "10", TransactionStatusPending, now); err != nil {
+		t.Fatal(err)
+	}
+	invoice, _ := s.Invoice("order-1")
+	if invoice.Status != InvoiceStatusPaid || len(invoice.Payments) != 1 || invoice.Payments[0].Status != TransactionStatusCompleted {
+		t.Errorf("invoice = %+v, want the late PENDING ignored", invoice)
+	}
+}
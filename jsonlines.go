@@ -0,0 +1,56 @@
+package sagapay
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// readJSONLines reads an append-only JSON lines file from the start and
+// calls fn with each non-empty line and its line number. If fn fails on the
+// final line, that line is taken to be a write torn by a crash: it is
+// truncated away, so the next append starts on a fresh line, and reading
+// succeeds. A failure on any earlier line is returned. A valid final line
+// missing its newline gets one.
+func readJSONLines(file *os.File, fn func(line int, data []byte) error) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(file)
+	var offset int64
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		last := errors.Is(err, io.EOF)
+		if !last {
+			// A line followed only by EOF is the last one too
+			if _, peekErr := reader.Peek(1); errors.Is(peekErr, io.EOF) {
+				last = true
+			}
+		}
+
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 {
+			if fnErr := fn(line, trimmed); fnErr != nil {
+				if !last {
+					return fmt.Errorf("line %d: %w", line, fnErr)
+				}
+				return file.Truncate(offset)
+			}
+			if data[len(data)-1] != '\n' {
+				if _, err := file.Write([]byte{'\n'}); err != nil {
+					return err
+				}
+			}
+		}
+		offset += int64(len(data))
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+	}
+}
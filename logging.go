@@ -0,0 +1,247 @@
+package sagapay
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// redactedHeaders are request headers whose values are masked in logs
+var redactedHeaders = map[string]bool{
+	"X-Api-Key":           true,
+	"X-Api-Secret":        true,
+	"X-Sagapay-Signature": true,
+	"Authorization":       true,
+}
+
+// Redaction is how a body field is redacted in logs
+type Redaction string
+
+// Redactions
+const (
+	// RedactMask keeps a short prefix and suffix of the value, e.g. "0x12…cdef"
+	RedactMask Redaction = "mask"
+
+	// RedactOmit replaces the value with "[REDACTED]"
+	RedactOmit Redaction = "omit"
+)
+
+// RedactionPolicy maps JSON field names to how their values are redacted in
+// logged bodies. Fields are matched at any depth; fields not listed are logged as is.
+type RedactionPolicy map[string]Redaction
+
+// DefaultRedactionPolicy masks addresses and transaction hashes and omits
+// credentials, callback URLs and user-defined fields
+func DefaultRedactionPolicy() RedactionPolicy {
+	return RedactionPolicy{
+		"address":   RedactMask,
+		"txHash":    RedactMask,
+		"apiKey":    RedactOmit,
+		"apiSecret": RedactOmit,
+		"ipnUrl":    RedactOmit,
+		"udf":       RedactOmit,
+	}
+}
+
+// tighten returns a copy of p with the entries of extra added. An entry
+// can make a field stricter, from RedactMask to RedactOmit, but never looser.
+func (p RedactionPolicy) tighten(extra RedactionPolicy) RedactionPolicy {
+	merged := make(RedactionPolicy, len(p)+len(extra))
+	for field, redaction := range p {
+		merged[field] = redaction
+	}
+	for field, redaction := range extra {
+		switch {
+		case redaction == RedactOmit:
+			merged[field] = RedactOmit
+		case redaction == RedactMask && merged[field] != RedactOmit:
+			merged[field] = RedactMask
+		}
+	}
+	return merged
+}
+
+// MaskValue masks an address or identifier down to a short prefix and suffix.
+// Values too short to mask safely are replaced entirely.
+func MaskValue(s string) string {
+	const keep = 4
+	if len(s) <= 3*keep {
+		return strings.Repeat("*", min(len(s), 8))
+	}
+	return s[:keep] + "…" + s[len(s)-keep:]
+}
+
+// maskSecret masks a credential down to its last few characters, which is
+// enough to tell keys apart without weakening them
+func maskSecret(s string) string {
+	const keep = 4
+	if len(s) < 4*keep {
+		return strings.Repeat("*", 8)
+	}
+	return "…" + s[len(s)-keep:]
+}
+
+// redact returns a copy of a decoded JSON value with the policy applied
+func (p RedactionPolicy) redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			switch p[key] {
+			case RedactOmit:
+				out[key] = "[REDACTED]"
+			case RedactMask:
+				if s, ok := value.(string); ok {
+					out[key] = MaskValue(s)
+				} else {
+					out[key] = "[REDACTED]"
+				}
+			default:
+				out[key] = p.redact(value)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, value := range v {
+			out[i] = p.redact(value)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// redactBody returns a JSON body with the policy applied, as a string for logging
+func (p RedactionPolicy) redactBody(body []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return "[unparsable body]"
+	}
+	redacted, err := json.Marshal(p.redact(v))
+	if err != nil {
+		return "[unparsable body]"
+	}
+	return string(redacted)
+}
+
+// redactHeader returns the headers as a log group with credentials masked
+func redactHeader(h http.Header) slog.Attr {
+	attrs := make([]any, 0, len(h))
+	for name, values := range h {
+		value := strings.Join(values, ", ")
+		if redactedHeaders[http.CanonicalHeaderKey(name)] {
+			value = maskSecret(value)
+		}
+		attrs = append(attrs, slog.String(name, value))
+	}
+	return slog.Group("headers", attrs...)
+}
+
+// attemptLog describes an HTTP attempt for logging
+type attemptLog struct {
+	call     *Call
+	attempt  int
+	req      *http.Request
+	payload  []byte
+	resp     *http.Response
+	respBody []byte
+	err      error
+	elapsed  time.Duration
+	retrying bool
+}
+
+// requestID returns the request ID echoed by the API, or the one sent with the request
+func (a attemptLog) requestID() string {
+	if a.resp != nil {
+		if id := requestID(a.resp.Header); id != "" {
+			return id
+		}
+	}
+	if a.req != nil {
+		return a.req.Header.Get(RequestIDHeader)
+	}
+	return ""
+}
+
+// logAttempt logs an HTTP attempt. Successful attempts are logged at info,
+// retried failures at warn and final failures at error level. Headers are
+// only included when debug logging is enabled, bodies when LogBodies is set.
+func (c *Client) logAttempt(ctx context.Context, a attemptLog) {
+	if c.logger == nil {
+		return
+	}
+
+	level := slog.LevelInfo
+	msg := "sagapay request"
+	switch {
+	case a.retrying:
+		level, msg = slog.LevelWarn, "sagapay request failed, retrying"
+	case a.err != nil || a.resp != nil && a.resp.StatusCode >= 400:
+		level, msg = slog.LevelError, "sagapay request failed"
+	}
+	if !c.logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", a.call.Method),
+		slog.String("endpoint", a.call.Endpoint),
+		slog.Int("attempt", a.attempt),
+		slog.Duration("latency", a.elapsed),
+	}
+	if a.resp != nil {
+		attrs = append(attrs, slog.Int("status", a.resp.StatusCode))
+	}
+	if id := a.requestID(); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if a.err != nil {
+		attrs = append(attrs, slog.String("error", a.err.Error()))
+	}
+	if p, ok := a.call.params.(CreateWithdrawalParams); ok {
+		attrs = append(attrs, slog.String("address", MaskValue(p.Address)))
+	}
+	if a.req != nil && c.logger.Enabled(ctx, slog.LevelDebug) {
+		attrs = append(attrs, redactHeader(a.req.Header))
+	}
+	if c.logBodies {
+		if len(a.payload) > 0 {
+			attrs = append(attrs, slog.String("request_body", c.redaction.redactBody(a.payload)))
+		}
+		if len(a.respBody) > 0 {
+			attrs = append(attrs, slog.String("response_body", c.redaction.redactBody(a.respBody)))
+		}
+	}
+
+	c.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// SetLogger sets the logger webhook verification failures are logged to
+func (h *WebhookHandler) SetLogger(logger *slog.Logger) *WebhookHandler {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.logger = logger
+	return h
+}
+
+// rejected logs and counts a webhook that failed verification or parsing
+func (h *WebhookHandler) rejected(err error, signature string, bodySize int) {
+	h.observeWebhook(webhookOutcome(err))
+
+	h.mu.RLock()
+	logger := h.logger
+	h.mu.RUnlock()
+	if logger == nil {
+		return
+	}
+
+	logger.Warn("sagapay webhook rejected",
+		slog.String("error", err.Error()),
+		slog.String("signature", maskSecret(signature)),
+		slog.Int("body_size", bodySize),
+	)
+}
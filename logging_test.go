@@ -0,0 +1,166 @@
+package sagapay_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/halfindex/sagapay-go-sdk"
+	"github.com/halfindex/sagapay-go-sdk/sagapaytest"
+)
+
+func TestMaskValue(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "0x5a…eAed"},
+		{"TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", "TR7N…Lj6t"},
+		{"0123456789abc", "0123…9abc"},
+		{"0123456789ab", "********"},
+		{"abc", "***"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := sagapay.MaskValue(tt.in); got != tt.want {
+			t.Errorf("MaskValue(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// logRecords decodes the JSON log records written to buf
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestClientLogRedaction(t *testing.T) {
+	srv := sagapaytest.NewServer(sagapaytest.Config{APIKey: "live-key-0123456789", APISecret: "live-secret-0123456789"})
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	config := srv.ClientConfig()
+	config.Logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	config.LogBodies = true
+	config.RedactionPolicy = sagapay.RedactionPolicy{
+		"amount":  sagapay.RedactOmit,
+		"address": sagapay.RedactMask,
+		"udf":     sagapay.RedactMask, // cannot loosen the default
+	}
+	client, err := sagapay.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	destination := "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+	if _, err := client.CreateWithdrawal(context.Background(), sagapay.CreateWithdrawalParams{
+		NetworkType:     sagapay.NetworkTypeBEP20,
+		ContractAddress: sagapay.NativeContractAddress,
+		Address:         destination,
+		Amount:          "12.5",
+		IPNUrl:          "https://example.com/ipn?token=abc",
+		UDF:             "customer-42",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, secret := range []string{"live-key-0123456789", "live-secret-0123456789", destination, "example.com/ipn", "customer-42", "12.5"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log contains %q:\n%s", secret, out)
+		}
+	}
+
+	records := logRecords(t, &buf)
+	if len(records) != 1 {
+		t.Fatalf("%d log records, want 1", len(records))
+	}
+	record := records[0]
+	if record["address"] != "0x5a…eAed" || record["endpoint"] != sagapay.EndpointCreateWithdrawal {
+		t.Errorf("record = %v", record)
+	}
+	headers, _ := record["headers"].(map[string]any)
+	if headers["X-Api-Key"] != "…6789" || headers["X-Api-Secret"] != "…6789" {
+		t.Errorf("headers = %v, want masked credentials", headers)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal([]byte(record["request_body"].(string)), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"address": "0x5a…eAed",
+		"amount":  "[REDACTED]",
+		"ipnUrl":  "[REDACTED]",
+		"udf":     "[REDACTED]",
+	}
+	for field, value := range want {
+		if body[field] != value {
+			t.Errorf("request_body[%q] = %v, want %v", field, body[field], value)
+		}
+	}
+}
+
+func TestClientLogLevels(t *testing.T) {
+	srv := sagapaytest.NewServer(sagapaytest.Config{})
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	config := srv.ClientConfig()
+	config.Logger = slog.New(slog.NewJSONHandler(&buf, nil))
+	config.RetryPolicy = &sagapay.RetryPolicy{MaxAttempts: 2}
+	client, err := sagapay.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.FailNext("/check-transaction-status", http.StatusServiceUnavailable)
+	srv.FailNext("/check-transaction-status", http.StatusServiceUnavailable)
+	client.CheckTransactionStatus(context.Background(), "0xabc", sagapay.TransactionTypeDeposit)
+	client.CheckTransactionStatus(context.Background(), "0xabc", sagapay.TransactionTypeDeposit)
+
+	var levels []string
+	for _, record := range logRecords(t, &buf) {
+		levels = append(levels, record["level"].(string))
+		if _, ok := record["headers"]; ok {
+			t.Error("headers logged below debug level")
+		}
+	}
+	if got := strings.Join(levels, ","); got != "WARN,ERROR,INFO" {
+		t.Errorf("levels = %s, want WARN,ERROR,INFO", got)
+	}
+}
+
+func TestWebhookRejectedLog(t *testing.T) {
+	var buf bytes.Buffer
+	handler := sagapay.NewWebhookHandler("secret").
+		SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	signature := webhookSignature("other", `{"id":"tx-1"}`)
+	r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"id":"tx-1"}`))
+	r.Header.Set(sagapay.SignatureHeader, signature)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	records := logRecords(t, &buf)
+	if len(records) != 1 {
+		t.Fatalf("%d log records, want 1", len(records))
+	}
+	if got := records[0]["signature"]; got != "…"+signature[len(signature)-4:] {
+		t.Errorf("signature = %v, want it masked", got)
+	}
+	if strings.Contains(buf.String(), signature) {
+		t.Error("log contains the full signature")
+	}
+}
@@ -0,0 +1,179 @@
+package sagapay
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebhookOutcome is the outcome of a webhook delivery, as reported to Metrics
+type WebhookOutcome string
+
+// Webhook outcomes
+const (
+	// WebhookAccepted is a webhook that was verified and handled
+	WebhookAccepted WebhookOutcome = "accepted"
+
+	// WebhookBadSignature is a webhook with a missing or invalid signature
+	WebhookBadSignature WebhookOutcome = "bad_signature"
+
+	// WebhookParseError is a webhook whose body could not be read or parsed
+	WebhookParseError WebhookOutcome = "parse_error"
+
+	// WebhookStale is a webhook outside the timestamp tolerance
+	WebhookStale WebhookOutcome = "stale"
+
+	// WebhookDuplicate is a webhook for an event that was already handled
+	WebhookDuplicate WebhookOutcome = "duplicate"
+
+	// WebhookHandlerError is a verified webhook whose handler failed
+	WebhookHandlerError WebhookOutcome = "handler_error"
+)
+
+// Metrics receives measurements from a Client and a WebhookHandler.
+// Implementations must be safe for concurrent use. Label values are drawn
+// from small, fixed sets so they can be used as metric labels.
+type Metrics interface {
+	// ObserveRequest is called once per API call, after any retries, with the
+	// endpoint name, the result code (see MetricsCode) and the total duration
+	ObserveRequest(endpoint, code string, elapsed time.Duration)
+
+	// IncRetry is called each time a call to endpoint is retried
+	IncRetry(endpoint string)
+
+	// IncWebhook is called once per webhook with its outcome
+	IncWebhook(outcome WebhookOutcome)
+}
+
+// MetricsCode returns the result code reported to Metrics for an error:
+// "ok" for nil; for an *APIError, its error code if the SDK knows it (see
+// errorCodes), "other" for an unknown code and "http_<status>" if the API
+// sent none; and "validation", "throttled", "timeout", "canceled" or
+// "network" otherwise. Codes the server makes up never become label values.
+func MetricsCode(err error) string {
+	var apiErr *APIError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.As(err, &apiErr):
+		code := strings.ToUpper(apiErr.ErrorCode)
+		switch {
+		case code == "":
+			return "http_" + strconv.Itoa(apiErr.StatusCode)
+		case code == validationErrorCode || errorCodes[code] != nil:
+			return code
+		}
+		return "other"
+	case errors.Is(err, ErrValidation):
+		return "validation"
+	case errors.Is(err, ErrRateLimitWait):
+		return "throttled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	default:
+		return "network"
+	}
+}
+
+// webhookOutcome returns the outcome reported for a webhook that failed verification
+func webhookOutcome(err error) WebhookOutcome {
+	switch {
+	case errors.Is(err, ErrMissingSignature), errors.Is(err, ErrInvalidSignature):
+		return WebhookBadSignature
+	case errors.Is(err, ErrStaleWebhook):
+		return WebhookStale
+	default:
+		return WebhookParseError
+	}
+}
+
+// SetMetrics sets the metrics webhook outcomes are reported to
+func (h *WebhookHandler) SetMetrics(metrics Metrics) *WebhookHandler {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.metrics = metrics
+	return h
+}
+
+// observeWebhook reports a webhook outcome if metrics are set
+func (h *WebhookHandler) observeWebhook(outcome WebhookOutcome) {
+	h.mu.RLock()
+	metrics := h.metrics
+	h.mu.RUnlock()
+	if metrics != nil {
+		metrics.IncWebhook(outcome)
+	}
+}
+
+// ExpvarMetrics publishes metrics as expvar variables, served as JSON on
+// /debug/vars by the expvar package:
+//
+//	<prefix>.requests          {endpoint: {code: count}}
+//	<prefix>.request_seconds   {endpoint: total seconds}
+//	<prefix>.retries           {endpoint: count}
+//	<prefix>.webhooks          {outcome: count}
+type ExpvarMetrics struct {
+	requests       *expvar.Map
+	requestSeconds *expvar.Map
+	retries        *expvar.Map
+	webhooks       *expvar.Map
+
+	mu sync.Mutex
+}
+
+// NewExpvarMetrics creates and publishes expvar metrics under prefix
+// (default "sagapay"). Like expvar.NewMap, it panics if the names are
+// already published, so call it once per prefix.
+func NewExpvarMetrics(prefix string) *ExpvarMetrics {
+	if prefix == "" {
+		prefix = "sagapay"
+	}
+	return &ExpvarMetrics{
+		requests:       expvar.NewMap(prefix + ".requests"),
+		requestSeconds: expvar.NewMap(prefix + ".request_seconds"),
+		retries:        expvar.NewMap(prefix + ".retries"),
+		webhooks:       expvar.NewMap(prefix + ".webhooks"),
+	}
+}
+
+// ObserveRequest implements Metrics
+func (m *ExpvarMetrics) ObserveRequest(endpoint, code string, elapsed time.Duration) {
+	m.endpointMap(endpoint).Add(code, 1)
+	m.requestSeconds.AddFloat(endpoint, elapsed.Seconds())
+}
+
+// IncRetry implements Metrics
+func (m *ExpvarMetrics) IncRetry(endpoint string) {
+	m.retries.Add(endpoint, 1)
+}
+
+// IncWebhook implements Metrics
+func (m *ExpvarMetrics) IncWebhook(outcome WebhookOutcome) {
+	m.webhooks.Add(string(outcome), 1)
+}
+
+// endpointMap returns the per-code request counts of an endpoint, creating it if needed
+func (m *ExpvarMetrics) endpointMap(endpoint string) *expvar.Map {
+	if v, ok := m.requests.Get(endpoint).(*expvar.Map); ok {
+		return v
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if v, ok := m.requests.Get(endpoint).(*expvar.Map); ok {
+		return v
+	}
+	v := new(expvar.Map).Init()
+	m.requests.Set(endpoint, v)
+	return v
+}
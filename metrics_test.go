@@ -0,0 +1,189 @@
+package sagapay_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/halfindex/sagapay-go-sdk"
+	"github.com/halfindex/sagapay-go-sdk/sagapaytest"
+)
+
+// recordingMetrics records what is reported to it
+type recordingMetrics struct {
+	mu       sync.Mutex
+	requests []string
+	retries  []string
+	webhooks []sagapay.WebhookOutcome
+}
+
+func (m *recordingMetrics) ObserveRequest(endpoint, code string, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, endpoint+":"+code)
+}
+
+func (m *recordingMetrics) IncRetry(endpoint string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retries = append(m.retries, endpoint)
+}
+
+func (m *recordingMetrics) IncWebhook(outcome sagapay.WebhookOutcome) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.webhooks = append(m.webhooks, outcome)
+}
+
+func TestMetricsCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, "ok"},
+		{&sagapay.APIError{ErrorCode: "INSUFFICIENT_FUNDS", StatusCode: 400}, "INSUFFICIENT_FUNDS"},
+		{&sagapay.APIError{ErrorCode: "invalid_address", StatusCode: 400}, "INVALID_ADDRESS"},
+		{&sagapay.APIError{ErrorCode: "VALIDATION_ERROR", StatusCode: 400}, "VALIDATION_ERROR"},
+		{&sagapay.APIError{ErrorCode: "ORDER_12345_REJECTED", StatusCode: 400}, "other"},
+		{&sagapay.APIError{StatusCode: 503}, "http_503"},
+		{fmt.Errorf("wrapped: %w", &sagapay.APIError{ErrorCode: "something new"}), "other"},
+		{&sagapay.ValidationError{}, "validation"},
+		{sagapay.ErrRateLimitWait, "throttled"},
+		{context.DeadlineExceeded, "timeout"},
+		{os.ErrDeadlineExceeded, "timeout"},
+		{context.Canceled, "canceled"},
+		{errors.New("connection refused"), "network"},
+	}
+	for _, tt := range tests {
+		if got := sagapay.MetricsCode(tt.err); got != tt.want {
+			t.Errorf("MetricsCode(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestClientMetrics(t *testing.T) {
+	srv := sagapaytest.NewServer(sagapaytest.Config{})
+	defer srv.Close()
+	metrics := &recordingMetrics{}
+	config := srv.ClientConfig()
+	config.Metrics = metrics
+	config.RetryPolicy = &sagapay.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	client, err := sagapay.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.FailNext("/create-deposit", http.StatusServiceUnavailable)
+	if _, err := client.CreateDeposit(context.Background(), depositParams("order-1")); err != nil {
+		t.Fatal(err)
+	}
+	// The fake server's INJECTED_FAILURE code is not one the SDK knows
+	srv.FailNext("/check-transaction-status", http.StatusBadRequest)
+	client.CheckTransactionStatus(context.Background(), "0xabc", sagapay.TransactionTypeDeposit)
+
+	want := []string{
+		sagapay.EndpointCreateDeposit + ":ok",
+		sagapay.EndpointCheckTransactionStatus + ":other",
+	}
+	if got := strings.Join(metrics.requests, ","); got != strings.Join(want, ",") {
+		t.Errorf("requests = %s, want %s", got, strings.Join(want, ","))
+	}
+	if len(metrics.retries) != 1 || metrics.retries[0] != sagapay.EndpointCreateDeposit {
+		t.Errorf("retries = %q, want one for %s", metrics.retries, sagapay.EndpointCreateDeposit)
+	}
+}
+
+func TestWebhookMetrics(t *testing.T) {
+	metrics := &recordingMetrics{}
+	handler := sagapay.NewWebhookHandler("secret").
+		SetMetrics(metrics).
+		SetTolerance(time.Hour).
+		SetDedupStore(sagapay.NewMemoryDedupStore(10)).
+		OnDepositFailed(func(ctx context.Context, payload *sagapay.WebhookPayload) error {
+			return errors.New("handler failed")
+		})
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	completed := `{"id":"tx-1","type":"deposit","status":"COMPLETED","timestamp":"` + now + `"}`
+	failed := `{"id":"tx-2","type":"deposit","status":"FAILED","timestamp":"` + now + `"}`
+	stale := `{"id":"tx-3","type":"deposit","status":"COMPLETED","timestamp":"2020-01-01T00:00:00Z"}`
+	deliveries := []struct{ body, signature string }{
+		{completed, webhookSignature("secret", completed)},
+		{completed, webhookSignature("secret", completed)},
+		{failed, webhookSignature("secret", failed)},
+		{stale, webhookSignature("secret", stale)},
+		{completed, webhookSignature("other", completed)},
+		{`{"id":`, webhookSignature("secret", `{"id":`)},
+	}
+	for _, d := range deliveries {
+		r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(d.body))
+		r.Header.Set(sagapay.SignatureHeader, d.signature)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	want := []sagapay.WebhookOutcome{
+		sagapay.WebhookAccepted,
+		sagapay.WebhookDuplicate,
+		sagapay.WebhookHandlerError,
+		sagapay.WebhookStale,
+		sagapay.WebhookBadSignature,
+		sagapay.WebhookParseError,
+	}
+	if fmt.Sprint(metrics.webhooks) != fmt.Sprint(want) {
+		t.Errorf("webhooks = %v, want %v", metrics.webhooks, want)
+	}
+}
+
+// webhookSignature returns the webhook signature of body under secret
+func webhookSignature(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// expvarString returns the JSON value of a published expvar variable
+func expvarString(t *testing.T, name string) string {
+	t.Helper()
+	v := expvar.Get(name)
+	if v == nil {
+		t.Fatalf("%s is not published", name)
+	}
+	return v.String()
+}
+
+// expvarRuns counts the runs of TestExpvarMetrics
+var expvarRuns int
+
+func TestExpvarMetrics(t *testing.T) {
+	// expvar names can only be published once per process, even with -count
+	expvarRuns++
+	prefix := fmt.Sprintf("sagapay_test_%d", expvarRuns)
+	metrics := sagapay.NewExpvarMetrics(prefix)
+	metrics.ObserveRequest(sagapay.EndpointCreateDeposit, "ok", time.Second)
+	metrics.ObserveRequest(sagapay.EndpointCreateDeposit, "ok", time.Second)
+	metrics.ObserveRequest(sagapay.EndpointCreateDeposit, "other", time.Second)
+	metrics.IncRetry(sagapay.EndpointCreateDeposit)
+	metrics.IncWebhook(sagapay.WebhookAccepted)
+
+	got := expvarString(t, prefix+".requests")
+	if want := `{"` + sagapay.EndpointCreateDeposit + `": {"ok": 2, "other": 1}}`; got != want {
+		t.Errorf("requests = %s, want %s", got, want)
+	}
+	if got := expvarString(t, prefix+".request_seconds"); got != `{"`+sagapay.EndpointCreateDeposit+`": 3}` {
+		t.Errorf("request_seconds = %s", got)
+	}
+	if got := expvarString(t, prefix+".webhooks"); got != `{"accepted": 1}` {
+		t.Errorf("webhooks = %s", got)
+	}
+}
@@ -0,0 +1,155 @@
+package sagapay
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// API endpoint names, as reported in Call.Endpoint
+const (
+	EndpointCreateDeposit          = "create-deposit"
+	EndpointCreateWithdrawal       = "create-withdrawal"
+	EndpointCheckTransactionStatus = "check-transaction-status"
+	EndpointFetchWalletBalance     = "fetch-wallet-balance"
+)
+
+// RequestIDHeader is the request header RequestIDMiddleware sends the request ID in
+const RequestIDHeader = "X-Request-Id"
+
+// Call is a single API call as seen by middleware. Middleware may inspect
+// Params and add headers before calling the next Doer, and inspect Response
+// and the returned error afterwards.
+type Call struct {
+	// Endpoint is the endpoint name, e.g. EndpointCreateDeposit
+	Endpoint string
+
+	// Method is the HTTP method
+	Method string
+
+	// Params are the typed parameters of the call: CreateDepositParams,
+	// CreateWithdrawalParams, TransactionStatusParams or WalletBalanceParams.
+	// They are a copy for inspection: the params sent are the ones the client
+	// validated and checked against its WithdrawalPolicy, so replacing Params
+	// has no effect.
+	Params interface{}
+
+	// Response points to the typed response the call decodes into, e.g.
+	// *DepositResponse. It is only populated when the call succeeds.
+	Response interface{}
+
+	// Header holds extra headers sent with every attempt. They override the
+	// SDK's own headers, including the credential headers.
+	Header http.Header
+
+	// StatusCode is the HTTP status code of the final attempt
+	StatusCode int
+
+	// ResponseHeader holds the headers of the final response
+	ResponseHeader http.Header
+
+	// RequestID is the request ID echoed by the API, or the one sent with the request
+	RequestID string
+
+	// Attempts is the number of HTTP attempts made, including retries
+	Attempts int
+
+	// params are the params sent, out of reach of middleware
+	params interface{}
+}
+
+// Doer performs an API call
+type Doer interface {
+	Do(ctx context.Context, call *Call) error
+}
+
+// DoerFunc adapts a function to the Doer interface
+type DoerFunc func(ctx context.Context, call *Call) error
+
+// Do calls f(ctx, call)
+func (f DoerFunc) Do(ctx context.Context, call *Call) error {
+	return f(ctx, call)
+}
+
+// Middleware wraps a Doer to add behavior around every API call. Middleware
+// runs once per call; retries happen inside the innermost Doer.
+type Middleware func(next Doer) Doer
+
+// chain wraps d with middleware so that the first middleware is the outermost
+func chain(d Doer, middleware []Middleware) Doer {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		d = middleware[i](d)
+	}
+	return d
+}
+
+// LoggingMiddleware logs every call with its outcome, duration, attempts and
+// request ID. logf is typically log.Printf.
+func LoggingMiddleware(logf func(format string, v ...interface{})) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(ctx context.Context, call *Call) error {
+			start := time.Now()
+			err := next.Do(ctx, call)
+			elapsed := time.Since(start)
+
+			if err != nil {
+				logf("sagapay: %s %s failed after %s (attempts %d, request id %q): %v",
+					call.Method, call.Endpoint, elapsed, call.Attempts, call.RequestID, err)
+			} else {
+				logf("sagapay: %s %s %d in %s (attempts %d, request id %q)",
+					call.Method, call.Endpoint, call.StatusCode, elapsed, call.Attempts, call.RequestID)
+			}
+			return err
+		})
+	}
+}
+
+// TimingMiddleware reports the duration of every call, including retries, to observe
+func TimingMiddleware(observe func(endpoint string, elapsed time.Duration, err error)) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(ctx context.Context, call *Call) error {
+			start := time.Now()
+			err := next.Do(ctx, call)
+			observe(call.Endpoint, time.Since(start), err)
+			return err
+		})
+	}
+}
+
+// requestIDKey is the context key for the request ID
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a context carrying a request ID for RequestIDMiddleware to send
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, if any
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDMiddleware sends a request ID in the X-Request-Id header of every
+// call, so it can be correlated with your own logs and SagaPay support. The ID
+// is taken from the context (see ContextWithRequestID) or generated, and all
+// attempts of a call share it.
+func RequestIDMiddleware() Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(ctx context.Context, call *Call) error {
+			id := RequestIDFromContext(ctx)
+			if id == "" {
+				id = NewIdempotencyKey()
+			}
+			if call.Header.Get(RequestIDHeader) == "" {
+				call.Header.Set(RequestIDHeader, id)
+			}
+
+			err := next.Do(ctx, call)
+			if call.RequestID == "" {
+				call.RequestID = call.Header.Get(RequestIDHeader)
+			}
+			return err
+		})
+	}
+}
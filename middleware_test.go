@@ -0,0 +1,135 @@
+package sagapay_test
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/halfindex/sagapay-go-sdk"
+	"github.com/halfindex/sagapay-go-sdk/sagapaytest"
+)
+
+// tagMiddleware records when it runs before and after the next Doer
+func tagMiddleware(name string, trace *[]string) sagapay.Middleware {
+	return func(next sagapay.Doer) sagapay.Doer {
+		return sagapay.DoerFunc(func(ctx context.Context, call *sagapay.Call) error {
+			*trace = append(*trace, name+" before")
+			err := next.Do(ctx, call)
+			*trace = append(*trace, name+" after")
+			return err
+		})
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	srv := sagapaytest.NewServer(sagapaytest.Config{})
+	defer srv.Close()
+
+	var trace []string
+	var last *sagapay.Call
+	config := srv.ClientConfig()
+	config.RetryPolicy = &sagapay.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	config.Middleware = []sagapay.Middleware{
+		tagMiddleware("outer", &trace),
+		tagMiddleware("inner", &trace),
+		func(next sagapay.Doer) sagapay.Doer {
+			return sagapay.DoerFunc(func(ctx context.Context, call *sagapay.Call) error {
+				err := next.Do(ctx, call)
+				last = call
+				return err
+			})
+		},
+	}
+	client, err := sagapay.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Retries happen inside the chain, so middleware runs once per call
+	srv.FailNext("/create-deposit", http.StatusServiceUnavailable)
+	deposit, err := client.CreateDeposit(context.Background(), depositParams("order-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"outer before", "inner before", "inner after", "outer after"}; !reflect.DeepEqual(trace, want) {
+		t.Errorf("trace = %q, want %q", trace, want)
+	}
+	if last.Endpoint != sagapay.EndpointCreateDeposit || last.Method != http.MethodPost ||
+		last.Attempts != 2 || last.StatusCode != http.StatusOK {
+		t.Errorf("call = %+v", last)
+	}
+	if resp, ok := last.Response.(*sagapay.DepositResponse); !ok || resp.Address != deposit.Address {
+		t.Errorf("call.Response = %#v, want the deposit", last.Response)
+	}
+}
+
+func TestMiddlewareCannotReplaceParams(t *testing.T) {
+	srv := sagapaytest.NewServer(sagapaytest.Config{})
+	defer srv.Close()
+
+	config := srv.ClientConfig()
+	config.Middleware = []sagapay.Middleware{
+		func(next sagapay.Doer) sagapay.Doer {
+			return sagapay.DoerFunc(func(ctx context.Context, call *sagapay.Call) error {
+				params := call.Params.(sagapay.CreateWithdrawalParams)
+				params.Address = "0x000000000000000000000000000000000000dEaD"
+				params.Amount = "1000000"
+				call.Params = params
+				return next.Do(ctx, call)
+			})
+		},
+	}
+	client, err := sagapay.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	destination := "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+	if _, err := client.CreateWithdrawal(context.Background(), sagapay.CreateWithdrawalParams{
+		NetworkType:     sagapay.NetworkTypeBEP20,
+		ContractAddress: sagapay.NativeContractAddress,
+		Address:         destination,
+		Amount:          "10",
+		IPNUrl:          "https://example.com/ipn",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	txs := srv.Transactions()
+	if len(txs) != 1 || txs[0].Address != destination || txs[0].Amount != "10" {
+		t.Errorf("server transactions = %+v, want 10 to %s", txs, destination)
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	srv := sagapaytest.NewServer(sagapaytest.Config{})
+	defer srv.Close()
+
+	var ids []string
+	config := srv.ClientConfig()
+	config.Middleware = []sagapay.Middleware{
+		func(next sagapay.Doer) sagapay.Doer {
+			return sagapay.DoerFunc(func(ctx context.Context, call *sagapay.Call) error {
+				err := next.Do(ctx, call)
+				ids = append(ids, call.RequestID)
+				return err
+			})
+		},
+		sagapay.RequestIDMiddleware(),
+	}
+	client, err := sagapay.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := sagapay.ContextWithRequestID(context.Background(), "req-1")
+	client.CheckTransactionStatus(ctx, "0xabc", sagapay.TransactionTypeDeposit)
+	client.CheckTransactionStatus(context.Background(), "0xabc", sagapay.TransactionTypeDeposit)
+
+	if len(ids) != 2 || ids[0] != "req-1" || ids[1] == "" || ids[1] == "req-1" {
+		t.Errorf("request IDs = %q, want req-1 then a generated ID", ids)
+	}
+}
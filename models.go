@@ -3,6 +3,7 @@ package sagapay
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"time"
 )
 
@@ -18,6 +19,17 @@ const (
 	NetworkTypeSOLANA  NetworkType = "SOLANA"
 )
 
+// validateNetworkType checks that a network type is given and known to the SDK
+func validateNetworkType(verr *ValidationError, network NetworkType) {
+	switch network {
+	case "":
+		verr.add("networkType", "is required")
+	case NetworkTypeERC20, NetworkTypeBEP20, NetworkTypeTRC20, NetworkTypePOLYGON, NetworkTypeSOLANA:
+	default:
+		verr.addErr("networkType", fmt.Errorf("%w: %q", ErrUnsupportedNetwork, network))
+	}
+}
+
 // TransactionType represents the type of transaction
 type TransactionType string
 
@@ -50,29 +62,40 @@ const (
 
 // CreateDepositParams represents the parameters for creating a deposit
 type CreateDepositParams struct {
-	NetworkType    NetworkType `json:"networkType"`
+	NetworkType     NetworkType `json:"networkType"`
 	ContractAddress string      `json:"contractAddress"`
-	Amount         string      `json:"amount"`
-	IPNUrl         string      `json:"ipnUrl"`
-	UDF            string      `json:"udf,omitempty"`
-	Type           AddressType `json:"type,omitempty"`
+	Amount          string      `json:"amount"`
+	IPNUrl          string      `json:"ipnUrl"`
+	UDF             string      `json:"udf,omitempty"`
+	Type            AddressType `json:"type,omitempty"`
+
+	// IdempotencyKey is sent in the Idempotency-Key header. Generated if empty.
+	IdempotencyKey string `json:"-"`
 }
 
+func (p CreateDepositParams) idempotencyKey() string { return p.IdempotencyKey }
+
 // Validate validates the create deposit parameters
 func (p *CreateDepositParams) Validate() error {
-	if p.NetworkType == "" {
-		return errors.New("networkType is required")
-	}
+	verr := &ValidationError{}
+
+	validateNetworkType(verr, p.NetworkType)
 	if p.ContractAddress == "" {
-		return errors.New("contractAddress is required")
+		verr.add("contractAddress", "is required")
+	} else if err := ValidateContractAddress(p.NetworkType, p.ContractAddress); err != nil && !errors.Is(err, ErrUnsupportedNetwork) {
+		verr.addErr("contractAddress", err)
 	}
 	if p.Amount == "" {
-		return errors.New("amount is required")
+		verr.add("amount", "is required")
+	} else if amount, err := ParseAmount(p.Amount); err != nil {
+		verr.add("amount", "must be a non-negative decimal number")
+	} else if amount.IsZero() {
+		verr.add("amount", "must be greater than zero")
 	}
 	if p.IPNUrl == "" {
-		return errors.New("ipnUrl is required")
+		verr.add("ipnUrl", "is required")
 	}
-	return nil
+	return verr.err()
 }
 
 // CreateWithdrawalParams represents the parameters for creating a withdrawal
@@ -83,26 +106,39 @@ type CreateWithdrawalParams struct {
 	Amount          string      `json:"amount"`
 	IPNUrl          string      `json:"ipnUrl"`
 	UDF             string      `json:"udf,omitempty"`
+
+	// IdempotencyKey is sent in the Idempotency-Key header. Generated if empty.
+	IdempotencyKey string `json:"-"`
 }
 
+func (p CreateWithdrawalParams) idempotencyKey() string { return p.IdempotencyKey }
+
 // Validate validates the create withdrawal parameters
 func (p *CreateWithdrawalParams) Validate() error {
-	if p.NetworkType == "" {
-		return errors.New("networkType is required")
-	}
+	verr := &ValidationError{}
+
+	validateNetworkType(verr, p.NetworkType)
 	if p.ContractAddress == "" {
-		return errors.New("contractAddress is required")
+		verr.add("contractAddress", "is required")
+	} else if err := ValidateContractAddress(p.NetworkType, p.ContractAddress); err != nil && !errors.Is(err, ErrUnsupportedNetwork) {
+		verr.addErr("contractAddress", err)
 	}
 	if p.Address == "" {
-		return errors.New("address is required")
+		verr.add("address", "is required")
+	} else if err := ValidateAddress(p.NetworkType, p.Address); err != nil && !errors.Is(err, ErrUnsupportedNetwork) {
+		verr.addErr("address", err)
 	}
 	if p.Amount == "" {
-		return errors.New("amount is required")
+		verr.add("amount", "is required")
+	} else if amount, err := ParseAmount(p.Amount); err != nil {
+		verr.add("amount", "must be a non-negative decimal number")
+	} else if amount.IsZero() {
+		verr.add("amount", "must be greater than zero")
 	}
 	if p.IPNUrl == "" {
-		return errors.New("ipnUrl is required")
+		verr.add("ipnUrl", "is required")
 	}
-	return nil
+	return verr.err()
 }
 
 // DepositResponse represents the response from creating a deposit
@@ -112,6 +148,9 @@ type DepositResponse struct {
 	ExpiresAt time.Time         `json:"expiresAt"`
 	Amount    string            `json:"amount"`
 	Status    TransactionStatus `json:"status"`
+
+	// IdempotencyKey is the key the deposit was created with
+	IdempotencyKey string `json:"-"`
 }
 
 // WithdrawalResponse represents the response from creating a withdrawal
@@ -119,6 +158,9 @@ type WithdrawalResponse struct {
 	ID     string            `json:"id"`
 	Status TransactionStatus `json:"status"`
 	Fee    string            `json:"fee"`
+
+	// IdempotencyKey is the key the withdrawal was created with
+	IdempotencyKey string `json:"-"`
 }
 
 // Token represents a cryptocurrency token
@@ -145,12 +187,44 @@ type Transaction struct {
 	Token           Token             `json:"token"`
 }
 
+// TransactionStatusParams represents the parameters for checking transaction status
+type TransactionStatusParams struct {
+	Address         string
+	TransactionType TransactionType
+}
+
+// query returns the query parameters of the request
+func (p TransactionStatusParams) query() url.Values {
+	q := url.Values{}
+	q.Add("address", p.Address)
+	q.Add("type", string(p.TransactionType))
+	return q
+}
+
+// WalletBalanceParams represents the parameters for fetching a wallet balance
+type WalletBalanceParams struct {
+	Address         string
+	NetworkType     NetworkType
+	ContractAddress string
+}
+
+// query returns the query parameters of the request
+func (p WalletBalanceParams) query() url.Values {
+	q := url.Values{}
+	q.Add("address", p.Address)
+	q.Add("networkType", string(p.NetworkType))
+	if p.ContractAddress != "" {
+		q.Add("contractAddress", p.ContractAddress)
+	}
+	return q
+}
+
 // TransactionStatusResponse represents the response from checking transaction status
 type TransactionStatusResponse struct {
-	Address         string        `json:"address"`
+	Address         string          `json:"address"`
 	TransactionType TransactionType `json:"transactionType"`
-	Count           int           `json:"count"`
-	Transactions    []Transaction `json:"transactions"`
+	Count           int             `json:"count"`
+	Transactions    []Transaction   `json:"transactions"`
 }
 
 // Balance represents a wallet balance
@@ -170,26 +244,13 @@ type WalletBalanceResponse struct {
 
 // WebhookPayload represents the payload sent in webhook notifications
 type WebhookPayload struct {
-	ID              string            `json:"id"`
-	Type            TransactionType   `json:"type"`
-	Status          TransactionStatus `json:"status"`
-	Address         string            `json:"address"`
-	NetworkType     NetworkType       `json:"networkType"`
-	Amount          string            `json:"amount"`
-	UDF             string            `json:"udf,omitempty"`
-	TxHash          string            `json:"txHash,omitempty"`
-	Timestamp       time.Time         `json:"timestamp"`
-}
-
-// APIError represents an error response from the API
-type APIError struct {
-	Error   string      `json:"error"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
-	Code    int         `json:"-"`
+	ID          string            `json:"id"`
+	Type        TransactionType   `json:"type"`
+	Status      TransactionStatus `json:"status"`
+	Address     string            `json:"address"`
+	NetworkType NetworkType       `json:"networkType"`
+	Amount      string            `json:"amount"`
+	UDF         string            `json:"udf,omitempty"`
+	TxHash      string            `json:"txHash,omitempty"`
+	Timestamp   time.Time         `json:"timestamp"`
 }
-
-// Error implements the error interface
-func (e *APIError) Error() string {
-	return fmt.Sprintf("API error: %s - %s", e.Error, e.Message)
-}
\ No newline at end of file
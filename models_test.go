@@ -0,0 +1,73 @@
+package sagapay
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCreateWithdrawalParamsValidate(t *testing.T) {
+	valid := CreateWithdrawalParams{
+		NetworkType:     NetworkTypeERC20,
+		ContractAddress: NativeContractAddress,
+		Address:         "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		Amount:          "1.5",
+		IPNUrl:          "https://example.com/ipn",
+	}
+	tests := []struct {
+		name   string
+		modify func(p *CreateWithdrawalParams)
+		field  string
+		is     error
+	}{
+		{"valid", func(p *CreateWithdrawalParams) {}, "", nil},
+		{"missing network", func(p *CreateWithdrawalParams) { p.NetworkType = "" }, "networkType", nil},
+		{"unsupported network", func(p *CreateWithdrawalParams) { p.NetworkType = "DOGE" }, "networkType", ErrUnsupportedNetwork},
+		{"bad checksum", func(p *CreateWithdrawalParams) { p.Address = "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD" }, "address", ErrInvalidAddress},
+		{"TRON address on ERC20", func(p *CreateWithdrawalParams) { p.Address = "TJRabPrwbZy45sbavfcjinPJC18kjpRTv8" }, "address", ErrInvalidAddress},
+		{"bad contract", func(p *CreateWithdrawalParams) { p.ContractAddress = "0x1234" }, "contractAddress", ErrInvalidAddress},
+		{"zero amount", func(p *CreateWithdrawalParams) { p.Amount = "0" }, "amount", nil},
+		{"negative amount", func(p *CreateWithdrawalParams) { p.Amount = "-1" }, "amount", nil},
+		{"missing IPN URL", func(p *CreateWithdrawalParams) { p.IPNUrl = "" }, "ipnUrl", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := valid
+			tt.modify(&params)
+			err := params.Validate()
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("Validate = %v, want nil", err)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Validate = %v, want a *ValidationError", err)
+			}
+			if len(verr.Fields) != 1 {
+				t.Errorf("fields = %v, want only %s", verr.Fields, tt.field)
+			}
+			field := verr.Field(tt.field)
+			if field == nil {
+				t.Fatalf("Validate = %v, want an error for %s", err, tt.field)
+			}
+			if tt.is != nil && !errors.Is(err, tt.is) {
+				t.Errorf("Validate = %v, want it to match %v", err, tt.is)
+			}
+		})
+	}
+}
+
+func TestCreateDepositParamsValidateNetwork(t *testing.T) {
+	params := CreateDepositParams{
+		NetworkType:     "BITCOIN",
+		ContractAddress: NativeContractAddress,
+		Amount:          "10",
+		IPNUrl:          "https://example.com/ipn",
+	}
+	err := params.Validate()
+	if !errors.Is(err, ErrUnsupportedNetwork) || !errors.Is(err, ErrValidation) {
+		t.Fatalf("Validate = %v, want ErrValidation and ErrUnsupportedNetwork", err)
+	}
+}
@@ -0,0 +1,264 @@
+package sagapay
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidPaymentURI is returned when a payment URI cannot be parsed
+var ErrInvalidPaymentURI = errors.New("sagapay: invalid payment URI")
+
+// chainIDs are the EIP-155 chain IDs of the EVM networks
+var chainIDs = map[NetworkType]int64{
+	NetworkTypeERC20:   1,
+	NetworkTypeBEP20:   56,
+	NetworkTypePOLYGON: 137,
+}
+
+// ChainID returns the EIP-155 chain ID of an EVM network
+func ChainID(network NetworkType) (int64, bool) {
+	id, ok := chainIDs[network]
+	return id, ok
+}
+
+// PaymentRequest is a request to pay an amount of a token to an address, as
+// encoded in a wallet payment URI
+type PaymentRequest struct {
+	NetworkType NetworkType
+
+	// Recipient is the address to pay
+	Recipient string
+
+	// ContractAddress is the token contract (SPL mint on Solana), or
+	// NativeContractAddress for the network's native coin
+	ContractAddress string
+
+	// Amount is the amount to pay in display units; zero leaves it to the payer
+	Amount Amount
+}
+
+// PaymentURI returns a wallet payment URI for the deposit (see
+// PaymentRequest.URI). The API's deposit response carries neither the
+// network, the contract address nor the token's decimals, and an EIP-681
+// amount cannot be written without the decimals, so the token the deposit was
+// created for is passed in rather than guessed; pass the Token of a
+// transaction or balance response, or of the invoice, to avoid a hand-kept table.
+func (r DepositResponse) PaymentURI(token Token) (string, error) {
+	request := PaymentRequest{
+		NetworkType:     token.NetworkType,
+		Recipient:       r.Address,
+		ContractAddress: token.ContractAddress,
+	}
+	if r.Amount != "" {
+		amount, err := token.ParseAmount(r.Amount)
+		if err != nil {
+			return "", err
+		}
+		request.Amount = amount
+	}
+	return request.URI(token.Decimals)
+}
+
+// URI encodes the payment request in the standard URI format of its network:
+//
+//	ERC20, BEP20, POLYGON  EIP-681, with the amount in base units:
+//	                       ethereum:<recipient>@<chain id>?value=<wei>
+//	                       ethereum:<token>@<chain id>/transfer?address=<recipient>&uint256=<units>
+//	SOLANA                 Solana Pay: solana:<recipient>?amount=<amount>&spl-token=<mint>
+//	TRC20                  tron:<recipient>?amount=<amount>&token=<contract>
+//
+// Addresses are validated and the amount must fit the token's decimals.
+func (p PaymentRequest) URI(decimals int) (string, error) {
+	if err := ValidateAddress(p.NetworkType, p.Recipient); err != nil {
+		return "", err
+	}
+	native := p.ContractAddress == "" || p.ContractAddress == NativeContractAddress
+	if !native {
+		if err := ValidateAddress(p.NetworkType, p.ContractAddress); err != nil {
+			return "", fmt.Errorf("token contract: %w", err)
+		}
+	}
+
+	var units *big.Int
+	if !p.Amount.IsZero() {
+		var err error
+		if units, err = p.Amount.BaseUnits(decimals); err != nil {
+			return "", err
+		}
+	}
+
+	switch p.NetworkType {
+	case NetworkTypeERC20, NetworkTypeBEP20, NetworkTypePOLYGON:
+		chainID := chainIDs[p.NetworkType]
+		if native {
+			uri := fmt.Sprintf("ethereum:%s@%d", p.Recipient, chainID)
+			if units != nil {
+				uri += "?value=" + units.String()
+			}
+			return uri, nil
+		}
+		uri := fmt.Sprintf("ethereum:%s@%d/transfer?address=%s", p.ContractAddress, chainID, p.Recipient)
+		if units != nil {
+			uri += "&uint256=" + units.String()
+		}
+		return uri, nil
+
+	case NetworkTypeSOLANA, NetworkTypeTRC20:
+		scheme, tokenParam := "solana", "spl-token"
+		if p.NetworkType == NetworkTypeTRC20 {
+			scheme, tokenParam = "tron", "token"
+		}
+		query := make([]string, 0, 2)
+		if !p.Amount.IsZero() {
+			query = append(query, "amount="+p.Amount.String())
+		}
+		if !native {
+			query = append(query, tokenParam+"="+p.ContractAddress)
+		}
+		uri := scheme + ":" + p.Recipient
+		if len(query) > 0 {
+			uri += "?" + strings.Join(query, "&")
+		}
+		return uri, nil
+
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedNetwork, p.NetworkType)
+	}
+}
+
+// ParsePaymentURI parses a payment URI in one of the formats produced by
+// PaymentRequest.URI. decimals converts EIP-681 base-unit amounts back to
+// display units. EIP-681 URIs without a chain ID are taken to be Ethereum
+// mainnet, and amounts in scientific notation are accepted.
+func ParsePaymentURI(uri string, decimals int) (*PaymentRequest, error) {
+	scheme, rest, ok := strings.Cut(uri, ":")
+	if !ok {
+		return nil, fmt.Errorf("%w: missing scheme", ErrInvalidPaymentURI)
+	}
+	target, rawQuery, _ := strings.Cut(rest, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPaymentURI, err)
+	}
+
+	var request *PaymentRequest
+	switch strings.ToLower(scheme) {
+	case "ethereum":
+		request, err = parseEIP681(target, query, decimals)
+	case "solana":
+		request, err = parseAmountURI(NetworkTypeSOLANA, target, query, "spl-token", decimals)
+	case "tron":
+		request, err = parseAmountURI(NetworkTypeTRC20, target, query, "token", decimals)
+	default:
+		return nil, fmt.Errorf("%w: unsupported scheme %q", ErrInvalidPaymentURI, scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ValidateAddress(request.NetworkType, request.Recipient); err != nil {
+		return nil, fmt.Errorf("%w: recipient: %w", ErrInvalidPaymentURI, err)
+	}
+	if request.ContractAddress != NativeContractAddress {
+		if err := ValidateAddress(request.NetworkType, request.ContractAddress); err != nil {
+			return nil, fmt.Errorf("%w: token contract: %w", ErrInvalidPaymentURI, err)
+		}
+	}
+	return request, nil
+}
+
+// parseEIP681 parses the target and parameters of an ethereum: URI
+func parseEIP681(target string, query url.Values, decimals int) (*PaymentRequest, error) {
+	target = strings.TrimPrefix(target, "pay-")
+	target, function, _ := strings.Cut(target, "/")
+	address, rawChainID, hasChainID := strings.Cut(target, "@")
+
+	chainID := int64(1)
+	if hasChainID {
+		var err error
+		if chainID, err = strconv.ParseInt(rawChainID, 10, 64); err != nil {
+			return nil, fmt.Errorf("%w: invalid chain ID %q", ErrInvalidPaymentURI, rawChainID)
+		}
+	}
+	request := &PaymentRequest{}
+	for network, id := range chainIDs {
+		if id == chainID {
+			request.NetworkType = network
+		}
+	}
+	if request.NetworkType == "" {
+		return nil, fmt.Errorf("%w: chain ID %d", ErrUnsupportedNetwork, chainID)
+	}
+
+	var rawUnits string
+	switch function {
+	case "":
+		request.Recipient = address
+		request.ContractAddress = NativeContractAddress
+		rawUnits = query.Get("value")
+	case "transfer":
+		request.Recipient = query.Get("address")
+		request.ContractAddress = address
+		rawUnits = query.Get("uint256")
+	default:
+		return nil, fmt.Errorf("%w: unsupported function %q", ErrInvalidPaymentURI, function)
+	}
+
+	if rawUnits != "" {
+		units, err := parseEIP681Number(rawUnits)
+		if err != nil {
+			return nil, err
+		}
+		if request.Amount, err = NewAmountFromBaseUnits(units, decimals); err != nil {
+			return nil, err
+		}
+	}
+	return request, nil
+}
+
+// parseEIP681Number parses an EIP-681 integer amount, which may use
+// scientific notation such as 2.014e18
+func parseEIP681Number(s string) (*big.Int, error) {
+	mantissa, rawExp, hasExp := strings.Cut(strings.ToLower(s), "e")
+	exp := 0
+	if hasExp {
+		var err error
+		if exp, err = strconv.Atoi(rawExp); err != nil || exp < 0 || exp > MaxDecimals {
+			return nil, fmt.Errorf("%w: invalid amount %q", ErrInvalidPaymentURI, s)
+		}
+	}
+
+	m, err := ParseAmount(mantissa)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid amount %q", ErrInvalidPaymentURI, s)
+	}
+	units, err := m.BaseUnits(exp)
+	if err != nil {
+		return nil, fmt.Errorf("%w: amount %q is not a whole number of base units", ErrInvalidPaymentURI, s)
+	}
+	return units, nil
+}
+
+// parseAmountURI parses a Solana Pay or TRON URI, which carry the amount in display units
+func parseAmountURI(network NetworkType, target string, query url.Values, tokenParam string, decimals int) (*PaymentRequest, error) {
+	request := &PaymentRequest{
+		NetworkType:     network,
+		Recipient:       target,
+		ContractAddress: NativeContractAddress,
+	}
+	if token := query.Get(tokenParam); token != "" {
+		request.ContractAddress = token
+	}
+	if raw := query.Get("amount"); raw != "" {
+		amount, err := ParseAmountDecimals(raw, decimals)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidPaymentURI, err)
+		}
+		request.Amount = amount
+	}
+	return request, nil
+}
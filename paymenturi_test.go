@@ -0,0 +1,152 @@
+package sagapay
+
+import (
+	"errors"
+	"testing"
+)
+
+// samePaymentRequest reports whether two requests are equal, comparing amounts by value
+func samePaymentRequest(a, b PaymentRequest) bool {
+	return a.NetworkType == b.NetworkType && a.Recipient == b.Recipient &&
+		a.ContractAddress == b.ContractAddress && a.Amount.Cmp(b.Amount) == 0
+}
+
+func TestPaymentURIRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  PaymentRequest
+		decimals int
+		want     string
+	}{
+		{
+			"ERC20 token transfer",
+			PaymentRequest{NetworkTypeERC20, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "0xdAC17F958D2ee523a2206206994597C13D831ec7", MustParseAmount("1.5")},
+			6,
+			"ethereum:0xdAC17F958D2ee523a2206206994597C13D831ec7@1/transfer?address=0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed&uint256=1500000",
+		},
+		{
+			"BEP20 token transfer",
+			PaymentRequest{NetworkTypeBEP20, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "0x55d398326f99059fF775485246999027B3197955", MustParseAmount("25")},
+			18,
+			"ethereum:0x55d398326f99059fF775485246999027B3197955@56/transfer?address=0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed&uint256=25000000000000000000",
+		},
+		{
+			"native EVM",
+			PaymentRequest{NetworkTypeBEP20, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", NativeContractAddress, MustParseAmount("0.25")},
+			18,
+			"ethereum:0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed@56?value=250000000000000000",
+		},
+		{
+			"native EVM without amount",
+			PaymentRequest{NetworkTypePOLYGON, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", NativeContractAddress, Amount{}},
+			18,
+			"ethereum:0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed@137",
+		},
+		{
+			"Solana Pay spl-token",
+			PaymentRequest{NetworkTypeSOLANA, "9WzDXwBbmkg8ZTbNMqUxvQRAyrZzDsGYdLVL9zYtAWWM", "Es9vMFrzaCERmJfrF4H2FYD4KCoNkY11McCe8BenwNYB", MustParseAmount("10.25")},
+			6,
+			"solana:9WzDXwBbmkg8ZTbNMqUxvQRAyrZzDsGYdLVL9zYtAWWM?amount=10.25&spl-token=Es9vMFrzaCERmJfrF4H2FYD4KCoNkY11McCe8BenwNYB",
+		},
+		{
+			"Solana Pay native",
+			PaymentRequest{NetworkTypeSOLANA, "9WzDXwBbmkg8ZTbNMqUxvQRAyrZzDsGYdLVL9zYtAWWM", NativeContractAddress, MustParseAmount("0.000000001")},
+			9,
+			"solana:9WzDXwBbmkg8ZTbNMqUxvQRAyrZzDsGYdLVL9zYtAWWM?amount=0.000000001",
+		},
+		{
+			"TRON token",
+			PaymentRequest{NetworkTypeTRC20, "TLa2f6VPqDgRE67v1736s7bJ8Ray5wYjU7", "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", MustParseAmount("100")},
+			6,
+			"tron:TLa2f6VPqDgRE67v1736s7bJ8Ray5wYjU7?amount=100&token=TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t",
+		},
+		{
+			"TRON native without amount",
+			PaymentRequest{NetworkTypeTRC20, "TLa2f6VPqDgRE67v1736s7bJ8Ray5wYjU7", NativeContractAddress, Amount{}},
+			6,
+			"tron:TLa2f6VPqDgRE67v1736s7bJ8Ray5wYjU7",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uri, err := tt.request.URI(tt.decimals)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if uri != tt.want {
+				t.Errorf("URI = %s\nwant  %s", uri, tt.want)
+			}
+
+			parsed, err := ParsePaymentURI(uri, tt.decimals)
+			if err != nil {
+				t.Fatalf("ParsePaymentURI: %v", err)
+			}
+			if !samePaymentRequest(*parsed, tt.request) {
+				t.Errorf("ParsePaymentURI = %+v, want %+v", *parsed, tt.request)
+			}
+		})
+	}
+}
+
+func TestDepositPaymentURI(t *testing.T) {
+	deposit := DepositResponse{Address: "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", Amount: "1.5"}
+	usdt := Token{NetworkType: NetworkTypePOLYGON, ContractAddress: "0xc2132D05D31c914a87C6611C10748AEb04B58e8F", Decimals: 6}
+
+	uri, err := deposit.PaymentURI(usdt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "ethereum:0xc2132D05D31c914a87C6611C10748AEb04B58e8F@137/transfer?address=0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed&uint256=1500000"; uri != want {
+		t.Errorf("PaymentURI = %s, want %s", uri, want)
+	}
+
+	// The amount must fit the token's decimals
+	deposit.Amount = "1.0000001"
+	if _, err := deposit.PaymentURI(usdt); err == nil {
+		t.Error("PaymentURI accepted an amount finer than the token's decimals")
+	}
+}
+
+func TestParsePaymentURI(t *testing.T) {
+	recipient := "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+	tests := []struct {
+		name string
+		uri  string
+		want PaymentRequest
+	}{
+		{"no chain ID", "ethereum:" + recipient + "?value=1e18", PaymentRequest{NetworkTypeERC20, recipient, NativeContractAddress, MustParseAmount("1")}},
+		{"pay prefix", "ethereum:pay-" + recipient + "@137?value=2.5e17", PaymentRequest{NetworkTypePOLYGON, recipient, NativeContractAddress, MustParseAmount("0.25")}},
+		{"uppercase scheme", "ETHEREUM:" + recipient + "@56", PaymentRequest{NetworkTypeBEP20, recipient, NativeContractAddress, Amount{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePaymentURI(tt.uri, 18)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !samePaymentRequest(*got, tt.want) {
+				t.Errorf("ParsePaymentURI = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+
+	errs := []struct {
+		uri  string
+		want error
+	}{
+		{"no scheme", ErrInvalidPaymentURI},
+		{"bitcoin:1BoatSLRHtKNngkdXEeobR76b53LETtpyT", ErrInvalidPaymentURI},
+		{"ethereum:" + recipient + "@10", ErrUnsupportedNetwork},
+		{"ethereum:" + recipient + "@x", ErrInvalidPaymentURI},
+		{"ethereum:" + recipient + "/approve?address=" + recipient, ErrInvalidPaymentURI},
+		{"ethereum:" + recipient + "?value=1.5", ErrInvalidPaymentURI},
+		{"ethereum:0x5aaeb6053F3E94C9b9A09f33669435E7Ef1BeAed", ErrInvalidPaymentURI},
+		{"solana:9WzDXwBbmkg8ZTbNMqUxvQRAyrZzDsGYdLVL9zYtAWWM?amount=abc", ErrInvalidPaymentURI},
+		{"tron:TLa2f6VPqDgRE67v1736s7bJ8Ray5wYjU7?amount=1.1234567", ErrInvalidPaymentURI},
+	}
+	for _, tt := range errs {
+		if _, err := ParsePaymentURI(tt.uri, 6); !errors.Is(err, tt.want) {
+			t.Errorf("ParsePaymentURI(%q) = %v, want %v", tt.uri, err, tt.want)
+		}
+	}
+}
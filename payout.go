@@ -0,0 +1,487 @@
+package sagapay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PayoutStatus is the state of a payout in a PayoutQueue
+type PayoutStatus string
+
+// Payout statuses
+const (
+	// PayoutPending payouts are waiting for approvals
+	PayoutPending PayoutStatus = "PENDING"
+
+	// PayoutApproved payouts have their approvals but have not been accepted
+	// by the API yet, because submission failed in a way that may be
+	// retried: a timeout, a server error or throttling
+	PayoutApproved PayoutStatus = "APPROVED"
+
+	// PayoutSubmitted payouts were accepted by CreateWithdrawal
+	PayoutSubmitted PayoutStatus = "SUBMITTED"
+
+	// PayoutFailed payouts were refused by the API or the withdrawal policy
+	PayoutFailed PayoutStatus = "FAILED"
+
+	// PayoutRejected payouts were rejected by an approver
+	PayoutRejected PayoutStatus = "REJECTED"
+
+	// PayoutExpired payouts did not get their approvals in time
+	PayoutExpired PayoutStatus = "EXPIRED"
+)
+
+// Payout queue errors
+var (
+	// ErrPayoutNotFound is returned when no payout exists with an ID
+	ErrPayoutNotFound = errors.New("sagapay: payout not found")
+
+	// ErrPayoutNotPending is returned when approving or rejecting a payout
+	// that is no longer pending
+	ErrPayoutNotPending = errors.New("sagapay: payout is not pending")
+
+	// ErrPayoutExpired is returned when approving a payout past its expiry
+	ErrPayoutExpired = errors.New("sagapay: payout expired")
+
+	// ErrSelfApproval is returned when the requester of a payout approves it
+	ErrSelfApproval = errors.New("sagapay: payout requester cannot approve it")
+
+	// ErrDuplicateApproval is returned when an approver approves a payout twice
+	ErrDuplicateApproval = errors.New("sagapay: payout already approved by this approver")
+)
+
+// DefaultPayoutExpiry is the default time a payout may wait for approvals
+const DefaultPayoutExpiry = 72 * time.Hour
+
+// PayoutApproval is an approver's sign-off, or rejection, of a payout
+type PayoutApproval struct {
+	Approver string    `json:"approver"`
+	Reason   string    `json:"reason"`
+	At       time.Time `json:"at"`
+}
+
+// Payout is a withdrawal held in a PayoutQueue
+type Payout struct {
+	ID     string                 `json:"id"`
+	Params CreateWithdrawalParams `json:"params"`
+
+	// IdempotencyKey is sent with the withdrawal, so resubmitting after a
+	// failure or crash cannot pay twice
+	IdempotencyKey string `json:"idempotencyKey"`
+
+	Status      PayoutStatus `json:"status"`
+	RequestedBy string       `json:"requestedBy"`
+	Reason      string       `json:"reason,omitempty"`
+	RequestedAt time.Time    `json:"requestedAt"`
+	ExpiresAt   time.Time    `json:"expiresAt"`
+
+	// RequiredApprovals is the number of approvals needed before submission
+	RequiredApprovals int              `json:"requiredApprovals"`
+	Approvals         []PayoutApproval `json:"approvals,omitempty"`
+	Rejection         *PayoutApproval  `json:"rejection,omitempty"`
+
+	// Withdrawal is the API response, once submitted
+	Withdrawal *WithdrawalResponse `json:"withdrawal,omitempty"`
+
+	// LastError is the error of the last failed submission
+	LastError string    `json:"lastError,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// clone returns a deep copy of the payout
+func (p *Payout) clone() *Payout {
+	c := *p
+	c.Approvals = slices.Clone(p.Approvals)
+	if p.Rejection != nil {
+		rejection := *p.Rejection
+		c.Rejection = &rejection
+	}
+	if p.Withdrawal != nil {
+		withdrawal := *p.Withdrawal
+		c.Withdrawal = &withdrawal
+	}
+	return &c
+}
+
+// AuditAction is the kind of an audit event
+type AuditAction string
+
+// Audit actions
+const (
+	AuditRequested    AuditAction = "requested"
+	AuditApproved     AuditAction = "approved"
+	AuditRejected     AuditAction = "rejected"
+	AuditExpired      AuditAction = "expired"
+	AuditSubmitted    AuditAction = "submitted"
+	AuditSubmitFailed AuditAction = "submit_failed"
+)
+
+// AuditEvent is an entry in the audit trail of a PayoutQueue
+type AuditEvent struct {
+	PayoutID string      `json:"payoutId"`
+	Action   AuditAction `json:"action"`
+
+	// Actor is the person who acted; empty for actions taken by the queue
+	Actor  string       `json:"actor,omitempty"`
+	Reason string       `json:"reason,omitempty"`
+	Status PayoutStatus `json:"status"`
+	At     time.Time    `json:"at"`
+}
+
+// PayoutThreshold exempts small payouts of a token from approval
+type PayoutThreshold struct {
+	NetworkType NetworkType
+
+	// ContractAddress is the token contract, or NativeContractAddress
+	ContractAddress string
+
+	// Amount is the largest payout submitted without approvals
+	Amount Amount
+}
+
+// PayoutQueueConfig configures a PayoutQueue
+type PayoutQueueConfig struct {
+	// Store keeps payouts and the audit trail. Defaults to a MemoryPayoutStore.
+	Store PayoutStore
+
+	// RequiredApprovals is the number of approvers, other than the requester,
+	// who must approve a payout. Defaults to 1.
+	RequiredApprovals int
+
+	// Thresholds lets payouts of a token up to an amount through without
+	// approvals. Tokens without a threshold always need approvals.
+	Thresholds []PayoutThreshold
+
+	// Expiry is how long a payout may wait for approvals. Defaults to DefaultPayoutExpiry.
+	Expiry time.Duration
+}
+
+// PayoutQueue holds withdrawals until enough people other than the requester
+// approve them, then sends them with CreateWithdrawal. Every change is
+// recorded in an append-only audit trail. It is safe for concurrent use
+// within a process. Queues in different processes must not share a store,
+// or both may submit the same payout; FilePayoutStore prevents it with a
+// file lock.
+type PayoutQueue struct {
+	client API
+	config PayoutQueueConfig
+	store  PayoutStore
+	now    func() time.Time
+
+	mu         sync.Mutex
+	submitting map[string]bool
+}
+
+// NewPayoutQueue creates a payout queue that submits withdrawals with the given client
+func NewPayoutQueue(client API, config PayoutQueueConfig) *PayoutQueue {
+	if config.Store == nil {
+		config.Store = NewMemoryPayoutStore()
+	}
+	if config.RequiredApprovals <= 0 {
+		config.RequiredApprovals = 1
+	}
+	if config.Expiry <= 0 {
+		config.Expiry = DefaultPayoutExpiry
+	}
+	return &PayoutQueue{
+		client:     client,
+		config:     config,
+		store:      config.Store,
+		now:        time.Now,
+		submitting: make(map[string]bool),
+	}
+}
+
+// Request validates a withdrawal and queues it for approval. Payouts under
+// a threshold need no approvals and are submitted at once. An idempotency
+// key is generated if params has none.
+func (q *PayoutQueue) Request(ctx context.Context, params CreateWithdrawalParams, requestedBy, reason string) (*Payout, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	if requestedBy == "" {
+		verr := &ValidationError{}
+		verr.add("requestedBy", "is required")
+		return nil, verr
+	}
+	if params.IdempotencyKey == "" {
+		params.IdempotencyKey = NewIdempotencyKey()
+	}
+
+	now := q.now()
+	payout := &Payout{
+		ID:                uuid.NewString(),
+		Params:            params,
+		IdempotencyKey:    params.IdempotencyKey,
+		Status:            PayoutPending,
+		RequestedBy:       requestedBy,
+		Reason:            reason,
+		RequestedAt:       now,
+		ExpiresAt:         now.Add(q.config.Expiry),
+		RequiredApprovals: q.requiredApprovals(params),
+		UpdatedAt:         now,
+	}
+
+	q.mu.Lock()
+	err := q.save(ctx, payout, AuditRequested, requestedBy, reason)
+	q.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if payout.RequiredApprovals == 0 {
+		return q.Submit(ctx, payout.ID)
+	}
+	return payout.clone(), nil
+}
+
+// Approve records an approval of a pending payout and submits it once it has
+// the required approvals. The requester cannot approve their own payout and
+// each approver counts once. A failed submission is returned along with the
+// payout.
+func (q *PayoutQueue) Approve(ctx context.Context, id, approver, reason string) (*Payout, error) {
+	if approver == "" {
+		verr := &ValidationError{}
+		verr.add("approver", "is required")
+		return nil, verr
+	}
+
+	q.mu.Lock()
+	payout, err := q.pending(ctx, id)
+	if err != nil {
+		q.mu.Unlock()
+		return nil, err
+	}
+	if approver == payout.RequestedBy {
+		q.mu.Unlock()
+		return nil, fmt.Errorf("%w: payout %s", ErrSelfApproval, id)
+	}
+	for _, approval := range payout.Approvals {
+		if approval.Approver == approver {
+			q.mu.Unlock()
+			return nil, fmt.Errorf("%w: payout %s, approver %q", ErrDuplicateApproval, id, approver)
+		}
+	}
+
+	now := q.now()
+	payout.Approvals = append(payout.Approvals, PayoutApproval{Approver: approver, Reason: reason, At: now})
+	if len(payout.Approvals) >= payout.RequiredApprovals {
+		payout.Status = PayoutApproved
+	}
+	payout.UpdatedAt = now
+	err = q.save(ctx, payout, AuditApproved, approver, reason)
+	q.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if payout.Status == PayoutApproved {
+		return q.Submit(ctx, id)
+	}
+	return payout.clone(), nil
+}
+
+// Reject rejects a pending payout; it will never be submitted
+func (q *PayoutQueue) Reject(ctx context.Context, id, approver, reason string) (*Payout, error) {
+	if approver == "" {
+		verr := &ValidationError{}
+		verr.add("approver", "is required")
+		return nil, verr
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	payout, err := q.pending(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := q.now()
+	payout.Status = PayoutRejected
+	payout.Rejection = &PayoutApproval{Approver: approver, Reason: reason, At: now}
+	payout.UpdatedAt = now
+	if err := q.save(ctx, payout, AuditRejected, approver, reason); err != nil {
+		return nil, err
+	}
+	return payout.clone(), nil
+}
+
+// Submit sends an approved payout with CreateWithdrawal. Approve calls it
+// once a payout has its approvals; call it again to retry a payout left
+// APPROVED by a failed submission. Retries reuse the payout's idempotency
+// key. Submitting a payout that was already submitted returns it unchanged.
+func (q *PayoutQueue) Submit(ctx context.Context, id string) (*Payout, error) {
+	q.mu.Lock()
+	payout, err := q.store.Get(ctx, id)
+	if err != nil {
+		q.mu.Unlock()
+		return nil, err
+	}
+	switch {
+	case payout.Status == PayoutSubmitted:
+		q.mu.Unlock()
+		return payout, nil
+	case payout.Status == PayoutPending && payout.RequiredApprovals == 0:
+		// Under the threshold, submitted straight from Request
+	case payout.Status != PayoutApproved:
+		q.mu.Unlock()
+		return nil, fmt.Errorf("sagapay: payout %s is %s and cannot be submitted", id, payout.Status)
+	}
+	if q.submitting[id] {
+		q.mu.Unlock()
+		return nil, fmt.Errorf("sagapay: payout %s is already being submitted", id)
+	}
+	q.submitting[id] = true
+	q.mu.Unlock()
+
+	params := payout.Params
+	params.IdempotencyKey = payout.IdempotencyKey
+	resp, sendErr := q.client.CreateWithdrawal(ctx, params)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.submitting, id)
+
+	payout.UpdatedAt = q.now()
+	action, reason := AuditSubmitted, ""
+	if sendErr == nil {
+		payout.Status = PayoutSubmitted
+		payout.Withdrawal = resp
+		payout.LastError = ""
+	} else {
+		// Payouts the API certainly refused fail for good; the rest may
+		// have been made or were throttled, so they stay approved for a
+		// retry with the same key
+		payout.Status = PayoutApproved
+		if refused(sendErr) {
+			payout.Status = PayoutFailed
+		}
+		payout.LastError = sendErr.Error()
+		action, reason = AuditSubmitFailed, sendErr.Error()
+	}
+	// Use a context that outlives cancellation so the outcome is always recorded
+	if err := q.save(context.WithoutCancel(ctx), payout, action, "", reason); err != nil {
+		return nil, errors.Join(sendErr, err)
+	}
+	return payout.clone(), sendErr
+}
+
+// refused reports whether a submission failed in a way that resending it
+// cannot fix. Throttling (429, 408 and client rate limit waits) and server
+// errors are not refusals.
+func refused(err error) bool {
+	if errors.Is(err, ErrValidation) || errors.Is(err, ErrPolicyViolation) {
+		return true
+	}
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && !apiErr.Retryable()
+}
+
+// ExpireDue marks pending payouts past their expiry as expired and returns them
+func (q *PayoutQueue) ExpireDue(ctx context.Context) ([]*Payout, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	pending, err := q.store.List(ctx, PayoutPending)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []*Payout
+	now := q.now()
+	for _, payout := range pending {
+		if now.Before(payout.ExpiresAt) {
+			continue
+		}
+		if err := q.expire(ctx, payout, now); err != nil {
+			return expired, err
+		}
+		expired = append(expired, payout.clone())
+	}
+	return expired, nil
+}
+
+// Payout returns a payout by ID
+func (q *PayoutQueue) Payout(ctx context.Context, id string) (*Payout, error) {
+	return q.store.Get(ctx, id)
+}
+
+// Payouts returns the payouts with a status, or all payouts if status is
+// empty, ordered by request time
+func (q *PayoutQueue) Payouts(ctx context.Context, status PayoutStatus) ([]*Payout, error) {
+	return q.store.List(ctx, status)
+}
+
+// Audit returns the audit trail of a payout, or of every payout if id is
+// empty, in the order the events happened
+func (q *PayoutQueue) Audit(ctx context.Context, id string) ([]AuditEvent, error) {
+	return q.store.Audit(ctx, id)
+}
+
+// pending loads a payout that can still be approved or rejected, expiring
+// it if it is past its expiry
+func (q *PayoutQueue) pending(ctx context.Context, id string) (*Payout, error) {
+	payout, err := q.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if payout.Status != PayoutPending {
+		return nil, fmt.Errorf("%w: payout %s is %s", ErrPayoutNotPending, id, payout.Status)
+	}
+	if now := q.now(); !now.Before(payout.ExpiresAt) {
+		if err := q.expire(ctx, payout, now); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: payout %s expired at %s", ErrPayoutExpired, id, payout.ExpiresAt.Format(time.RFC3339))
+	}
+	return payout, nil
+}
+
+// expire marks a pending payout as expired
+func (q *PayoutQueue) expire(ctx context.Context, payout *Payout, now time.Time) error {
+	payout.Status = PayoutExpired
+	payout.UpdatedAt = now
+	return q.save(ctx, payout, AuditExpired, "", "")
+}
+
+// save stores a payout and appends the audit event of the change
+func (q *PayoutQueue) save(ctx context.Context, payout *Payout, action AuditAction, actor, reason string) error {
+	if err := q.store.Save(ctx, payout); err != nil {
+		return fmt.Errorf("failed to save payout %s: %w", payout.ID, err)
+	}
+	event := AuditEvent{
+		PayoutID: payout.ID,
+		Action:   action,
+		Actor:    actor,
+		Reason:   reason,
+		Status:   payout.Status,
+		At:       payout.UpdatedAt,
+	}
+	if err := q.store.Append(ctx, event); err != nil {
+		return fmt.Errorf("failed to append audit event for payout %s: %w", payout.ID, err)
+	}
+	return nil
+}
+
+// requiredApprovals returns the approvals a withdrawal needs
+func (q *PayoutQueue) requiredApprovals(params CreateWithdrawalParams) int {
+	amount, err := ParseAmount(params.Amount)
+	if err != nil {
+		return q.config.RequiredApprovals
+	}
+	contract := NormalizeAddress(params.NetworkType, params.ContractAddress)
+	for _, t := range q.config.Thresholds {
+		if t.NetworkType == params.NetworkType && NormalizeAddress(t.NetworkType, t.ContractAddress) == contract {
+			if amount.Cmp(t.Amount) <= 0 {
+				return 0
+			}
+			break
+		}
+	}
+	return q.config.RequiredApprovals
+}
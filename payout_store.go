@@ -0,0 +1,203 @@
+package sagapay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// ErrStoreLocked is returned when a store file is already open in another process
+var ErrStoreLocked = errors.New("sagapay: store file is locked by another process")
+
+// PayoutStore keeps the payouts and audit trail of a PayoutQueue
+type PayoutStore interface {
+	// Save creates or replaces a payout
+	Save(ctx context.Context, payout *Payout) error
+
+	// Get returns a copy of a payout, or an error matching ErrPayoutNotFound
+	Get(ctx context.Context, id string) (*Payout, error)
+
+	// List returns copies of the payouts with a status, or of all payouts if
+	// status is empty, ordered by request time
+	List(ctx context.Context, status PayoutStatus) ([]*Payout, error)
+
+	// Append adds an event to the audit trail. Events are never changed or removed.
+	Append(ctx context.Context, event AuditEvent) error
+
+	// Audit returns the events of a payout, or of all payouts if id is
+	// empty, in the order they were appended
+	Audit(ctx context.Context, id string) ([]AuditEvent, error)
+}
+
+// MemoryPayoutStore is an in-memory PayoutStore
+type MemoryPayoutStore struct {
+	mu      sync.Mutex
+	payouts map[string]*Payout
+	audit   []AuditEvent
+}
+
+// NewMemoryPayoutStore creates an empty in-memory payout store
+func NewMemoryPayoutStore() *MemoryPayoutStore {
+	return &MemoryPayoutStore{payouts: make(map[string]*Payout)}
+}
+
+// Save creates or replaces a payout
+func (s *MemoryPayoutStore) Save(ctx context.Context, payout *Payout) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.payouts[payout.ID] = payout.clone()
+	return nil
+}
+
+// Get returns a copy of a payout
+func (s *MemoryPayoutStore) Get(ctx context.Context, id string) (*Payout, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	payout, ok := s.payouts[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrPayoutNotFound, id)
+	}
+	return payout.clone(), nil
+}
+
+// List returns copies of the payouts with a status, or of all payouts
+func (s *MemoryPayoutStore) List(ctx context.Context, status PayoutStatus) ([]*Payout, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var payouts []*Payout
+	for _, payout := range s.payouts {
+		if status == "" || payout.Status == status {
+			payouts = append(payouts, payout.clone())
+		}
+	}
+	sort.Slice(payouts, func(i, j int) bool {
+		if !payouts[i].RequestedAt.Equal(payouts[j].RequestedAt) {
+			return payouts[i].RequestedAt.Before(payouts[j].RequestedAt)
+		}
+		return payouts[i].ID < payouts[j].ID
+	})
+	return payouts, nil
+}
+
+// Append adds an event to the audit trail
+func (s *MemoryPayoutStore) Append(ctx context.Context, event AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audit = append(s.audit, event)
+	return nil
+}
+
+// Audit returns the events of a payout, or of all payouts
+func (s *MemoryPayoutStore) Audit(ctx context.Context, id string) ([]AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []AuditEvent
+	for _, event := range s.audit {
+		if id == "" || event.PayoutID == id {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// FilePayoutStore is a PayoutStore backed by a JSON lines file. Every saved
+// payout and audit event is appended as one line and synced to disk, so the
+// file is itself an append-only log; on open the latest version of each
+// payout wins.
+//
+// The store holds an exclusive lock on the file while it is open, so a
+// second process cannot open it and submit the same approved payout. On
+// platforms without flock the file must not be shared between processes.
+type FilePayoutStore struct {
+	*MemoryPayoutStore
+	file *os.File
+}
+
+// payoutRecord is a line of a FilePayoutStore
+type payoutRecord struct {
+	Payout *Payout     `json:"payout,omitempty"`
+	Audit  *AuditEvent `json:"audit,omitempty"`
+}
+
+// NewFilePayoutStore opens or creates the payout file at path and loads the
+// payouts and audit trail it contains. A final line torn by a crash is
+// discarded. It fails with an error matching ErrStoreLocked if another
+// process has the file open.
+func NewFilePayoutStore(path string) (*FilePayoutStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open payout store: %w", err)
+	}
+
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to lock payout store %s: %w", path, err)
+	}
+
+	mem := NewMemoryPayoutStore()
+	err = readJSONLines(file, func(line int, data []byte) error {
+		var record payoutRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		if record.Payout != nil {
+			mem.payouts[record.Payout.ID] = record.Payout
+		}
+		if record.Audit != nil {
+			mem.audit = append(mem.audit, *record.Audit)
+		}
+		return nil
+	})
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read payout store: %w", err)
+	}
+
+	return &FilePayoutStore{MemoryPayoutStore: mem, file: file}, nil
+}
+
+// Save appends the payout to the file and replaces it in memory
+func (s *FilePayoutStore) Save(ctx context.Context, payout *Payout) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.write(payoutRecord{Payout: payout}); err != nil {
+		return err
+	}
+	s.payouts[payout.ID] = payout.clone()
+	return nil
+}
+
+// Append appends an event to the audit trail in the file
+func (s *FilePayoutStore) Append(ctx context.Context, event AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.write(payoutRecord{Audit: &event}); err != nil {
+		return err
+	}
+	s.audit = append(s.audit, event)
+	return nil
+}
+
+// write appends a record to the file and syncs it
+func (s *FilePayoutStore) write(record payoutRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode payout record: %w", err)
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write payout store: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync payout store: %w", err)
+	}
+	return nil
+}
+
+// Close closes the underlying file
+func (s *FilePayoutStore) Close() error {
+	return s.file.Close()
+}
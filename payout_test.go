@@ -0,0 +1,61 @@
+package sagapay
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestPayoutSubmitFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want PayoutStatus
+	}{
+		{"too many requests", &APIError{StatusCode: http.StatusTooManyRequests, ErrorCode: "RATE_LIMITED"}, PayoutApproved},
+		{"request timeout", &APIError{StatusCode: http.StatusRequestTimeout}, PayoutApproved},
+		{"client rate limit wait", &RequestError{Err: &RateLimitError{Endpoint: EndpointCreateWithdrawal}}, PayoutApproved},
+		{"server error", &APIError{StatusCode: http.StatusInternalServerError}, PayoutApproved},
+		{"transport error", errors.New("connection reset"), PayoutApproved},
+		{"refused", &APIError{StatusCode: http.StatusBadRequest, ErrorCode: "INSUFFICIENT_FUNDS"}, PayoutFailed},
+		{"validation", &ValidationError{}, PayoutFailed},
+		{"policy", &PolicyError{Rule: RuleVelocity}, PayoutFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			stub := &stubAPI{err: tt.err}
+			queue := NewPayoutQueue(stub, PayoutQueueConfig{
+				Thresholds: []PayoutThreshold{{
+					NetworkType:     NetworkTypeBEP20,
+					ContractAddress: NativeContractAddress,
+					Amount:          MustParseAmount("100"),
+				}},
+			})
+
+			payout, err := queue.Request(ctx, validWithdrawal(), "alice", "")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Request = %v, want %v", err, tt.err)
+			}
+			if payout.Status != tt.want || payout.LastError == "" {
+				t.Fatalf("status %s with last error %q, want %s", payout.Status, payout.LastError, tt.want)
+			}
+
+			stub.err = nil
+			resubmitted, err := queue.Submit(ctx, payout.ID)
+			if tt.want == PayoutFailed {
+				if err == nil {
+					t.Error("a failed payout was submitted again")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resubmitting: %v", err)
+			}
+			if resubmitted.Status != PayoutSubmitted || resubmitted.LastError != "" {
+				t.Errorf("status %s with last error %q after resubmitting", resubmitted.Status, resubmitted.LastError)
+			}
+		})
+	}
+}
@@ -0,0 +1,450 @@
+package sagapay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrPolicyViolation is matched by every *PolicyError
+var ErrPolicyViolation = errors.New("sagapay: withdrawal policy violation")
+
+// PolicyRule names the withdrawal policy rule that rejected a withdrawal
+type PolicyRule string
+
+// Withdrawal policy rules
+const (
+	// RuleDenylist rejects destinations on the network's denylist
+	RuleDenylist PolicyRule = "denylist"
+
+	// RuleAllowlist rejects destinations missing from the network's allowlist
+	RuleAllowlist PolicyRule = "allowlist"
+
+	// RulePerTransaction rejects single withdrawals above a token's limit
+	RulePerTransaction PolicyRule = "per_transaction_limit"
+
+	// RuleRollingLimit rejects withdrawals that would take a token's total
+	// over its limit for the rolling window
+	RuleRollingLimit PolicyRule = "rolling_limit"
+
+	// RuleUDFRequired rejects withdrawals without a UDF when velocity caps require one
+	RuleUDFRequired PolicyRule = "udf_required"
+
+	// RuleVelocity rejects withdrawals beyond a UDF's cap for the window
+	RuleVelocity PolicyRule = "velocity"
+)
+
+// PolicyError is returned when a withdrawal policy rejects a withdrawal.
+// It matches ErrPolicyViolation.
+type PolicyError struct {
+	Rule        PolicyRule
+	NetworkType NetworkType
+
+	// Address is the rejected destination. Error masks it with MaskValue,
+	// so the message can be logged as is.
+	Address string
+
+	// ContractAddress is the token, for token limits
+	ContractAddress string
+
+	// UDF is the user-defined field, for velocity caps
+	UDF string
+
+	// Amount is the amount of the rejected withdrawal
+	Amount Amount
+
+	// Limit is the limit that would be exceeded: an amount for token limits
+	// or a number of withdrawals for velocity caps
+	Limit string
+
+	// Used is how much of a rolling limit or velocity cap was already used
+	Used string
+
+	// Window is the window of a rolling limit or velocity cap
+	Window time.Duration
+}
+
+func (e *PolicyError) Error() string {
+	prefix := fmt.Sprintf("sagapay: withdrawal rejected by %s rule", e.Rule)
+	switch e.Rule {
+	case RuleDenylist:
+		return fmt.Sprintf("%s: %s is denylisted on %s", prefix, MaskValue(e.Address), e.NetworkType)
+	case RuleAllowlist:
+		return fmt.Sprintf("%s: %s is not allowlisted on %s", prefix, MaskValue(e.Address), e.NetworkType)
+	case RulePerTransaction:
+		return fmt.Sprintf("%s: %s of token %s on %s exceeds the limit of %s per withdrawal",
+			prefix, e.Amount, e.ContractAddress, e.NetworkType, e.Limit)
+	case RuleRollingLimit:
+		return fmt.Sprintf("%s: %s of token %s on %s would exceed the limit of %s per %s (%s used)",
+			prefix, e.Amount, e.ContractAddress, e.NetworkType, e.Limit, e.Window, e.Used)
+	case RuleUDFRequired:
+		return prefix + ": udf is required"
+	case RuleVelocity:
+		return fmt.Sprintf("%s: udf %q already made %s of %s withdrawals allowed per %s",
+			prefix, e.UDF, e.Used, e.Limit, e.Window)
+	}
+	return prefix
+}
+
+// Is reports whether target is ErrPolicyViolation
+func (e *PolicyError) Is(target error) bool {
+	return target == ErrPolicyViolation
+}
+
+// DefaultRollingWindow is the default window of token limits and velocity caps
+const DefaultRollingWindow = 24 * time.Hour
+
+// TokenLimit limits the withdrawals of one token
+type TokenLimit struct {
+	NetworkType NetworkType
+
+	// ContractAddress is the token contract, or NativeContractAddress
+	ContractAddress string
+
+	// PerTransaction is the largest single withdrawal. Zero means no limit.
+	PerTransaction Amount
+
+	// Rolling is the largest total withdrawn within Window. Zero means no limit.
+	Rolling Amount
+
+	// Window defaults to DefaultRollingWindow
+	Window time.Duration
+}
+
+// VelocityLimit caps how many withdrawals each UDF, typically a customer ID,
+// may make within a window
+type VelocityLimit struct {
+	// MaxCount is the number of withdrawals allowed per UDF within Window
+	MaxCount int
+
+	// Window defaults to DefaultRollingWindow
+	Window time.Duration
+
+	// RequireUDF rejects withdrawals without a UDF; otherwise they are not capped
+	RequireUDF bool
+}
+
+// WithdrawalPolicyConfig configures a WithdrawalPolicy
+type WithdrawalPolicyConfig struct {
+	// Allowlist restricts the destinations on a network to the listed
+	// addresses. Networks without an entry accept any destination.
+	Allowlist map[NetworkType][]string
+
+	// Denylist rejects the listed destinations on a network
+	Denylist map[NetworkType][]string
+
+	// Limits are per-token limits. Tokens without an entry are not limited.
+	Limits []TokenLimit
+
+	// Velocity caps withdrawals per UDF. Nil means no cap.
+	Velocity *VelocityLimit
+
+	// Store keeps the usage of rolling limits and velocity caps. Defaults to
+	// a MemoryUsageStore, which does not survive restarts and is not shared
+	// between processes.
+	Store UsageStore
+}
+
+// WithdrawalPolicy checks withdrawals against destination lists, token limits
+// and velocity caps before they are sent. Set it in Config.WithdrawalPolicy
+// to apply it to every CreateWithdrawal call of a client. It is safe for
+// concurrent use.
+type WithdrawalPolicy struct {
+	allow    map[NetworkType]map[string]bool
+	deny     map[NetworkType]map[string]bool
+	limits   []TokenLimit
+	velocity *VelocityLimit
+	store    UsageStore
+	now      func() time.Time
+
+	// mu makes checking and recording usage atomic within the process
+	mu sync.Mutex
+}
+
+// NewWithdrawalPolicy creates a withdrawal policy
+func NewWithdrawalPolicy(config WithdrawalPolicyConfig) *WithdrawalPolicy {
+	p := &WithdrawalPolicy{
+		allow:    addressSets(config.Allowlist),
+		deny:     addressSets(config.Denylist),
+		limits:   slices.Clone(config.Limits),
+		velocity: config.Velocity,
+		store:    config.Store,
+		now:      time.Now,
+	}
+	for i := range p.limits {
+		if p.limits[i].Window <= 0 {
+			p.limits[i].Window = DefaultRollingWindow
+		}
+	}
+	if p.velocity != nil && p.velocity.Window <= 0 {
+		velocity := *p.velocity
+		velocity.Window = DefaultRollingWindow
+		p.velocity = &velocity
+	}
+	if p.store == nil {
+		p.store = NewMemoryUsageStore()
+	}
+	return p
+}
+
+// Check evaluates the policy for a withdrawal without recording it. It
+// returns a *PolicyError naming the first rule that rejects the withdrawal,
+// or an error from the usage store.
+func (p *WithdrawalPolicy) Check(ctx context.Context, params CreateWithdrawalParams) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.check(ctx, params)
+	return err
+}
+
+// Reserve checks a withdrawal and, if it is allowed, records it against the
+// rolling limits and velocity caps under params.IdempotencyKey, which must be
+// set. Reserving the same key again replaces the earlier reservation, so a
+// retried withdrawal is counted once. Call Release if the withdrawal is
+// known not to have been made.
+func (p *WithdrawalPolicy) Reserve(ctx context.Context, params CreateWithdrawalParams) error {
+	if params.IdempotencyKey == "" {
+		return errors.New("sagapay: withdrawal policy: idempotency key is required")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	keys, err := p.check(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	amount, _ := ParseAmount(params.Amount)
+	entry := UsageEntry{ID: params.IdempotencyKey, Amount: amount, At: p.now()}
+	for i, key := range keys {
+		if err := p.store.Record(ctx, key, entry); err != nil {
+			for _, done := range keys[:i] {
+				p.store.Remove(ctx, done, entry.ID)
+			}
+			return fmt.Errorf("sagapay: withdrawal policy: %w", err)
+		}
+	}
+	return nil
+}
+
+// Release removes the usage recorded by Reserve for a withdrawal
+func (p *WithdrawalPolicy) Release(ctx context.Context, params CreateWithdrawalParams) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var errs []error
+	for _, key := range p.usageKeys(params) {
+		errs = append(errs, p.store.Remove(ctx, key, params.IdempotencyKey))
+	}
+	return errors.Join(errs...)
+}
+
+// check evaluates every rule and returns the usage keys the withdrawal counts against
+func (p *WithdrawalPolicy) check(ctx context.Context, params CreateWithdrawalParams) ([]string, error) {
+	address := NormalizeAddress(params.NetworkType, params.Address)
+	amount, err := ParseAmount(params.Amount)
+	if err != nil {
+		return nil, err
+	}
+	reject := func(rule PolicyRule) *PolicyError {
+		return &PolicyError{
+			Rule:            rule,
+			NetworkType:     params.NetworkType,
+			Address:         params.Address,
+			ContractAddress: params.ContractAddress,
+			UDF:             params.UDF,
+			Amount:          amount,
+		}
+	}
+
+	// Destinations
+	if p.deny[params.NetworkType][address] {
+		return nil, reject(RuleDenylist)
+	}
+	if allowed, ok := p.allow[params.NetworkType]; ok && !allowed[address] {
+		return nil, reject(RuleAllowlist)
+	}
+
+	var keys []string
+	now := p.now()
+
+	// Token limits
+	if limit, ok := p.limitFor(params.NetworkType, params.ContractAddress); ok {
+		if !limit.PerTransaction.IsZero() && amount.Cmp(limit.PerTransaction) > 0 {
+			perr := reject(RulePerTransaction)
+			perr.Limit = limit.PerTransaction.String()
+			return nil, perr
+		}
+		if !limit.Rolling.IsZero() {
+			key := tokenUsageKey(params.NetworkType, params.ContractAddress)
+			entries, err := p.store.Entries(ctx, key, now.Add(-limit.Window))
+			if err != nil {
+				return nil, fmt.Errorf("sagapay: withdrawal policy: %w", err)
+			}
+			var used Amount
+			for _, entry := range entries {
+				if entry.ID != params.IdempotencyKey {
+					used = used.Add(entry.Amount)
+				}
+			}
+			if used.Add(amount).Cmp(limit.Rolling) > 0 {
+				perr := reject(RuleRollingLimit)
+				perr.Limit, perr.Used, perr.Window = limit.Rolling.String(), used.String(), limit.Window
+				return nil, perr
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	// Velocity caps
+	if v := p.velocity; v != nil {
+		if params.UDF == "" {
+			if v.RequireUDF {
+				return nil, reject(RuleUDFRequired)
+			}
+			return keys, nil
+		}
+		key := udfUsageKey(params.UDF)
+		entries, err := p.store.Entries(ctx, key, now.Add(-v.Window))
+		if err != nil {
+			return nil, fmt.Errorf("sagapay: withdrawal policy: %w", err)
+		}
+		used := 0
+		for _, entry := range entries {
+			if entry.ID != params.IdempotencyKey {
+				used++
+			}
+		}
+		if used >= v.MaxCount {
+			perr := reject(RuleVelocity)
+			perr.Limit, perr.Used, perr.Window = fmt.Sprint(v.MaxCount), fmt.Sprint(used), v.Window
+			return nil, perr
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// usageKeys returns the usage keys a withdrawal counts against
+func (p *WithdrawalPolicy) usageKeys(params CreateWithdrawalParams) []string {
+	var keys []string
+	if limit, ok := p.limitFor(params.NetworkType, params.ContractAddress); ok && !limit.Rolling.IsZero() {
+		keys = append(keys, tokenUsageKey(params.NetworkType, params.ContractAddress))
+	}
+	if p.velocity != nil && params.UDF != "" {
+		keys = append(keys, udfUsageKey(params.UDF))
+	}
+	return keys
+}
+
+// limitFor returns the limit of a token
+func (p *WithdrawalPolicy) limitFor(network NetworkType, contract string) (TokenLimit, bool) {
+	contract = NormalizeAddress(network, contract)
+	for _, limit := range p.limits {
+		if limit.NetworkType == network && NormalizeAddress(network, limit.ContractAddress) == contract {
+			return limit, true
+		}
+	}
+	return TokenLimit{}, false
+}
+
+// tokenUsageKey is the usage key of a token's rolling limit
+func tokenUsageKey(network NetworkType, contract string) string {
+	return "token:" + string(network) + ":" + NormalizeAddress(network, contract)
+}
+
+// udfUsageKey is the usage key of a UDF's velocity cap
+func udfUsageKey(udf string) string {
+	return "udf:" + udf
+}
+
+// addressSets converts address lists to normalized sets
+func addressSets(lists map[NetworkType][]string) map[NetworkType]map[string]bool {
+	sets := make(map[NetworkType]map[string]bool, len(lists))
+	for network, addresses := range lists {
+		set := make(map[string]bool, len(addresses))
+		for _, addr := range addresses {
+			set[NormalizeAddress(network, addr)] = true
+		}
+		sets[network] = set
+	}
+	return sets
+}
+
+// notSent reports whether a failed call certainly did not reach the API or
+// was rejected by it. Timeouts and server errors are not: the request may
+// have been processed.
+func notSent(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode < 500
+	}
+	return errors.Is(err, ErrRateLimitWait)
+}
+
+// UsageEntry is a withdrawal recorded against a rolling limit or velocity cap
+type UsageEntry struct {
+	// ID is the withdrawal's idempotency key
+	ID     string
+	Amount Amount
+	At     time.Time
+}
+
+// UsageStore keeps the withdrawals counted by a WithdrawalPolicy. Implement
+// it over a shared database to enforce limits across processes.
+type UsageStore interface {
+	// Entries returns the entries recorded under key at or after since. It
+	// may discard older entries.
+	Entries(ctx context.Context, key string, since time.Time) ([]UsageEntry, error)
+
+	// Record adds an entry under key, replacing any entry with the same ID
+	Record(ctx context.Context, key string, entry UsageEntry) error
+
+	// Remove deletes the entry with the given ID under key, if any
+	Remove(ctx context.Context, key, id string) error
+}
+
+// MemoryUsageStore is an in-memory UsageStore
+type MemoryUsageStore struct {
+	mu      sync.Mutex
+	entries map[string][]UsageEntry
+}
+
+// NewMemoryUsageStore creates an empty in-memory usage store
+func NewMemoryUsageStore() *MemoryUsageStore {
+	return &MemoryUsageStore{entries: make(map[string][]UsageEntry)}
+}
+
+// Entries implements UsageStore
+func (s *MemoryUsageStore) Entries(_ context.Context, key string, since time.Time) ([]UsageEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := slices.DeleteFunc(s.entries[key], func(e UsageEntry) bool {
+		return e.At.Before(since)
+	})
+	s.entries[key] = kept
+	return slices.Clone(kept), nil
+}
+
+// Record implements UsageStore
+func (s *MemoryUsageStore) Record(_ context.Context, key string, entry UsageEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := slices.DeleteFunc(s.entries[key], func(e UsageEntry) bool {
+		return e.ID == entry.ID
+	})
+	s.entries[key] = append(entries, entry)
+	return nil
+}
+
+// Remove implements UsageStore
+func (s *MemoryUsageStore) Remove(_ context.Context, key, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = slices.DeleteFunc(s.entries[key], func(e UsageEntry) bool {
+		return e.ID == id
+	})
+	return nil
+}
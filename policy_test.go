@@ -0,0 +1,199 @@
+package sagapay
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	policyAddress = "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"
+	policyToken   = "0x55d398326f99059fF775485246999027B3197955"
+)
+
+// policyWithdrawal returns withdrawal params for the policy tests
+func policyWithdrawal(key, amount, udf string) CreateWithdrawalParams {
+	return CreateWithdrawalParams{
+		NetworkType:     NetworkTypeBEP20,
+		ContractAddress: policyToken,
+		Address:         policyAddress,
+		Amount:          amount,
+		UDF:             udf,
+		IdempotencyKey:  key,
+	}
+}
+
+// policyRule returns the rule of a *PolicyError, or "" for nil
+func policyRule(t *testing.T, err error) PolicyRule {
+	t.Helper()
+	if err == nil {
+		return ""
+	}
+	var perr *PolicyError
+	if !errors.As(err, &perr) || !errors.Is(err, ErrPolicyViolation) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return perr.Rule
+}
+
+func TestPolicyDestinations(t *testing.T) {
+	policy := NewWithdrawalPolicy(WithdrawalPolicyConfig{
+		Allowlist: map[NetworkType][]string{NetworkTypeBEP20: {strings.ToLower(policyAddress), "0x0000000000000000000000000000000000000001"}},
+		Denylist:  map[NetworkType][]string{NetworkTypeBEP20: {"0x0000000000000000000000000000000000000001"}},
+	})
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		network NetworkType
+		address string
+		want    PolicyRule
+	}{
+		{"allowlisted in another case", NetworkTypeBEP20, "0x" + strings.ToUpper(policyAddress[2:]), ""},
+		{"allowlisted", NetworkTypeBEP20, policyAddress, ""},
+		{"not allowlisted", NetworkTypeBEP20, "0x0000000000000000000000000000000000000002", RuleAllowlist},
+		{"denylist wins over allowlist", NetworkTypeBEP20, "0x0000000000000000000000000000000000000001", RuleDenylist},
+		{"network without lists", NetworkTypeERC20, "0x0000000000000000000000000000000000000002", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := policyWithdrawal("", "1", "")
+			params.NetworkType = tt.network
+			params.Address = tt.address
+			if got := policyRule(t, policy.Check(ctx, params)); got != tt.want {
+				t.Errorf("rule %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyErrorMasksAddress(t *testing.T) {
+	policy := NewWithdrawalPolicy(WithdrawalPolicyConfig{
+		Denylist: map[NetworkType][]string{NetworkTypeBEP20: {policyAddress}},
+	})
+	err := policy.Check(context.Background(), policyWithdrawal("", "1", ""))
+	var perr *PolicyError
+	if !errors.As(err, &perr) {
+		t.Fatalf("Check = %v, want a *PolicyError", err)
+	}
+	if strings.Contains(err.Error(), policyAddress) {
+		t.Errorf("error %q shows the full address", err)
+	}
+	if !strings.Contains(err.Error(), MaskValue(policyAddress)) {
+		t.Errorf("error %q does not show the masked address", err)
+	}
+	if perr.Address != policyAddress {
+		t.Errorf("Address = %q, want the full address", perr.Address)
+	}
+}
+
+func TestPolicyTokenLimits(t *testing.T) {
+	policy := NewWithdrawalPolicy(WithdrawalPolicyConfig{
+		Limits: []TokenLimit{{
+			NetworkType:     NetworkTypeBEP20,
+			ContractAddress: strings.ToLower(policyToken),
+			PerTransaction:  MustParseAmount("100"),
+			Rolling:         MustParseAmount("250"),
+			Window:          time.Hour,
+		}},
+	})
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	policy.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if got := policyRule(t, policy.Check(ctx, policyWithdrawal("", "100.01", ""))); got != RulePerTransaction {
+		t.Errorf("rule %q, want %q", got, RulePerTransaction)
+	}
+	for i, key := range []string{"a", "b"} {
+		if err := policy.Reserve(ctx, policyWithdrawal(key, "100", "")); err != nil {
+			t.Fatalf("withdrawal %d: %v", i, err)
+		}
+	}
+
+	err := policy.Reserve(ctx, policyWithdrawal("c", "60", ""))
+	var perr *PolicyError
+	if !errors.As(err, &perr) || perr.Rule != RuleRollingLimit {
+		t.Fatalf("Reserve = %v, want the rolling limit", err)
+	}
+	if perr.Limit != "250" || perr.Used != "200" || perr.Window != time.Hour {
+		t.Errorf("limit %s, used %s, window %s", perr.Limit, perr.Used, perr.Window)
+	}
+
+	// Reserving a key again replaces its earlier reservation
+	if err := policy.Reserve(ctx, policyWithdrawal("b", "100", "")); err != nil {
+		t.Errorf("reserving a key twice: %v", err)
+	}
+	if err := policy.Reserve(ctx, policyWithdrawal("c", "50", "")); err != nil {
+		t.Errorf("withdrawal up to the limit: %v", err)
+	}
+
+	// Released withdrawals no longer count
+	policy.Release(ctx, policyWithdrawal("c", "50", ""))
+	if err := policy.Check(ctx, policyWithdrawal("d", "50", "")); err != nil {
+		t.Errorf("after Release: %v", err)
+	}
+
+	// Usage leaves the window
+	now = now.Add(30 * time.Minute)
+	policy.Reserve(ctx, policyWithdrawal("e", "50", ""))
+	now = now.Add(31 * time.Minute)
+	for _, key := range []string{"f", "g"} {
+		if err := policy.Reserve(ctx, policyWithdrawal(key, "100", "")); err != nil {
+			t.Errorf("after the window: %v", err)
+		}
+	}
+	if got := policyRule(t, policy.Check(ctx, policyWithdrawal("h", "1", ""))); got != RuleRollingLimit {
+		t.Errorf("rule %q, want %q with usage inside the window", got, RuleRollingLimit)
+	}
+
+	// Other tokens are not limited
+	other := policyWithdrawal("i", "1000", "")
+	other.ContractAddress = NativeContractAddress
+	if err := policy.Check(ctx, other); err != nil {
+		t.Errorf("unlimited token: %v", err)
+	}
+}
+
+func TestPolicyVelocity(t *testing.T) {
+	policy := NewWithdrawalPolicy(WithdrawalPolicyConfig{
+		Velocity: &VelocityLimit{MaxCount: 2, RequireUDF: true},
+	})
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	policy.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if got := policyRule(t, policy.Check(ctx, policyWithdrawal("a", "1", ""))); got != RuleUDFRequired {
+		t.Errorf("rule %q, want %q", got, RuleUDFRequired)
+	}
+	policy.Reserve(ctx, policyWithdrawal("a", "1", "customer-1"))
+	policy.Reserve(ctx, policyWithdrawal("b", "1", "customer-1"))
+
+	err := policy.Reserve(ctx, policyWithdrawal("c", "1", "customer-1"))
+	var perr *PolicyError
+	if !errors.As(err, &perr) || perr.Rule != RuleVelocity {
+		t.Fatalf("Reserve = %v, want the velocity cap", err)
+	}
+	if perr.Limit != "2" || perr.Used != "2" || perr.Window != DefaultRollingWindow {
+		t.Errorf("limit %s, used %s, window %s", perr.Limit, perr.Used, perr.Window)
+	}
+	if err := policy.Reserve(ctx, policyWithdrawal("b", "1", "customer-1")); err != nil {
+		t.Errorf("retrying a counted withdrawal: %v", err)
+	}
+	if err := policy.Check(ctx, policyWithdrawal("c", "1", "customer-2")); err != nil {
+		t.Errorf("another UDF: %v", err)
+	}
+
+	now = now.Add(DefaultRollingWindow + time.Second)
+	if err := policy.Check(ctx, policyWithdrawal("c", "1", "customer-1")); err != nil {
+		t.Errorf("after the window: %v", err)
+	}
+}
+
+func TestPolicyReserveRequiresKey(t *testing.T) {
+	policy := NewWithdrawalPolicy(WithdrawalPolicyConfig{})
+	if err := policy.Reserve(context.Background(), policyWithdrawal("", "1", "")); err == nil || errors.Is(err, ErrPolicyViolation) {
+		t.Errorf("Reserve without a key = %v, want a usage error", err)
+	}
+}
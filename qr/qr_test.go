@@ -0,0 +1,134 @@
+package qr
+
+import (
+	"bytes"
+	"testing"
+)
+
+// readCodewords reads the codewords back out of a code by undoing its mask
+// and walking the data modules in placement order
+func readCodewords(c *Code) []byte {
+	c.applyMask(c.Mask)
+	defer c.applyMask(c.Mask)
+
+	var out []byte
+	var cur byte
+	n := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if c.isFunction[y][x] {
+					continue
+				}
+				cur <<= 1
+				if c.modules[y][x] {
+					cur |= 1
+				}
+				if n++; n%8 == 0 {
+					out = append(out, cur)
+					cur = 0
+				}
+			}
+		}
+	}
+	return out
+}
+
+func TestEncodeReference(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		level     Level
+		version   int
+		codewords []byte
+	}{
+		{
+			// ISO/IEC 18004 Annex I
+			name: "numeric", text: "01234567", level: Medium, version: 1,
+			codewords: []byte{
+				0x10, 0x20, 0x0C, 0x56, 0x61, 0x80, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11,
+				0xA5, 0x24, 0xD4, 0xC1, 0xED, 0x36, 0xC7, 0x87, 0x2C, 0x55,
+			},
+		},
+		{
+			name: "alphanumeric", text: "HELLO WORLD", level: Medium, version: 1,
+			codewords: []byte{
+				0x20, 0x5B, 0x0B, 0x78, 0xD1, 0x72, 0xDC, 0x4D, 0x43, 0x40, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11,
+				0xC4, 0x23, 0x27, 0x77, 0xEB, 0xD7, 0xE7, 0xE2, 0x5D, 0x17,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Encode(tt.text, tt.level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Version != tt.version || c.Size != 17+4*tt.version {
+				t.Fatalf("version %d size %d, want version %d size %d", c.Version, c.Size, tt.version, 17+4*tt.version)
+			}
+			if got := readCodewords(c); !bytes.Equal(got, tt.codewords) {
+				t.Errorf("codewords\n got % X\nwant % X", got, tt.codewords)
+			}
+		})
+	}
+}
+
+// formatStrings are the 15-bit format information strings of the
+// specification for level M, by mask
+var formatStrings = [8]string{
+	"101010000010010", "101000100100101", "101111001111100", "101101101001011",
+	"100010111111001", "100000011001110", "100111110010111", "100101010100000",
+}
+
+func TestEncodeFormatBits(t *testing.T) {
+	c, err := Encode("HELLO WORLD", Medium)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Most significant bit first: along row 8, then up column 8, skipping
+	// the timing patterns
+	var got []byte
+	for x := 0; x <= 8; x++ {
+		if x != 6 {
+			got = append(got, bitChar(c.Dark(x, 8)))
+		}
+	}
+	for y := 7; y >= 0; y-- {
+		if y != 6 {
+			got = append(got, bitChar(c.Dark(8, y)))
+		}
+	}
+	if want := formatStrings[c.Mask]; string(got) != want {
+		t.Errorf("format bits for mask %d = %s, want %s", c.Mask, got, want)
+	}
+}
+
+func bitChar(dark bool) byte {
+	if dark {
+		return '1'
+	}
+	return '0'
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, level := range []Level{Low, Medium, Quartile, High} {
+		parsed, err := ParseLevel(level.String())
+		if err != nil || parsed != level {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", level.String(), parsed, err, level)
+		}
+	}
+	if _, err := ParseLevel("X"); err == nil {
+		t.Error("ParseLevel(\"X\") succeeded")
+	}
+}
@@ -0,0 +1,113 @@
+package qr
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// DefaultQuietZone is the width in modules of the light border the
+// specification requires around a code. Readers may fail on narrower borders.
+const DefaultQuietZone = 4
+
+// Image renders the code as a black and white image with scale pixels per
+// module and a quiet zone of quietZone modules on each side
+func (c *Code) Image(scale, quietZone int) image.Image {
+	scale = max(scale, 1)
+	quietZone = max(quietZone, 0)
+	side := (c.Size + quietZone*2) * scale
+
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+	for py := 0; py < side; py++ {
+		y := py/scale - quietZone
+		for px := 0; px < side; px++ {
+			if c.Dark(px/scale-quietZone, y) {
+				img.SetColorIndex(px, py, 1)
+			}
+		}
+	}
+	return img
+}
+
+// WritePNG writes the code to w as a PNG image (see Image)
+func (c *Code) WritePNG(w io.Writer, scale, quietZone int) error {
+	return png.Encode(w, c.Image(scale, quietZone))
+}
+
+// PNG returns the code as a PNG image (see Image)
+func (c *Code) PNG(scale, quietZone int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := c.WritePNG(&buf, scale, quietZone); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG renders the code as an SVG document with one unit per module and a
+// quiet zone of quietZone modules on each side. The image has no fixed size,
+// so it scales to fit its container.
+func (c *Code) SVG(quietZone int) string {
+	quietZone = max(quietZone, 0)
+	side := c.Size + quietZone*2
+
+	var path strings.Builder
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.Dark(x, y) {
+				continue
+			}
+			// Merge horizontal runs into one rectangle
+			run := 1
+			for c.Dark(x+run, y) {
+				run++
+			}
+			if path.Len() > 0 {
+				path.WriteByte(' ')
+			}
+			fmt.Fprintf(&path, "M%d,%dh%dv1h-%dz", x+quietZone, y+quietZone, run, run)
+			x += run - 1
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n", side, side)
+	b.WriteString(`<rect width="100%" height="100%" fill="#FFFFFF"/>` + "\n")
+	fmt.Fprintf(&b, `<path d="%s" fill="#000000"/>`+"\n", path.String())
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// Terminal renders the code with Unicode block characters, two module rows
+// per line of text, and a quiet zone of quietZone modules on each side. The
+// blocks are drawn in the terminal's foreground color, so on a dark terminal
+// with light text pass invert to keep the dark modules dark.
+func (c *Code) Terminal(quietZone int, invert bool) string {
+	quietZone = max(quietZone, 0)
+	lo, hi := -quietZone, c.Size+quietZone
+
+	// Indexed by top | bottom<<1, where a set bit is a drawn block
+	blocks := [4]string{" ", "▀", "▄", "█"}
+
+	var b strings.Builder
+	for y := lo; y < hi; y += 2 {
+		for x := lo; x < hi; x++ {
+			top := c.Dark(x, y) != invert
+			bottom := y+1 < hi && c.Dark(x, y+1) != invert
+			i := 0
+			if top {
+				i |= 1
+			}
+			if bottom {
+				i |= 2
+			}
+			b.WriteString(blocks[i])
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
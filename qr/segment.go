@@ -0,0 +1,108 @@
+package qr
+
+import "strings"
+
+// alphanumericCharset lists the characters of alphanumeric mode by value
+const alphanumericCharset = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// mode is a segment encoding mode
+type mode struct {
+	indicator int
+
+	// countWidths are the widths of the character count for versions 1-9, 10-26 and 27-40
+	countWidths [3]int
+}
+
+// Encoding modes
+var (
+	modeNumeric      = mode{indicator: 0x1, countWidths: [3]int{10, 12, 14}}
+	modeAlphanumeric = mode{indicator: 0x2, countWidths: [3]int{9, 11, 13}}
+	modeByte         = mode{indicator: 0x4, countWidths: [3]int{8, 16, 16}}
+)
+
+// countBits returns the width of the character count field in a version
+func (m mode) countBits(version int) int {
+	switch {
+	case version <= 9:
+		return m.countWidths[0]
+	case version <= 26:
+		return m.countWidths[1]
+	default:
+		return m.countWidths[2]
+	}
+}
+
+// segment is text encoded in a single mode
+type segment struct {
+	mode  mode
+	count int
+	data  bitBuffer
+}
+
+// newSegment encodes text in the most compact mode that can represent all of it
+func newSegment(text string) segment {
+	switch {
+	case text != "" && strings.Trim(text, "0123456789") == "":
+		var bb bitBuffer
+		for i := 0; i < len(text); i += 3 {
+			n := min(3, len(text)-i)
+			value := 0
+			for _, d := range text[i : i+n] {
+				value = value*10 + int(d-'0')
+			}
+			bb.append(value, n*3+1)
+		}
+		return segment{mode: modeNumeric, count: len(text), data: bb}
+
+	case text != "" && strings.Trim(text, alphanumericCharset) == "":
+		var bb bitBuffer
+		for i := 0; i < len(text); i += 2 {
+			value := strings.IndexByte(alphanumericCharset, text[i])
+			if i+1 < len(text) {
+				value = value*45 + strings.IndexByte(alphanumericCharset, text[i+1])
+				bb.append(value, 11)
+			} else {
+				bb.append(value, 6)
+			}
+		}
+		return segment{mode: modeAlphanumeric, count: len(text), data: bb}
+
+	default:
+		var bb bitBuffer
+		for i := 0; i < len(text); i++ {
+			bb.append(int(text[i]), 8)
+		}
+		return segment{mode: modeByte, count: len(text), data: bb}
+	}
+}
+
+// bitLength returns the number of bits the segment takes in a version, or a
+// value larger than any capacity if its length does not fit the count field
+func (s segment) bitLength(version int) int {
+	countBits := s.mode.countBits(version)
+	if s.count >= 1<<countBits {
+		return 1 << 30
+	}
+	return 4 + countBits + len(s.data)
+}
+
+// bitBuffer is a sequence of bits
+type bitBuffer []bool
+
+// append appends the n low bits of value, most significant first
+func (b *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, value>>i&1 == 1)
+	}
+}
+
+// bytes packs the bits into bytes; the length must be a multiple of 8
+func (b bitBuffer) bytes() []byte {
+	result := make([]byte, len(b)/8)
+	for i, set := range b {
+		if set {
+			result[i>>3] |= 1 << (7 - i&7)
+		}
+	}
+	return result
+}
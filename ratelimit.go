@@ -0,0 +1,209 @@
+package sagapay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrRateLimitWait is matched by every *RateLimitError
+var ErrRateLimitWait = errors.New("sagapay: client rate limit wait exceeds context deadline")
+
+// RateLimit limits the requests a client makes. Limits are shared by all
+// goroutines using the client and apply to every HTTP attempt, including retries.
+type RateLimit struct {
+	// RequestsPerSecond is the sustained request rate. Zero means no rate limit.
+	RequestsPerSecond float64
+
+	// Burst is the number of requests that may be made at once before the
+	// rate applies (default RequestsPerSecond rounded up, at least 1)
+	Burst int
+
+	// MaxInFlight caps the number of concurrent requests. Zero means no cap.
+	MaxInFlight int
+}
+
+// RateLimitError is returned when a call would have to wait for the client's
+// rate limit or a request slot past its context deadline
+type RateLimitError struct {
+	// Endpoint is the endpoint name of the call
+	Endpoint string
+
+	// Wait is how long the call would have had to wait for the rate limit
+	Wait time.Duration
+
+	// Err is the context error if the call gave up waiting for a request slot
+	Err error
+}
+
+// Error implements the error interface
+func (e *RateLimitError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("sagapay: %s: gave up waiting for a request slot: %v", e.Endpoint, e.Err)
+	}
+	return fmt.Sprintf("sagapay: %s: waiting %s for the client rate limit would exceed the context deadline", e.Endpoint, e.Wait)
+}
+
+// Is reports whether target is ErrRateLimitWait
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimitWait
+}
+
+// Unwrap returns the context error, if any
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
+
+// limiter is a token bucket with an optional cap on in-flight requests. It can
+// also be paused, e.g. when the API asks clients to back off with Retry-After.
+type limiter struct {
+	mu          sync.Mutex
+	rate        float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+
+	// inFlight holds a slot per running request; nil means no cap
+	inFlight chan struct{}
+}
+
+// newLimiter creates a limiter with a full bucket at the given time
+func newLimiter(rl RateLimit, now time.Time) *limiter {
+	l := &limiter{rate: rl.RequestsPerSecond, last: now}
+	if l.rate > 0 {
+		burst := rl.Burst
+		if burst <= 0 {
+			burst = max(1, int(math.Ceil(l.rate)))
+		}
+		l.burst = float64(burst)
+		l.tokens = l.burst
+	}
+	if rl.MaxInFlight > 0 {
+		l.inFlight = make(chan struct{}, rl.MaxInFlight)
+	}
+	return l
+}
+
+// reserve takes a token and returns how long the caller must wait before using it
+func (l *limiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var wait time.Duration
+	if l.rate > 0 {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		l.tokens--
+		if l.tokens < 0 {
+			wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+		}
+	}
+	if paused := l.pausedUntil.Sub(now); paused > wait {
+		wait = paused
+	}
+	return wait
+}
+
+// cancel returns a token taken by reserve that was not used
+func (l *limiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate > 0 {
+		l.tokens = min(l.burst, l.tokens+1)
+	}
+}
+
+// pause holds back all requests until the given time
+func (l *limiter) pause(until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// limitersFor returns the limiters that apply to an endpoint, most specific first
+func (c *Client) limitersFor(endpoint string) []*limiter {
+	if l, ok := c.endpointLimiters[endpoint]; ok {
+		return []*limiter{l, c.limiter}
+	}
+	return []*limiter{c.limiter}
+}
+
+// acquire waits until the rate limits allow a request to endpoint and a
+// request slot is free. The returned function releases the slot. If the wait
+// would exceed the context deadline it fails at once with a *RateLimitError.
+func (c *Client) acquire(ctx context.Context, endpoint string) (func(), error) {
+	limiters := c.limitersFor(endpoint)
+
+	now := c.now()
+	var wait time.Duration
+	for _, l := range limiters {
+		wait = max(wait, l.reserve(now))
+	}
+	cancel := func() {
+		for _, l := range limiters {
+			l.cancel()
+		}
+	}
+
+	if wait > 0 {
+		if deadline, ok := ctx.Deadline(); ok && now.Add(wait).After(deadline) {
+			cancel()
+			return nil, &RateLimitError{Endpoint: endpoint, Wait: wait}
+		}
+		if err := sleep(ctx, wait); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	// Take request slots in a fixed order so callers cannot deadlock
+	var held []chan struct{}
+	release := func() {
+		for _, slot := range held {
+			<-slot
+		}
+	}
+	for _, l := range limiters {
+		if l.inFlight == nil {
+			continue
+		}
+		select {
+		case l.inFlight <- struct{}{}:
+			held = append(held, l.inFlight)
+		case <-ctx.Done():
+			release()
+			return nil, &RateLimitError{Endpoint: endpoint, Err: ctx.Err()}
+		}
+	}
+	return release, nil
+}
+
+// pause holds back requests to endpoint, and all other requests, until the given time
+func (c *Client) pause(endpoint string, until time.Time) {
+	for _, l := range c.limitersFor(endpoint) {
+		l.pause(until)
+	}
+}
+
+// retryAfter parses the Retry-After header of a response, given in seconds or as an HTTP date
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(0, time.Duration(seconds)*time.Second)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(0, at.Sub(now))
+	}
+	return 0
+}
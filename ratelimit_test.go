@@ -0,0 +1,272 @@
+package sagapay
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testClock is a clock that only moves when told to
+type testClock struct{ t time.Time }
+
+func (c *testClock) now() time.Time          { return c.t }
+func (c *testClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestLimiterRefill(t *testing.T) {
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	l := newLimiter(RateLimit{RequestsPerSecond: 2, Burst: 2}, start)
+
+	steps := []struct {
+		at   time.Duration
+		want time.Duration
+	}{
+		{0, 0},
+		{0, 0},
+		{0, 500 * time.Millisecond},
+		{0, time.Second},
+		// Two tokens refill per second, both owed already
+		{time.Second, 500 * time.Millisecond},
+		// The bucket never holds more than the burst
+		{time.Hour, 0},
+		{time.Hour, 0},
+		{time.Hour, 500 * time.Millisecond},
+	}
+	for i, step := range steps {
+		if got := l.reserve(start.Add(step.at)); got != step.want {
+			t.Errorf("step %d: reserve at +%s = %s, want %s", i, step.at, got, step.want)
+		}
+	}
+
+	// A cancelled reservation gives its token back
+	l.cancel()
+	if got := l.reserve(start.Add(time.Hour)); got != 500*time.Millisecond {
+		t.Errorf("reserve after cancel = %s, want 500ms", got)
+	}
+}
+
+func TestLimiterDefaults(t *testing.T) {
+	now := time.Now()
+	if l := newLimiter(RateLimit{RequestsPerSecond: 2.5}, now); l.burst != 3 {
+		t.Errorf("default burst = %v, want 3", l.burst)
+	}
+	if l := newLimiter(RateLimit{RequestsPerSecond: 0.1}, now); l.burst != 1 {
+		t.Errorf("default burst = %v, want 1", l.burst)
+	}
+
+	// Without a rate every reservation is immediate
+	l := newLimiter(RateLimit{}, now)
+	for i := 0; i < 100; i++ {
+		if wait := l.reserve(now); wait != 0 {
+			t.Fatalf("reserve without a rate = %s", wait)
+		}
+	}
+}
+
+func TestLimiterPause(t *testing.T) {
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	l := newLimiter(RateLimit{}, start)
+
+	l.pause(start.Add(3 * time.Second))
+	l.pause(start.Add(time.Second)) // an earlier pause does not shorten it
+	if got := l.reserve(start); got != 3*time.Second {
+		t.Errorf("reserve while paused = %s, want 3s", got)
+	}
+	if got := l.reserve(start.Add(2 * time.Second)); got != time.Second {
+		t.Errorf("reserve later while paused = %s, want 1s", got)
+	}
+	if got := l.reserve(start.Add(3 * time.Second)); got != 0 {
+		t.Errorf("reserve after the pause = %s, want 0", got)
+	}
+}
+
+// newRateLimitedClient returns a client for srv with a frozen clock and the given limits
+func newRateLimitedClient(t *testing.T, srv *httptest.Server, clock *testClock, rl RateLimit, endpoints map[string]RateLimit) *Client {
+	t.Helper()
+	c, err := NewClient(Config{
+		BaseURL:            srv.URL,
+		APIKey:             "key",
+		APISecret:          "secret",
+		RetryPolicy:        &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Minute},
+		RateLimit:          &rl,
+		EndpointRateLimits: endpoints,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.now = clock.now
+	c.limiter = newLimiter(rl, clock.now())
+	for endpoint, rl := range endpoints {
+		c.endpointLimiters[endpoint] = newLimiter(rl, clock.now())
+	}
+	return c
+}
+
+func TestAcquireDeadline(t *testing.T) {
+	clock := &testClock{time.Now()}
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	c := newRateLimitedClient(t, srv, clock, RateLimit{RequestsPerSecond: 1, Burst: 1}, map[string]RateLimit{
+		EndpointFetchWalletBalance: {RequestsPerSecond: 0.25, Burst: 1},
+	})
+
+	ctx, cancel := context.WithDeadline(context.Background(), clock.now().Add(500*time.Millisecond))
+	defer cancel()
+
+	release, err := c.acquire(ctx, EndpointFetchWalletBalance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	// The endpoint limit is the stricter one
+	_, err = c.acquire(ctx, EndpointFetchWalletBalance)
+	var rlErr *RateLimitError
+	if !errors.As(err, &rlErr) || rlErr.Wait != 4*time.Second || rlErr.Endpoint != EndpointFetchWalletBalance {
+		t.Fatalf("acquire = %v, want a 4s RateLimitError", err)
+	}
+	if !errors.Is(err, ErrRateLimitWait) {
+		t.Error("RateLimitError does not match ErrRateLimitWait")
+	}
+
+	// The failed call returned its tokens, so the shared limit refills on time
+	clock.advance(time.Second)
+	if release, err := c.acquire(ctx, EndpointCheckTransactionStatus); err != nil {
+		t.Errorf("acquire after refill = %v", err)
+	} else {
+		release()
+	}
+}
+
+func TestAcquireInFlight(t *testing.T) {
+	clock := &testClock{time.Now()}
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	c := newRateLimitedClient(t, srv, clock, RateLimit{MaxInFlight: 1}, nil)
+
+	release, err := c.acquire(context.Background(), EndpointCreateDeposit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var rlErr *RateLimitError
+	if _, err := c.acquire(ctx, EndpointCreateDeposit); !errors.As(err, &rlErr) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("acquire with no free slot = %v, want a RateLimitError wrapping context.Canceled", err)
+	}
+
+	acquired := make(chan func())
+	go func() {
+		release, err := c.acquire(context.Background(), EndpointCreateDeposit)
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- release
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("a second request got a slot while the first was in flight")
+	case <-time.After(10 * time.Millisecond):
+	}
+	release()
+	(<-acquired)()
+}
+
+func TestRetryAfterPausesClient(t *testing.T) {
+	tests := []struct {
+		name          string
+		retryAfter    string
+		maxRetryAfter time.Duration
+		wantPause     time.Duration
+	}{
+		{"seconds", "30", time.Minute, 30 * time.Second},
+		{"date", "Thu, 01 Oct 2026 12:00:45 GMT", time.Minute, 45 * time.Second},
+		{"over the cap", "120", time.Minute, 0},
+		{"over the default cap", "11", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				w.Header().Set("Retry-After", tt.retryAfter)
+				w.WriteHeader(http.StatusTooManyRequests)
+			}))
+			defer srv.Close()
+
+			clock := &testClock{time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)}
+			c := newRateLimitedClient(t, srv, clock, RateLimit{}, nil)
+			c.retry.MaxAttempts = 1
+			c.retry.MaxRetryAfter = tt.maxRetryAfter
+			c.retry.MaxBackoff = 0
+
+			err := c.sendRequest(context.Background(), EndpointCheckTransactionStatus, http.MethodGet,
+				TransactionStatusParams{Address: "0xabc", TransactionType: TransactionTypeDeposit}, &TransactionStatusResponse{})
+			if !errors.Is(err, ErrRateLimited) {
+				t.Fatalf("err = %v, want ErrRateLimited", err)
+			}
+			if attempts.Load() != 1 {
+				t.Errorf("%d attempts, want 1", attempts.Load())
+			}
+			if got := c.limiter.reserve(clock.now()); got != tt.wantPause {
+				t.Errorf("pause = %s, want %s", got, tt.wantPause)
+			}
+		})
+	}
+}
+
+func TestRetryAfterOverCapIsNotRetried(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	clock := &testClock{time.Now()}
+	c := newRateLimitedClient(t, srv, clock, RateLimit{}, nil)
+
+	start := time.Now()
+	err := c.sendRequest(context.Background(), EndpointCheckTransactionStatus, http.MethodGet,
+		TransactionStatusParams{Address: "0xabc", TransactionType: TransactionTypeDeposit}, &TransactionStatusResponse{})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !errors.Is(err, ErrRateLimited) || apiErr.RetryAfter != time.Hour {
+		t.Fatalf("err = %#v, want a 429 APIError with a one hour RetryAfter", err)
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("%d attempts, want 1", attempts.Load())
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %s, want at once", elapsed)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"0", 0},
+		{"-5", 0},
+		{"7", 7 * time.Second},
+		{"Thu, 01 Oct 2026 12:01:00 GMT", time.Minute},
+		{"Thu, 01 Oct 2026 11:00:00 GMT", 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.value != "" {
+			header.Set("Retry-After", tt.value)
+		}
+		if got := retryAfter(header, now); got != tt.want {
+			t.Errorf("retryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
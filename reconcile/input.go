@@ -0,0 +1,118 @@
+package reconcile
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/halfindex/sagapay-go-sdk"
+)
+
+// expectedColumns are the required columns of an expected payments CSV file
+var expectedColumns = []string{"network", "address", "amount"}
+
+// ReadExpectedCSV reads expected payments from CSV. The first row is a
+// header naming the columns network, address, amount and, optionally, udf
+// (or order_id) and contract, in any order; other columns are ignored.
+func ReadExpectedCSV(r io.Reader) ([]Expected, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read expected payments CSV header: %w", err)
+	}
+	index := make(map[string]int)
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := index["udf"]; !ok {
+		if i, ok := index["order_id"]; ok {
+			index["udf"] = i
+		}
+	}
+	for _, name := range expectedColumns {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("expected payments CSV header is missing the %q column", name)
+		}
+	}
+
+	var expected []Expected
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return expected, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read expected payments CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		get := func(name string) string {
+			if i, ok := index[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		expected = append(expected, Expected{
+			Line:            line,
+			UDF:             get("udf"),
+			NetworkType:     sagapay.NetworkType(strings.ToUpper(get("network"))),
+			ContractAddress: get("contract"),
+			Address:         get("address"),
+			Amount:          get("amount"),
+		})
+	}
+}
+
+// ReadExpectedJSONL reads expected payments from JSON lines, one object per
+// line with the keys udf, network, contract, address and amount
+func ReadExpectedJSONL(r io.Reader) ([]Expected, error) {
+	var expected []Expected
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var e Expected
+		if err := json.Unmarshal([]byte(text), &e); err != nil {
+			return nil, fmt.Errorf("failed to read expected payments JSONL: line %d: %w", line, err)
+		}
+		e.Line = line
+		e.NetworkType = sagapay.NetworkType(strings.ToUpper(string(e.NetworkType)))
+		expected = append(expected, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read expected payments JSONL: %w", err)
+	}
+	return expected, nil
+}
+
+// ReadWebhookUDFs reads webhook payloads, one JSON object per line as they
+// were received, and returns the UDF of each transaction by ID, for
+// Config.UDFs. Payloads without a UDF are skipped.
+func ReadWebhookUDFs(r io.Reader) (map[string]string, error) {
+	udfs := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var payload sagapay.WebhookPayload
+		if err := json.Unmarshal([]byte(text), &payload); err != nil {
+			return nil, fmt.Errorf("failed to read webhook payloads: line %d: %w", line, err)
+		}
+		if payload.ID != "" && payload.UDF != "" {
+			udfs[payload.ID] = payload.UDF
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read webhook payloads: %w", err)
+	}
+	return udfs, nil
+}
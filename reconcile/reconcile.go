@@ -0,0 +1,505 @@
+// Package reconcile matches the payments a merchant expects against the
+// transactions SagaPay reports for the receiving addresses, and reports
+// which were paid, which were not, and which transactions nobody expected.
+//
+//	expected, err := reconcile.ReadExpectedCSV(file)
+//	if err != nil {
+//	    return err
+//	}
+//	report, err := reconcile.Run(ctx, client, expected, reconcile.Config{
+//	    Tolerance: sagapay.MustParseAmount("0.01"),
+//	})
+//	if err != nil {
+//	    return err
+//	}
+//	err = report.WriteCSV(w)
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/halfindex/sagapay-go-sdk"
+)
+
+// Status classifies a result of a reconciliation
+type Status string
+
+// Result statuses
+const (
+	// StatusMatched is an expected payment with a completed transaction of
+	// the expected amount, within the tolerance
+	StatusMatched Status = "MATCHED"
+
+	// StatusMissing is an expected payment without a transaction, or whose
+	// transaction failed or was cancelled
+	StatusMissing Status = "MISSING"
+
+	// StatusUnexpected is a transaction that matches no expected payment
+	StatusUnexpected Status = "UNEXPECTED"
+
+	// StatusAmountMismatch is an expected payment whose completed
+	// transaction differs from the expected amount by more than the tolerance
+	StatusAmountMismatch Status = "AMOUNT_MISMATCH"
+
+	// StatusPending is an expected payment whose transaction is not final yet
+	StatusPending Status = "PENDING"
+
+	// StatusError is an expected payment whose address could not be checked
+	StatusError Status = "ERROR"
+)
+
+// statuses lists the statuses in the order reports summarize them
+var statuses = []Status{
+	StatusMatched, StatusPending, StatusAmountMismatch, StatusMissing, StatusUnexpected, StatusError,
+}
+
+// Match names how a transaction was matched to an expected payment
+type Match string
+
+// Match methods, tried in this order
+const (
+	// MatchUDF matched a transaction whose UDF, from Config.UDFs, is the
+	// payment's UDF
+	MatchUDF Match = "udf"
+
+	// MatchAmount matched a transaction to the same address with an amount
+	// within the tolerance
+	MatchAmount Match = "amount"
+
+	// MatchAddress matched the closest remaining transaction to the same address
+	MatchAddress Match = "address"
+)
+
+// Expected is a payment expected to arrive at an address
+type Expected struct {
+	// Line is the payment's line in the source file, for error messages
+	Line int `json:"-"`
+
+	// UDF is the order ID the deposit address was created with. Optional;
+	// it labels the payment in reports and is matched against Config.UDFs.
+	UDF string `json:"udf,omitempty"`
+
+	NetworkType sagapay.NetworkType `json:"network"`
+
+	// ContractAddress is the token, "0" for the network's native coin. If
+	// empty, a transaction of any token on the network matches.
+	ContractAddress string `json:"contract,omitempty"`
+
+	Address string `json:"address"`
+	Amount  string `json:"amount"`
+}
+
+// Config configures a reconciliation
+type Config struct {
+	// Tolerance is the largest difference between the expected and received
+	// amounts that still counts as a match
+	Tolerance sagapay.Amount
+
+	// TolerancePercent is the tolerance as a percentage of the expected
+	// amount, e.g. "0.5" for 0.5%. The larger of the two tolerances applies.
+	TolerancePercent sagapay.Amount
+
+	// TransactionType is the type of transactions to match (default deposit)
+	TransactionType sagapay.TransactionType
+
+	// Concurrency bounds the requests in flight (default sagapay.DefaultBatchConcurrency)
+	Concurrency int
+
+	// UDFs maps transaction IDs to the UDF of their deposit. Transaction
+	// status responses do not carry the UDF, but webhook payloads do;
+	// collect them with ReadWebhookUDFs or from your own webhook records.
+	// Optional: payments on a permanent address can only be told apart by
+	// amount without it.
+	UDFs map[string]string
+
+	// Now returns the time the report is generated at. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Result is the outcome of one expected payment or unexpected transaction
+type Result struct {
+	Status Status
+
+	// Expected is the expected payment, nil for StatusUnexpected
+	Expected *Expected
+
+	// Transaction is the transaction, nil for StatusMissing without one
+	// and StatusError
+	Transaction *sagapay.Transaction
+
+	// MatchedBy is how the transaction was matched, empty without one or
+	// for StatusUnexpected
+	MatchedBy Match
+
+	// Difference is the received minus the expected amount, e.g. "-0.5",
+	// empty unless both are known
+	Difference string
+
+	// Err is why the address could not be checked, for StatusError
+	Err error
+}
+
+// Report is the outcome of a reconciliation: the expected payments in input
+// order followed by the unexpected transactions
+type Report struct {
+	GeneratedAt time.Time
+	Results     []Result
+}
+
+// Run checks the transactions of every distinct address of the expected
+// payments, at most Config.Concurrency at a time, and matches them. Each
+// expected payment is matched to at most one transaction of the same
+// token: first to a transaction with its UDF in Config.UDFs, then by an
+// amount within the tolerance, then to the closest remaining transaction.
+// A transaction whose UDF is known only matches payments without a UDF or
+// with the same one. Completed transactions then decide between
+// MATCHED and AMOUNT_MISMATCH; transactions still in flight are PENDING.
+//
+// The payments are validated up front; a *sagapay.ValidationError lists every
+// invalid one, with fields named like "line 3: address". An address that
+// cannot be checked gives its payments StatusError. An authentication
+// failure (sagapay.ErrUnauthorized or sagapay.ErrForbidden) stops the run and
+// is returned with the report; otherwise the error is nil unless ctx is done.
+func Run(ctx context.Context, api sagapay.API, expected []Expected, config Config) (*Report, error) {
+	if config.TransactionType == "" {
+		config.TransactionType = sagapay.TransactionTypeDeposit
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = sagapay.DefaultBatchConcurrency
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	payments, err := validate(expected)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check each address once; ERC20 and BEP20 payments may share one
+	index := make(map[string]int)
+	var addresses []string
+	var groups [][]*payment
+	for _, p := range payments {
+		key := sagapay.NormalizeAddress(p.NetworkType, p.Address)
+		i, ok := index[key]
+		if !ok {
+			i = len(addresses)
+			index[key] = i
+			addresses = append(addresses, p.Address)
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], p)
+	}
+
+	responses, errs, fatal := fetch(ctx, api, addresses, config)
+
+	report := &Report{GeneratedAt: config.Now()}
+	var unexpected []Result
+	for i, group := range groups {
+		if errs[i] != nil {
+			for _, p := range group {
+				p.result = Result{Status: StatusError, Expected: p.Expected, Err: errs[i]}
+			}
+			continue
+		}
+		unexpected = append(unexpected, match(group, responses[i].Transactions, config)...)
+	}
+	for _, p := range payments {
+		report.Results = append(report.Results, p.result)
+	}
+	report.Results = append(report.Results, unexpected...)
+
+	if fatal != nil {
+		return report, fatal
+	}
+	return report, ctx.Err()
+}
+
+// payment is a validated expected payment being matched
+type payment struct {
+	*Expected
+	amount sagapay.Amount
+	result Result
+}
+
+// validate parses the expected payments, or returns a *sagapay.ValidationError
+// listing every invalid one
+func validate(expected []Expected) ([]*payment, error) {
+	verr := &sagapay.ValidationError{}
+	add := func(e *Expected, field string, err error) {
+		verr.Fields = append(verr.Fields, &sagapay.FieldError{
+			Field:   fmt.Sprintf("line %d: %s", e.Line, field),
+			Message: "is invalid: " + err.Error(),
+			Err:     err,
+		})
+	}
+	if len(expected) == 0 {
+		verr.Fields = append(verr.Fields, &sagapay.FieldError{Field: "expected", Message: "must not be empty"})
+	}
+
+	payments := make([]*payment, len(expected))
+	for i := range expected {
+		e := &Expected{}
+		*e = expected[i]
+		p := &payment{Expected: e}
+		payments[i] = p
+
+		if e.Address == "" {
+			verr.Fields = append(verr.Fields, &sagapay.FieldError{
+				Field: fmt.Sprintf("line %d: address", e.Line), Message: "is required",
+			})
+		} else if err := sagapay.ValidateAddress(e.NetworkType, e.Address); err != nil {
+			field := "address"
+			if errors.Is(err, sagapay.ErrUnsupportedNetwork) {
+				field = "networkType"
+			}
+			add(e, field, err)
+		}
+		if e.ContractAddress != "" {
+			if err := sagapay.ValidateContractAddress(e.NetworkType, e.ContractAddress); err != nil &&
+				!errors.Is(err, sagapay.ErrUnsupportedNetwork) {
+				add(e, "contractAddress", err)
+			}
+		}
+		amount, err := sagapay.ParseAmount(e.Amount)
+		if err != nil {
+			add(e, "amount", err)
+		} else if amount.IsZero() {
+			add(e, "amount", fmt.Errorf("%w: must be greater than zero", sagapay.ErrInvalidAmount))
+		}
+		p.amount = amount
+	}
+	if len(verr.Fields) > 0 {
+		return nil, verr
+	}
+	return payments, nil
+}
+
+// fetch checks the transactions of the addresses in parallel and returns
+// the responses and per-address errors in address order, and the error
+// that stopped the run, if any
+func fetch(ctx context.Context, api sagapay.API, addresses []string, config Config) ([]*sagapay.TransactionStatusResponse, []error, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		fatal     error
+		fatalOnce sync.Once
+		wg        sync.WaitGroup
+	)
+	responses := make([]*sagapay.TransactionStatusResponse, len(addresses))
+	errs := make([]error, len(addresses))
+	jobs := make(chan int)
+
+	for w := 0; w < min(config.Concurrency, len(addresses)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				responses[i], errs[i] = api.CheckTransactionStatus(ctx, addresses[i], config.TransactionType)
+
+				// Every other address would fail the same way
+				if errors.Is(errs[i], sagapay.ErrUnauthorized) || errors.Is(errs[i], sagapay.ErrForbidden) {
+					fatalOnce.Do(func() {
+						fatal = errs[i]
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := range addresses {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Report why addresses that were skipped or interrupted were not checked
+	for i := range addresses {
+		if responses[i] != nil && errs[i] == nil || errs[i] != nil && !errors.Is(errs[i], context.Canceled) {
+			continue
+		}
+		switch {
+		case fatal != nil:
+			errs[i] = fatal
+		case errs[i] == nil:
+			errs[i] = ctx.Err()
+		}
+	}
+	return responses, errs, fatal
+}
+
+// match matches the transactions of one address to its expected payments,
+// filling in their results, and returns the transactions left unmatched
+func match(group []*payment, transactions []sagapay.Transaction, config Config) []Result {
+	claimed := make([]bool, len(transactions))
+	matched := make([]bool, len(group))
+
+	// pick claims the best unclaimed transaction accepted by ok for the payment
+	pick := func(j int, by Match, ok func(p *payment, tx *sagapay.Transaction, amount sagapay.Amount) bool) {
+		p := group[j]
+		best := -1
+		var bestDiff sagapay.Amount
+		for i := range transactions {
+			tx := &transactions[i]
+			if claimed[i] || !sameToken(p.Expected, tx) || otherOrder(p.Expected, tx, config) {
+				continue
+			}
+			amount, err := tx.AmountValue()
+			if err != nil || !ok(p, tx, amount) {
+				continue
+			}
+			diff := amount.Diff(p.amount)
+			if best < 0 || better(tx, diff, &transactions[best], bestDiff) {
+				best, bestDiff = i, diff
+			}
+		}
+		if best < 0 {
+			return
+		}
+		claimed[best], matched[j] = true, true
+		p.result = classify(p, &transactions[best], by, config)
+	}
+
+	passes := []struct {
+		by Match
+		ok func(p *payment, tx *sagapay.Transaction, amount sagapay.Amount) bool
+	}{
+		{MatchUDF, func(p *payment, tx *sagapay.Transaction, amount sagapay.Amount) bool {
+			return p.UDF != "" && config.UDFs[tx.ID] == p.UDF
+		}},
+		{MatchAmount, func(p *payment, tx *sagapay.Transaction, amount sagapay.Amount) bool {
+			return amount.Diff(p.amount).Cmp(tolerance(p.amount, config)) <= 0
+		}},
+		{MatchAddress, func(*payment, *sagapay.Transaction, sagapay.Amount) bool {
+			return true
+		}},
+	}
+	for _, pass := range passes {
+		for j := range group {
+			if !matched[j] {
+				pick(j, pass.by, pass.ok)
+			}
+		}
+	}
+
+	for j, p := range group {
+		if !matched[j] {
+			p.result = Result{Status: StatusMissing, Expected: p.Expected}
+		}
+	}
+
+	var unexpected []Result
+	for i := range transactions {
+		if !claimed[i] {
+			tx := transactions[i]
+			unexpected = append(unexpected, Result{Status: StatusUnexpected, Transaction: &tx})
+		}
+	}
+	sort.SliceStable(unexpected, func(i, j int) bool {
+		return unexpected[i].Transaction.CreatedAt.Before(unexpected[j].Transaction.CreatedAt)
+	})
+	return unexpected
+}
+
+// classify returns the result of a payment matched to a transaction
+func classify(p *payment, tx *sagapay.Transaction, by Match, config Config) Result {
+	copied := *tx
+	result := Result{Expected: p.Expected, Transaction: &copied, MatchedBy: by}
+	amount, _ := tx.AmountValue()
+	result.Difference = difference(amount, p.amount)
+
+	switch {
+	case !tx.Status.IsTerminal():
+		result.Status = StatusPending
+	case !tx.Status.IsSuccess():
+		result.Status = StatusMissing
+	case amount.Diff(p.amount).Cmp(tolerance(p.amount, config)) <= 0:
+		result.Status = StatusMatched
+	default:
+		result.Status = StatusAmountMismatch
+	}
+	return result
+}
+
+// tolerance returns the largest difference from amount that still matches
+func tolerance(amount sagapay.Amount, config Config) sagapay.Amount {
+	if config.TolerancePercent.IsZero() {
+		return config.Tolerance
+	}
+	// amount × percent / 100, truncated to the precision amounts can hold
+	decimals := amount.Decimals() + config.TolerancePercent.Decimals() + 2
+	units, _ := amount.BaseUnits(amount.Decimals())
+	percent, _ := config.TolerancePercent.BaseUnits(config.TolerancePercent.Decimals())
+	units.Mul(units, percent)
+	if decimals > sagapay.MaxDecimals {
+		units.Quo(units, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals-sagapay.MaxDecimals)), nil))
+		decimals = sagapay.MaxDecimals
+	}
+	relative, _ := sagapay.NewAmountFromBaseUnits(units, decimals)
+	if relative.Cmp(config.Tolerance) > 0 {
+		return relative
+	}
+	return config.Tolerance
+}
+
+// better reports whether transaction a, off by diff, is a better match than
+// b, off by bdiff: completed beats in flight beats failed, then the closer
+// amount, then the earlier transaction
+func better(a *sagapay.Transaction, diff sagapay.Amount, b *sagapay.Transaction, bdiff sagapay.Amount) bool {
+	if ra, rb := rank(a.Status), rank(b.Status); ra != rb {
+		return ra < rb
+	}
+	if c := diff.Cmp(bdiff); c != 0 {
+		return c < 0
+	}
+	return a.CreatedAt.Before(b.CreatedAt)
+}
+
+// rank orders transaction statuses by how well they settle a payment
+func rank(status sagapay.TransactionStatus) int {
+	switch {
+	case status.IsSuccess():
+		return 0
+	case !status.IsTerminal():
+		return 1
+	}
+	return 2
+}
+
+// sameToken reports whether the transaction is in the payment's token
+func sameToken(e *Expected, tx *sagapay.Transaction) bool {
+	if tx.NetworkType != e.NetworkType {
+		return false
+	}
+	return e.ContractAddress == "" ||
+		sagapay.NormalizeAddress(e.NetworkType, tx.ContractAddress) == sagapay.NormalizeAddress(e.NetworkType, e.ContractAddress)
+}
+
+// otherOrder reports whether the transaction is known to pay another order
+// than the payment
+func otherOrder(e *Expected, tx *sagapay.Transaction, config Config) bool {
+	udf, ok := config.UDFs[tx.ID]
+	return ok && udf != "" && e.UDF != "" && udf != e.UDF
+}
+
+// difference formats received - expected with a sign
+func difference(received, expected sagapay.Amount) string {
+	if d, err := received.Sub(expected); err == nil {
+		return d.String()
+	}
+	return "-" + expected.Diff(received).String()
+}
@@ -0,0 +1,231 @@
+package reconcile_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/halfindex/sagapay-go-sdk"
+	"github.com/halfindex/sagapay-go-sdk/reconcile"
+	"github.com/halfindex/sagapay-go-sdk/sagapaytest"
+)
+
+// fixture is a fake server with a client and a webhook receiver for its deposits
+type fixture struct {
+	t      *testing.T
+	srv    *sagapaytest.Server
+	client *sagapay.Client
+	ipnURL string
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(receiver.Close)
+	srv := sagapaytest.NewServer(sagapaytest.Config{})
+	t.Cleanup(srv.Close)
+	client, err := sagapay.NewClient(srv.ClientConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fixture{t: t, srv: srv, client: client, ipnURL: receiver.URL}
+}
+
+// deposit creates a BEP20 deposit address for an order
+func (f *fixture) deposit(udf string) string {
+	f.t.Helper()
+	resp, err := f.client.CreateDeposit(context.Background(), sagapay.CreateDepositParams{
+		NetworkType:     sagapay.NetworkTypeBEP20,
+		ContractAddress: sagapay.NativeContractAddress,
+		Amount:          "10",
+		IPNUrl:          f.ipnURL,
+		UDF:             udf,
+	})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return resp.Address
+}
+
+// pay pays amount to address and moves the transaction to status
+func (f *fixture) pay(address, amount string, status sagapay.TransactionStatus) *sagapay.Transaction {
+	f.t.Helper()
+	tx, err := f.srv.Pay(address, amount)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	if status != tx.Status {
+		if tx, err = f.srv.SetStatus(tx.ID, status); err != nil {
+			f.t.Fatal(err)
+		}
+	}
+	return tx
+}
+
+// expected returns an expected BEP20 payment
+func expected(udf, address, amount string) reconcile.Expected {
+	return reconcile.Expected{
+		UDF:             udf,
+		NetworkType:     sagapay.NetworkTypeBEP20,
+		ContractAddress: sagapay.NativeContractAddress,
+		Address:         address,
+		Amount:          amount,
+	}
+}
+
+// outcome summarizes a result as "udf status matchedBy amount"
+func outcome(r reconcile.Result) string {
+	var udf, amount string
+	if r.Expected != nil {
+		udf = r.Expected.UDF
+	}
+	if r.Transaction != nil {
+		amount = r.Transaction.Amount
+	}
+	return strings.Join([]string{udf, string(r.Status), string(r.MatchedBy), amount}, " ")
+}
+
+func outcomes(report *reconcile.Report) string {
+	lines := make([]string, len(report.Results))
+	for i, result := range report.Results {
+		lines[i] = outcome(result)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestRun(t *testing.T) {
+	f := newFixture(t)
+	matched, pending, mismatch, missing, failed := f.deposit("order-1"), f.deposit("order-2"), f.deposit("order-3"), f.deposit("order-4"), f.deposit("order-5")
+	f.pay(matched, "10.005", sagapay.TransactionStatusCompleted)
+	f.pay(matched, "3", sagapay.TransactionStatusCompleted)
+	f.pay(pending, "20", sagapay.TransactionStatusProcessing)
+	f.pay(mismatch, "29", sagapay.TransactionStatusCompleted)
+	f.pay(failed, "50", sagapay.TransactionStatusFailed)
+
+	report, err := reconcile.Run(context.Background(), f.client, []reconcile.Expected{
+		expected("order-1", matched, "10"),
+		expected("order-2", pending, "20"),
+		expected("order-3", mismatch, "30"),
+		expected("order-4", missing, "40"),
+		expected("order-5", failed, "50"),
+	}, reconcile.Config{Tolerance: sagapay.MustParseAmount("0.01")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{
+		"order-1 MATCHED amount 10.005",
+		"order-2 PENDING amount 20",
+		"order-3 AMOUNT_MISMATCH address 29",
+		"order-4 MISSING  ",
+		"order-5 MISSING amount 50",
+		" UNEXPECTED  3",
+	}, "\n")
+	if got := outcomes(report); got != want {
+		t.Errorf("results:\n%s\nwant:\n%s", got, want)
+	}
+	if diff := report.Results[2].Difference; diff != "-1" {
+		t.Errorf("difference %q, want -1", diff)
+	}
+
+	summary := report.Summary()
+	if summary.Expected != 5 || summary.Counts[reconcile.StatusMissing] != 2 || summary.Counts[reconcile.StatusUnexpected] != 1 {
+		t.Errorf("summary %+v", summary)
+	}
+	if len(summary.Tokens) != 1 || summary.Tokens[0].Expected.String() != "150" || summary.Tokens[0].Received.String() != "42.005" || summary.Tokens[0].Pending.String() != "20" {
+		t.Errorf("token totals %+v", summary.Tokens)
+	}
+}
+
+func TestRunMatchesUDF(t *testing.T) {
+	f := newFixture(t)
+	address := f.deposit("customer-7")
+
+	// Two orders of the same amount paid to one permanent address
+	first := f.pay(address, "10", sagapay.TransactionStatusCompleted)
+	second := f.pay(address, "10", sagapay.TransactionStatusProcessing)
+	orders := []reconcile.Expected{expected("order-1", address, "10"), expected("order-2", address, "10")}
+
+	// By amount alone, the completed transaction goes to the first order
+	report, err := reconcile.Run(context.Background(), f.client, orders, reconcile.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := outcomes(report), "order-1 MATCHED amount 10\norder-2 PENDING amount 10"; got != want {
+		t.Errorf("without UDFs:\n%s\nwant:\n%s", got, want)
+	}
+
+	report, err = reconcile.Run(context.Background(), f.client, orders, reconcile.Config{
+		UDFs: map[string]string{first.ID: "order-2", second.ID: "order-1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := outcomes(report), "order-1 PENDING udf 10\norder-2 MATCHED udf 10"; got != want {
+		t.Errorf("with UDFs:\n%s\nwant:\n%s", got, want)
+	}
+
+	// A transaction of another order is never matched by amount
+	report, err = reconcile.Run(context.Background(), f.client, orders[:1], reconcile.Config{
+		UDFs: map[string]string{first.ID: "order-2", second.ID: "order-2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := outcomes(report), "order-1 MISSING  \n UNEXPECTED  10\n UNEXPECTED  10"; got != want {
+		t.Errorf("with other orders' UDFs:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestReadWebhookUDFs(t *testing.T) {
+	f := newFixture(t)
+	tx := f.pay(f.deposit("order-1"), "10", sagapay.TransactionStatusPending)
+	other := f.pay(f.deposit(""), "5", sagapay.TransactionStatusPending)
+
+	var payloads bytes.Buffer
+	for _, delivery := range f.srv.Deliveries() {
+		payloads.Write(delivery.Body)
+		payloads.WriteString("\n\n")
+	}
+	udfs, err := reconcile.ReadWebhookUDFs(&payloads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(udfs) != 1 || udfs[tx.ID] != "order-1" {
+		t.Errorf("UDFs %v, want only %s: order-1", udfs, tx.ID)
+	}
+	if _, ok := udfs[other.ID]; ok {
+		t.Error("a payload without a UDF was read")
+	}
+
+	if _, err := reconcile.ReadWebhookUDFs(strings.NewReader("{}\n{\"id\":")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("ReadWebhookUDFs = %v, want a line 2 error", err)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	f := newFixture(t)
+	address := f.deposit("order-1")
+
+	_, err := reconcile.Run(context.Background(), f.client, []reconcile.Expected{
+		{Line: 2, NetworkType: sagapay.NetworkTypeBEP20, Address: "0x123", Amount: "1"},
+		{Line: 3, NetworkType: sagapay.NetworkTypeBEP20, Address: address, Amount: "0"},
+	}, reconcile.Config{})
+	var verr *sagapay.ValidationError
+	if !errors.As(err, &verr) || verr.Field("line 2: address") == nil || verr.Field("line 3: amount") == nil {
+		t.Fatalf("Run = %v, want address and amount errors", err)
+	}
+
+	f.srv.FailNext("/check-transaction-status", http.StatusBadRequest)
+	report, err := reconcile.Run(context.Background(), f.client, []reconcile.Expected{expected("order-1", address, "10")}, reconcile.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Results) != 1 || report.Results[0].Status != reconcile.StatusError || report.Results[0].Err == nil {
+		t.Errorf("results %v, want an ERROR result", report.Results)
+	}
+}
@@ -0,0 +1,222 @@
+package reconcile
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/halfindex/sagapay-go-sdk"
+)
+
+// Summary counts the results of a report by status and totals them by token
+type Summary struct {
+	// Expected is the number of expected payments
+	Expected int `json:"expected"`
+
+	// Counts is the number of results of each status
+	Counts map[Status]int `json:"counts"`
+
+	// Tokens are the totals per token, ordered by network and contract address
+	Tokens []TokenSummary `json:"tokens"`
+}
+
+// TokenSummary totals the results of one token
+type TokenSummary struct {
+	NetworkType     sagapay.NetworkType `json:"network"`
+	ContractAddress string              `json:"contract"`
+
+	// Symbol is the token symbol, if a transaction reported it
+	Symbol string `json:"symbol,omitempty"`
+
+	// Expected is the sum of the expected payments
+	Expected sagapay.Amount `json:"expected"`
+
+	// Received is the sum of the completed transactions, unexpected ones included
+	Received sagapay.Amount `json:"received"`
+
+	// Pending is the sum of the transactions not final yet
+	Pending sagapay.Amount `json:"pending"`
+}
+
+// Filter returns the results with any of the statuses
+func (r *Report) Filter(statuses ...Status) []Result {
+	var results []Result
+	for _, result := range r.Results {
+		if slices.Contains(statuses, result.Status) {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// Summary counts and totals the results
+func (r *Report) Summary() Summary {
+	type tokenKey struct {
+		network  sagapay.NetworkType
+		contract string
+	}
+
+	summary := Summary{Counts: make(map[Status]int)}
+	tokens := make(map[tokenKey]*TokenSummary)
+	for _, result := range r.Results {
+		summary.Counts[result.Status]++
+
+		var network sagapay.NetworkType
+		var contract string
+		if result.Expected != nil {
+			summary.Expected++
+			network, contract = result.Expected.NetworkType, result.Expected.ContractAddress
+		}
+		tx := result.Transaction
+		if tx != nil && (result.Expected == nil || contract == "") {
+			network, contract = tx.NetworkType, tx.ContractAddress
+		}
+
+		key := tokenKey{network, sagapay.NormalizeAddress(network, contract)}
+		token, ok := tokens[key]
+		if !ok {
+			token = &TokenSummary{NetworkType: network, ContractAddress: contract}
+			tokens[key] = token
+		}
+		if result.Expected != nil {
+			amount, _ := sagapay.ParseAmount(result.Expected.Amount)
+			token.Expected = token.Expected.Add(amount)
+		}
+		if tx != nil {
+			if token.Symbol == "" {
+				token.Symbol = tx.Token.Symbol
+			}
+			amount, _ := tx.AmountValue()
+			switch {
+			case tx.Status.IsSuccess():
+				token.Received = token.Received.Add(amount)
+			case !tx.Status.IsTerminal():
+				token.Pending = token.Pending.Add(amount)
+			}
+		}
+	}
+
+	for _, token := range tokens {
+		summary.Tokens = append(summary.Tokens, *token)
+	}
+	sort.Slice(summary.Tokens, func(i, j int) bool {
+		if summary.Tokens[i].NetworkType != summary.Tokens[j].NetworkType {
+			return summary.Tokens[i].NetworkType < summary.Tokens[j].NetworkType
+		}
+		return summary.Tokens[i].ContractAddress < summary.Tokens[j].ContractAddress
+	})
+	return summary
+}
+
+// record is a result flattened into one CSV row or JSON object
+type record struct {
+	Status            Status                    `json:"status"`
+	Line              int                       `json:"line,omitempty"`
+	UDF               string                    `json:"udf,omitempty"`
+	NetworkType       sagapay.NetworkType       `json:"network"`
+	ContractAddress   string                    `json:"contract,omitempty"`
+	Address           string                    `json:"address"`
+	ExpectedAmount    string                    `json:"expectedAmount,omitempty"`
+	ReceivedAmount    string                    `json:"receivedAmount,omitempty"`
+	Difference        string                    `json:"difference,omitempty"`
+	MatchedBy         Match                     `json:"matchedBy,omitempty"`
+	TransactionID     string                    `json:"transactionId,omitempty"`
+	TransactionStatus sagapay.TransactionStatus `json:"transactionStatus,omitempty"`
+	TxHash            string                    `json:"txHash,omitempty"`
+	Error             string                    `json:"error,omitempty"`
+}
+
+// csvColumns are the columns written by WriteCSV
+var csvColumns = []string{
+	"status", "line", "udf", "network", "contract", "address", "expected_amount", "received_amount",
+	"difference", "matched_by", "transaction_id", "transaction_status", "tx_hash", "error",
+}
+
+// record flattens the result
+func (r Result) record() record {
+	rec := record{Status: r.Status, Difference: r.Difference, MatchedBy: r.MatchedBy}
+	if e := r.Expected; e != nil {
+		rec.Line, rec.UDF = e.Line, e.UDF
+		rec.NetworkType, rec.ContractAddress, rec.Address = e.NetworkType, e.ContractAddress, e.Address
+		rec.ExpectedAmount = e.Amount
+	}
+	if tx := r.Transaction; tx != nil {
+		if r.Expected == nil {
+			rec.NetworkType, rec.ContractAddress, rec.Address = tx.NetworkType, tx.ContractAddress, tx.Address
+		}
+		rec.ReceivedAmount = tx.Amount
+		rec.TransactionID, rec.TransactionStatus, rec.TxHash = tx.ID, tx.Status, tx.TxHash
+	}
+	if r.Err != nil {
+		rec.Error = r.Err.Error()
+	}
+	return rec
+}
+
+// MarshalJSON encodes the result as a flat object, as in WriteJSON
+func (r Result) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.record())
+}
+
+// WriteCSV writes one row per result, after a header row
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvColumns)
+	for _, result := range r.Results {
+		rec := result.record()
+		line := ""
+		if rec.Line > 0 {
+			line = strconv.Itoa(rec.Line)
+		}
+		cw.Write([]string{
+			string(rec.Status), line, rec.UDF, string(rec.NetworkType), rec.ContractAddress, rec.Address,
+			rec.ExpectedAmount, rec.ReceivedAmount, rec.Difference, string(rec.MatchedBy),
+			rec.TransactionID, string(rec.TransactionStatus), rec.TxHash, rec.Error,
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write reconciliation CSV: %w", err)
+	}
+	return nil
+}
+
+// WriteJSON writes the report, its summary and its results as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(struct {
+		GeneratedAt time.Time `json:"generatedAt"`
+		Summary     Summary   `json:"summary"`
+		Results     []Result  `json:"results"`
+	}{r.GeneratedAt, r.Summary(), r.Results})
+	if err != nil {
+		return fmt.Errorf("failed to write reconciliation JSON: %w", err)
+	}
+	return nil
+}
+
+// WriteSummary writes the counts by status and the totals by token as
+// plain-text tables, for terminals and emails
+func (r *Report) WriteSummary(w io.Writer) error {
+	summary := r.Summary()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Reconciliation of %d expected payments at %s\n\n",
+		summary.Expected, r.GeneratedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintln(tw, "STATUS\tCOUNT")
+	for _, status := range statuses {
+		fmt.Fprintf(tw, "%s\t%d\n", status, summary.Counts[status])
+	}
+	fmt.Fprintln(tw, "\nNETWORK\tCONTRACT\tTOKEN\tEXPECTED\tRECEIVED\tPENDING")
+	for _, token := range summary.Tokens {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", token.NetworkType, token.ContractAddress, token.Symbol,
+			token.Expected, token.Received, token.Pending)
+	}
+	return tw.Flush()
+}
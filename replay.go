@@ -0,0 +1,291 @@
+package sagapay
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultWebhookTolerance is a reasonable tolerance window for webhook timestamps
+const DefaultWebhookTolerance = 5 * time.Minute
+
+// DedupStore remembers which webhook events have already been handled
+type DedupStore interface {
+	// Claim records key if it is absent and reports whether it did. It must
+	// be atomic: of several concurrent claims of a key, exactly one succeeds.
+	Claim(ctx context.Context, key string) (bool, error)
+
+	// Release forgets a claimed key, so the event can be claimed again
+	Release(ctx context.Context, key string) error
+}
+
+// WebhookEventKey returns the deduplication key for a webhook event.
+// SagaPay sends one event per status change, so the key combines the
+// transaction ID, status and transaction hash.
+func WebhookEventKey(payload *WebhookPayload) string {
+	return payload.ID + "|" + string(payload.Status) + "|" + payload.TxHash
+}
+
+// SetTolerance rejects webhooks whose timestamp is further than d from the
+// current time. Zero disables the check.
+func (h *WebhookHandler) SetTolerance(d time.Duration) *WebhookHandler {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tolerance = d
+	return h
+}
+
+// SetDedupStore makes Dispatch skip events that were already handled.
+// Each event is claimed before any handler runs, so concurrent duplicate
+// deliveries reach the handlers once. The claim is released if a handler
+// fails, so a webhook whose handler failed is processed again when it is
+// redelivered.
+func (h *WebhookHandler) SetDedupStore(store DedupStore) *WebhookHandler {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dedup = store
+	return h
+}
+
+// checkTimestamp rejects payloads outside the tolerance window
+func (h *WebhookHandler) checkTimestamp(payload *WebhookPayload) error {
+	h.mu.RLock()
+	tolerance, now := h.tolerance, h.now
+	h.mu.RUnlock()
+
+	if tolerance <= 0 {
+		return nil
+	}
+	if payload.Timestamp.IsZero() {
+		return fmt.Errorf("%w: missing timestamp", ErrStaleWebhook)
+	}
+
+	skew := now().Sub(payload.Timestamp)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > tolerance {
+		return fmt.Errorf("%w: timestamp %s is %s away from now", ErrStaleWebhook, payload.Timestamp.Format(time.RFC3339), skew.Round(time.Second))
+	}
+	return nil
+}
+
+// MemoryDedupStore is an in-memory DedupStore that remembers the most
+// recently added keys, evicting the least recently used beyond its capacity
+type MemoryDedupStore struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	keys     map[string]*list.Element
+}
+
+// NewMemoryDedupStore creates an in-memory store holding up to capacity keys
+func NewMemoryDedupStore(capacity int) *MemoryDedupStore {
+	if capacity <= 0 {
+		capacity = 10000
+	}
+	return &MemoryDedupStore{
+		capacity: capacity,
+		order:    list.New(),
+		keys:     make(map[string]*list.Element),
+	}
+}
+
+// Claim records key unless it is already recorded
+func (s *MemoryDedupStore) Claim(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.keys[key]; ok {
+		s.order.MoveToFront(elem)
+		return false, nil
+	}
+
+	s.keys[key] = s.order.PushFront(key)
+	for s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.keys, oldest.Value.(string))
+	}
+	return true, nil
+}
+
+// Release forgets key
+func (s *MemoryDedupStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.keys[key]; ok {
+		s.order.Remove(elem)
+		delete(s.keys, key)
+	}
+	return nil
+}
+
+// FileDedupStore is a DedupStore that appends claimed keys to a JSON lines
+// file, so duplicates are still detected after a restart. Released keys are
+// appended as release lines. A key claimed by a process that crashes before
+// its handlers finish stays claimed, so that event is not handled again after
+// the restart. The file is locked while open, so a second process fails with
+// ErrStoreLocked instead of handling the same events.
+type FileDedupStore struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	keys map[string]struct{}
+}
+
+// dedupEntry is a line of a FileDedupStore
+type dedupEntry struct {
+	Key      string `json:"key"`
+	Released bool   `json:"released,omitempty"`
+}
+
+// NewFileDedupStore opens or creates the dedup file at path and loads the
+// keys it contains. A final line torn by a crash is discarded. When more
+// than half of the lines are releases or repeated keys, the file is
+// compacted to the claimed keys where possible. It fails with an error matching
+// ErrStoreLocked if another process has the file open.
+func NewFileDedupStore(path string) (*FileDedupStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dedup store: %w", err)
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to lock dedup store %s: %w", path, err)
+	}
+
+	keys := make(map[string]struct{})
+	lines := 0
+	err = readJSONLines(file, func(line int, data []byte) error {
+		var entry dedupEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		if entry.Key == "" {
+			return errors.New("missing key")
+		}
+		lines++
+		if entry.Released {
+			delete(keys, entry.Key)
+		} else {
+			keys[entry.Key] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read dedup store: %w", err)
+	}
+
+	s := &FileDedupStore{path: path, file: file, keys: keys}
+	if lines > 2*len(keys) {
+		// Compaction only saves space: on failure, e.g. where an open file
+		// cannot be replaced, the complete uncompacted file stays in use
+		s.compact()
+	}
+	return s, nil
+}
+
+// compact replaces the file with one holding only the claimed keys. The new
+// file is written and locked next to the old one and renamed over it, so a
+// crash leaves one of the two complete.
+func (s *FileDedupStore) compact() error {
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to compact dedup store: %w", err)
+	}
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to compact dedup store: %w", err)
+	}
+	if err := lockFile(tmp); err != nil {
+		return fail(err)
+	}
+
+	keys := make([]string, 0, len(s.keys))
+	for key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	for _, key := range keys {
+		line, _ := json.Marshal(dedupEntry{Key: key})
+		buf.Write(append(line, '\n'))
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fail(err)
+	}
+
+	s.file.Close()
+	s.file = tmp
+	return nil
+}
+
+// Claim records key unless it is already recorded, and syncs it to disk
+func (s *FileDedupStore) Claim(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[key]; ok {
+		return false, nil
+	}
+	if err := s.write(dedupEntry{Key: key}); err != nil {
+		return false, err
+	}
+	s.keys[key] = struct{}{}
+	return true, nil
+}
+
+// Release forgets key, recording the release on disk
+func (s *FileDedupStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[key]; !ok {
+		return nil
+	}
+	if err := s.write(dedupEntry{Key: key, Released: true}); err != nil {
+		return err
+	}
+	delete(s.keys, key)
+	return nil
+}
+
+// write appends an entry to the file and syncs it
+func (s *FileDedupStore) write(entry dedupEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode dedup entry: %w", err)
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write dedup store: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync dedup store: %w", err)
+	}
+	return nil
+}
+
+// Close closes the underlying file
+func (s *FileDedupStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,212 @@
+package sagapay
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryDedupStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryDedupStore(2)
+	claim := func(key string, want bool) {
+		t.Helper()
+		if got, err := s.Claim(ctx, key); err != nil || got != want {
+			t.Fatalf("Claim(%q) = %v, %v, want %v", key, got, err, want)
+		}
+	}
+
+	claim("a", true)
+	claim("a", false)
+	if err := s.Release(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	claim("a", true)
+
+	// Beyond the capacity the least recently used key is forgotten
+	claim("b", true)
+	claim("a", false)
+	claim("c", true)
+	claim("b", true)
+}
+
+func TestFileDedupStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "dedup.jsonl")
+	s, err := NewFileDedupStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "tab\tand\nnewline"} {
+		if ok, err := s.Claim(ctx, key); !ok || err != nil {
+			t.Fatalf("Claim(%q) = %v, %v", key, ok, err)
+		}
+	}
+	if err := s.Release(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// A torn claim is dropped on open and the next append starts a fresh line
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"key":"c`)
+	f.Close()
+
+	s, err = NewFileDedupStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]bool{"a": false, "b": true, "c": true, "tab\tand\nnewline": false} {
+		if got, err := s.Claim(ctx, key); err != nil || got != want {
+			t.Errorf("Claim(%q) after reopening = %v, %v, want %v", key, got, err, want)
+		}
+	}
+	s.Close()
+
+	s, err = NewFileDedupStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if ok, _ := s.Claim(ctx, "c"); ok {
+		t.Error("a key claimed after a torn line was lost")
+	}
+}
+
+func TestFileDedupStoreCompacts(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "dedup.jsonl")
+	s, err := NewFileDedupStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		s.Claim(ctx, "released")
+		s.Release(ctx, "released")
+	}
+	s.Claim(ctx, "kept")
+	s.Close()
+
+	s, err = NewFileDedupStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 1 {
+		t.Errorf("%d lines after compaction, want 1", lines)
+	}
+	if ok, _ := s.Claim(ctx, "kept"); ok {
+		t.Error("compaction lost a claimed key")
+	}
+
+	// The store keeps appending to the compacted file
+	s.Claim(ctx, "new")
+	s.Close()
+	s, err = NewFileDedupStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if ok, _ := s.Claim(ctx, "new"); ok {
+		t.Error("a key claimed after compaction was lost")
+	}
+}
+
+func TestFileDedupStoreCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.jsonl")
+	os.WriteFile(path, []byte("not json\n{\"key\":\"a\"}\n"), 0o600)
+	if _, err := NewFileDedupStore(path); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("NewFileDedupStore = %v, want an error for line 1", err)
+	}
+}
+
+func TestDispatchClaimsAndReleases(t *testing.T) {
+	var calls atomic.Int32
+	fail := atomic.Bool{}
+	fail.Store(true)
+	h := NewWebhookHandler("secret").
+		SetDedupStore(NewMemoryDedupStore(10)).
+		OnDepositCompleted(func(ctx context.Context, payload *WebhookPayload) error {
+			calls.Add(1)
+			if fail.Load() {
+				return Redeliver(errors.New("database down"))
+			}
+			return nil
+		})
+	payload := testPayload(TransactionTypeDeposit, TransactionStatusCompleted)
+
+	// A failed handler releases the claim, so the redelivery is handled
+	if err := h.Dispatch(context.Background(), &payload); !IsRedelivery(err) {
+		t.Fatalf("Dispatch = %v, want a redelivery", err)
+	}
+	fail.Store(false)
+
+	// Concurrent copies of the redelivery reach the handler once
+	var wg sync.WaitGroup
+	var duplicates atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := payload
+			if err := h.Dispatch(context.Background(), &p); errors.Is(err, ErrDuplicateWebhook) {
+				duplicates.Add(1)
+			} else if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls.Load() != 2 || duplicates.Load() != 19 {
+		t.Errorf("%d handler calls and %d duplicates, want 2 and 19", calls.Load(), duplicates.Load())
+	}
+
+	// Another status of the same transaction is a new event
+	payload.Status = TransactionStatusFailed
+	if err := h.Dispatch(context.Background(), &payload); err != nil {
+		t.Errorf("Dispatch of a new status = %v", err)
+	}
+}
+
+func TestWebhookTolerance(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		tolerance time.Duration
+		timestamp time.Time
+		wantErr   bool
+	}{
+		{"disabled", 0, now.Add(-24 * time.Hour), false},
+		{"within", 5 * time.Minute, now.Add(-4 * time.Minute), false},
+		{"slightly ahead", 5 * time.Minute, now.Add(time.Minute), false},
+		{"stale", 5 * time.Minute, now.Add(-6 * time.Minute), true},
+		{"far ahead", 5 * time.Minute, now.Add(time.Hour), true},
+		{"missing", 5 * time.Minute, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewWebhookHandler("secret").SetTolerance(tt.tolerance)
+			h.now = func() time.Time { return now }
+
+			payload := testPayload(TransactionTypeDeposit, TransactionStatusCompleted)
+			payload.Timestamp = tt.timestamp
+			r := webhookRequest(t, "secret", payload)
+			_, err := h.HandleRequest(r)
+			if tt.wantErr != errors.Is(err, ErrStaleWebhook) || !tt.wantErr && err != nil {
+				t.Errorf("HandleRequest = %v, want stale %v", err, tt.wantErr)
+			}
+		})
+	}
+}
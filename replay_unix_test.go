@@ -0,0 +1,27 @@
+//go:build unix
+
+package sagapay
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileDedupStoreLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.jsonl")
+	s, err := NewFileDedupStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileDedupStore(path); !errors.Is(err, ErrStoreLocked) {
+		t.Errorf("second NewFileDedupStore = %v, want ErrStoreLocked", err)
+	}
+	s.Close()
+
+	s, err = NewFileDedupStore(path)
+	if err != nil {
+		t.Fatalf("reopening after Close: %v", err)
+	}
+	s.Close()
+}
@@ -0,0 +1,144 @@
+package sagapay
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+const (
+	// DefaultMaxAttempts is the default number of attempts made for a retryable request
+	DefaultMaxAttempts = 3
+
+	// DefaultInitialBackoff is the default delay before the first retry
+	DefaultInitialBackoff = 500 * time.Millisecond
+
+	// DefaultMaxBackoff is the default upper bound for the delay between retries
+	DefaultMaxBackoff = 10 * time.Second
+)
+
+// RetryPolicy controls how failed API requests are retried.
+//
+// GET requests are always safe to retry. POST requests are only retried
+// when they carry an idempotency key, so a retry can never create a second
+// deposit or withdrawal.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	// A value of 1 or less disables retries.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between retries
+	MaxBackoff time.Duration
+
+	// MaxRetryAfter caps how long a Retry-After header may hold requests
+	// back (default MaxBackoff, or DefaultMaxBackoff if that is zero). A
+	// 429 asking for longer is returned at once as an *APIError matching
+	// ErrRateLimited, without pausing other callers or retrying.
+	MaxRetryAfter time.Duration
+
+	// Multiplier is the factor the delay grows by after each attempt (default 2)
+	Multiplier float64
+
+	// Jitter is the fraction of the delay that is randomized, between 0 and 1
+	Jitter float64
+
+	// ShouldRetry decides whether a response or transport error is retryable.
+	// Defaults to DefaultShouldRetry.
+	ShouldRetry func(resp *http.Response, err error) bool
+}
+
+// DefaultRetryPolicy returns the retry policy used when Config.RetryPolicy is nil
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    DefaultMaxAttempts,
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// NoRetry returns a retry policy that makes exactly one attempt per request
+func NoRetry() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 1}
+}
+
+// DefaultShouldRetry retries network errors, 429 Too Many Requests and 5xx responses.
+// Context cancellation and deadline errors are never retried.
+func DefaultShouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	if resp == nil {
+		return false
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// shouldRetry reports whether the outcome of an attempt is retryable
+func (p RetryPolicy) shouldRetry(resp *http.Response, err error) bool {
+	if p.ShouldRetry != nil {
+		return p.ShouldRetry(resp, err)
+	}
+	return DefaultShouldRetry(resp, err)
+}
+
+// maxRetryAfter returns the longest Retry-After the client honours
+func (p RetryPolicy) maxRetryAfter() time.Duration {
+	switch {
+	case p.MaxRetryAfter > 0:
+		return p.MaxRetryAfter
+	case p.MaxBackoff > 0:
+		return p.MaxBackoff
+	}
+	return DefaultMaxBackoff
+}
+
+// backoff returns the delay to wait after the given attempt (starting at 1)
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	delay := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		delay *= multiplier
+		if p.MaxBackoff > 0 && delay >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		jitter := min(p.Jitter, 1)
+		// Spread the delay uniformly over [delay*(1-jitter), delay*(1+jitter)]
+		delay += delay * jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(delay)
+}
+
+// sleep waits for d or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
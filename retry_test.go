@@ -0,0 +1,116 @@
+package sagapay
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{10, time.Second},
+	}
+	for _, tt := range tests {
+		if got := policy.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+
+	// A multiplier below 1 falls back to doubling
+	policy.Multiplier = 0
+	if got := policy.backoff(2); got != 200*time.Millisecond {
+		t.Errorf("backoff(2) with multiplier 0 = %s, want 200ms", got)
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := policy.backoff(1); got < 50*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("backoff(1) with jitter 0.5 = %s, want between 50ms and 150ms", got)
+		}
+	}
+}
+
+func TestDefaultShouldRetry(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		want   bool
+	}{
+		{"network error", 0, errors.New("connection reset"), true},
+		{"canceled", 0, context.Canceled, false},
+		{"deadline", 0, context.DeadlineExceeded, false},
+		{"429", http.StatusTooManyRequests, nil, true},
+		{"500", http.StatusInternalServerError, nil, true},
+		{"503", http.StatusServiceUnavailable, nil, true},
+		{"400", http.StatusBadRequest, nil, false},
+		{"401", http.StatusUnauthorized, nil, false},
+		{"200", http.StatusOK, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp *http.Response
+			if tt.status != 0 {
+				resp = &http.Response{StatusCode: tt.status}
+			}
+			if got := DefaultShouldRetry(resp, tt.err); got != tt.want {
+				t.Errorf("DefaultShouldRetry = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundTripRetriesOnlySafeRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		method   string
+		params   interface{}
+		attempts int32
+	}{
+		{"GET", EndpointCheckTransactionStatus, http.MethodGet,
+			TransactionStatusParams{Address: "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"}, 3},
+		{"POST with idempotency key", EndpointCreateWithdrawal, http.MethodPost,
+			CreateWithdrawalParams{IdempotencyKey: "key-1"}, 3},
+		{"POST without idempotency key", EndpointCreateWithdrawal, http.MethodPost,
+			CreateWithdrawalParams{}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits.Add(1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer srv.Close()
+
+			c, err := NewClient(Config{
+				BaseURL: srv.URL, APIKey: "key", APISecret: "secret",
+				RetryPolicy: &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = c.sendRequest(context.Background(), tt.endpoint, tt.method, tt.params, nil)
+			if !errors.Is(err, ErrServer) {
+				t.Errorf("err = %v, want ErrServer", err)
+			}
+			if got := hits.Load(); got != tt.attempts {
+				t.Errorf("%d attempts, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package sagapaytest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/halfindex/sagapay-go-sdk"
+)
+
+// MockCall is a call recorded by MockAPI
+type MockCall struct {
+	// Endpoint is the name of the method called, one of the sagapay.Endpoint constants
+	Endpoint string
+
+	// Params are the arguments: a sagapay.CreateDepositParams,
+	// sagapay.CreateWithdrawalParams, sagapay.TransactionStatusParams or
+	// sagapay.WalletBalanceParams
+	Params any
+}
+
+// MockAPI is a sagapay.API that records its calls and returns scripted
+// responses, for unit tests that do not need the HTTP fake in Server:
+//
+//	mock := &sagapaytest.MockAPI{}
+//	mock.ReturnDeposit(&sagapay.DepositResponse{ID: "d1", Address: "0x..."}, nil)
+//	mock.FetchWalletBalanceFunc = func(...) (*sagapay.WalletBalanceResponse, error) { ... }
+//
+//	svc := sagapay.NewInvoiceService(mock)
+//	...
+//	calls := mock.CallsTo(sagapay.EndpointCreateDeposit)
+//
+// Each call takes the next response queued with the Return methods. Once the
+// queue is empty it calls the method's Func field, and without one it fails
+// with an error naming the unscripted call. The zero value is ready to use and
+// it is safe for concurrent use.
+type MockAPI struct {
+	CreateDepositFunc          func(ctx context.Context, params sagapay.CreateDepositParams) (*sagapay.DepositResponse, error)
+	CreateWithdrawalFunc       func(ctx context.Context, params sagapay.CreateWithdrawalParams) (*sagapay.WithdrawalResponse, error)
+	CheckTransactionStatusFunc func(ctx context.Context, address string, transactionType sagapay.TransactionType) (*sagapay.TransactionStatusResponse, error)
+	FetchWalletBalanceFunc     func(ctx context.Context, address string, networkType sagapay.NetworkType, contractAddress string) (*sagapay.WalletBalanceResponse, error)
+
+	mu      sync.Mutex
+	calls   []MockCall
+	scripts map[string][]mockResult
+}
+
+var _ sagapay.API = (*MockAPI)(nil)
+
+// mockResult is a scripted response
+type mockResult struct {
+	resp any
+	err  error
+}
+
+// ReturnDeposit queues the result of a CreateDeposit call
+func (m *MockAPI) ReturnDeposit(resp *sagapay.DepositResponse, err error) *MockAPI {
+	return m.script(sagapay.EndpointCreateDeposit, resp, err)
+}
+
+// ReturnWithdrawal queues the result of a CreateWithdrawal call
+func (m *MockAPI) ReturnWithdrawal(resp *sagapay.WithdrawalResponse, err error) *MockAPI {
+	return m.script(sagapay.EndpointCreateWithdrawal, resp, err)
+}
+
+// ReturnTransactionStatus queues the result of a CheckTransactionStatus call
+func (m *MockAPI) ReturnTransactionStatus(resp *sagapay.TransactionStatusResponse, err error) *MockAPI {
+	return m.script(sagapay.EndpointCheckTransactionStatus, resp, err)
+}
+
+// ReturnWalletBalance queues the result of a FetchWalletBalance call
+func (m *MockAPI) ReturnWalletBalance(resp *sagapay.WalletBalanceResponse, err error) *MockAPI {
+	return m.script(sagapay.EndpointFetchWalletBalance, resp, err)
+}
+
+// Calls returns every call made so far, in order
+func (m *MockAPI) Calls() []MockCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MockCall(nil), m.calls...)
+}
+
+// CallsTo returns the calls made to one endpoint, in order
+func (m *MockAPI) CallsTo(endpoint string) []MockCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var calls []MockCall
+	for _, call := range m.calls {
+		if call.Endpoint == endpoint {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset forgets the recorded calls and any responses still queued
+func (m *MockAPI) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = nil
+	m.scripts = nil
+}
+
+// CreateDeposit records the call and returns the next scripted deposit
+func (m *MockAPI) CreateDeposit(ctx context.Context, params sagapay.CreateDepositParams) (*sagapay.DepositResponse, error) {
+	result, ok := m.record(sagapay.EndpointCreateDeposit, params)
+	if ok {
+		resp, _ := result.resp.(*sagapay.DepositResponse)
+		return resp, result.err
+	}
+	if m.CreateDepositFunc != nil {
+		return m.CreateDepositFunc(ctx, params)
+	}
+	return nil, unscripted(sagapay.EndpointCreateDeposit)
+}
+
+// CreateWithdrawal records the call and returns the next scripted withdrawal
+func (m *MockAPI) CreateWithdrawal(ctx context.Context, params sagapay.CreateWithdrawalParams) (*sagapay.WithdrawalResponse, error) {
+	result, ok := m.record(sagapay.EndpointCreateWithdrawal, params)
+	if ok {
+		resp, _ := result.resp.(*sagapay.WithdrawalResponse)
+		return resp, result.err
+	}
+	if m.CreateWithdrawalFunc != nil {
+		return m.CreateWithdrawalFunc(ctx, params)
+	}
+	return nil, unscripted(sagapay.EndpointCreateWithdrawal)
+}
+
+// CheckTransactionStatus records the call and returns the next scripted transactions
+func (m *MockAPI) CheckTransactionStatus(ctx context.Context, address string, transactionType sagapay.TransactionType) (*sagapay.TransactionStatusResponse, error) {
+	params := sagapay.TransactionStatusParams{Address: address, TransactionType: transactionType}
+	result, ok := m.record(sagapay.EndpointCheckTransactionStatus, params)
+	if ok {
+		resp, _ := result.resp.(*sagapay.TransactionStatusResponse)
+		return resp, result.err
+	}
+	if m.CheckTransactionStatusFunc != nil {
+		return m.CheckTransactionStatusFunc(ctx, address, transactionType)
+	}
+	return nil, unscripted(sagapay.EndpointCheckTransactionStatus)
+}
+
+// FetchWalletBalance records the call and returns the next scripted balance
+func (m *MockAPI) FetchWalletBalance(ctx context.Context, address string, networkType sagapay.NetworkType, contractAddress string) (*sagapay.WalletBalanceResponse, error) {
+	params := sagapay.WalletBalanceParams{Address: address, NetworkType: networkType, ContractAddress: contractAddress}
+	result, ok := m.record(sagapay.EndpointFetchWalletBalance, params)
+	if ok {
+		resp, _ := result.resp.(*sagapay.WalletBalanceResponse)
+		return resp, result.err
+	}
+	if m.FetchWalletBalanceFunc != nil {
+		return m.FetchWalletBalanceFunc(ctx, address, networkType, contractAddress)
+	}
+	return nil, unscripted(sagapay.EndpointFetchWalletBalance)
+}
+
+// script queues a response for an endpoint
+func (m *MockAPI) script(endpoint string, resp any, err error) *MockAPI {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.scripts == nil {
+		m.scripts = make(map[string][]mockResult)
+	}
+	m.scripts[endpoint] = append(m.scripts[endpoint], mockResult{resp: resp, err: err})
+	return m
+}
+
+// record records a call and pops the next scripted response for it, if any
+func (m *MockAPI) record(endpoint string, params any) (mockResult, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, MockCall{Endpoint: endpoint, Params: params})
+	queue := m.scripts[endpoint]
+	if len(queue) == 0 {
+		return mockResult{}, false
+	}
+	m.scripts[endpoint] = queue[1:]
+	return queue[0], true
+}
+
+// unscripted is the error of a call with no scripted response
+func unscripted(endpoint string) error {
+	return fmt.Errorf("sagapaytest: MockAPI: no response scripted for %s", endpoint)
+}
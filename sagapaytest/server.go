@@ -0,0 +1,738 @@
+// Package sagapaytest provides an in-memory fake SagaPay server for tests,
+// and MockAPI for unit tests that do not need HTTP.
+//
+// The fake speaks the same HTTP API as SagaPay, so a real *sagapay.Client can
+// be pointed at it through Config.BaseURL:
+//
+//	srv := sagapaytest.NewServer(sagapaytest.Config{})
+//	defer srv.Close()
+//
+//	client, _ := sagapay.NewClient(srv.ClientConfig())
+//	deposit, _ := client.CreateDeposit(ctx, params)
+//
+//	tx, _ := srv.Pay(deposit.Address, "1.5") // PENDING, webhook sent
+//	srv.Complete(tx.ID)                      // PROCESSING, COMPLETED, webhooks sent
+package sagapaytest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/halfindex/sagapay-go-sdk"
+)
+
+const (
+	// DefaultAPIKey is the API key accepted when Config.APIKey is empty
+	DefaultAPIKey = "test-api-key"
+
+	// DefaultAPISecret is the API secret accepted when Config.APISecret is empty
+	DefaultAPISecret = "test-api-secret"
+
+	// DefaultDepositTTL is how long temporary deposit addresses stay valid
+	DefaultDepositTTL = time.Hour
+)
+
+// Config contains the configuration options for the fake server
+type Config struct {
+	// APIKey is the API key the server accepts
+	APIKey string
+
+	// APISecret is the API secret the server accepts and signs webhooks with
+	APISecret string
+
+	// DepositTTL is how long temporary deposit addresses stay valid
+	DepositTTL time.Duration
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	// WebhookClient is the HTTP client used to deliver webhooks
+	WebhookClient *http.Client
+}
+
+// Delivery records a single webhook delivery attempt
+type Delivery struct {
+	URL        string
+	Payload    sagapay.WebhookPayload
+	Body       []byte
+	Signature  string
+	StatusCode int
+	Err        error
+}
+
+// transaction is a transaction tracked by the server
+type transaction struct {
+	tx     sagapay.Transaction
+	ipnURL string
+	udf    string
+}
+
+// failure is a scripted error response
+type failure struct {
+	statusCode int
+	body       []byte
+}
+
+// Server is an in-memory fake SagaPay API server
+type Server struct {
+	*httptest.Server
+
+	apiKey        string
+	apiSecret     string
+	depositTTL    time.Duration
+	now           func() time.Time
+	webhookClient *http.Client
+
+	mu           sync.Mutex
+	deposits     map[string]*sagapay.DepositResponse // by address
+	depositUDF   map[string]string                   // by address
+	depositIPN   map[string]string                   // by address
+	depositToken map[string]sagapay.Token            // by address
+	transactions map[string]*transaction             // by ID
+	order        []string                            // transaction IDs in creation order
+	tokens       map[tokenKey]sagapay.Token
+	balances     map[balanceKey]string
+	failures     map[string][]failure
+	deliveries   []Delivery
+
+	// idempotencyMu is held from looking up an idempotency key until its
+	// response is stored, so concurrent requests with one key create once
+	idempotencyMu sync.Mutex
+	idempotent    map[string][]byte // response bodies by endpoint and idempotency key
+}
+
+type tokenKey struct {
+	network  sagapay.NetworkType
+	contract string
+}
+
+type balanceKey struct {
+	address  string
+	network  sagapay.NetworkType
+	contract string
+}
+
+// NewServer starts a new fake SagaPay server. The caller must call Close when done.
+func NewServer(config Config) *Server {
+	s := &Server{
+		apiKey:        config.APIKey,
+		apiSecret:     config.APISecret,
+		depositTTL:    config.DepositTTL,
+		now:           config.Now,
+		webhookClient: config.WebhookClient,
+		deposits:      make(map[string]*sagapay.DepositResponse),
+		depositUDF:    make(map[string]string),
+		depositIPN:    make(map[string]string),
+		depositToken:  make(map[string]sagapay.Token),
+		transactions:  make(map[string]*transaction),
+		tokens:        make(map[tokenKey]sagapay.Token),
+		balances:      make(map[balanceKey]string),
+		idempotent:    make(map[string][]byte),
+		failures:      make(map[string][]failure),
+	}
+	if s.apiKey == "" {
+		s.apiKey = DefaultAPIKey
+	}
+	if s.apiSecret == "" {
+		s.apiSecret = DefaultAPISecret
+	}
+	if s.depositTTL <= 0 {
+		s.depositTTL = DefaultDepositTTL
+	}
+	if s.now == nil {
+		s.now = time.Now
+	}
+	if s.webhookClient == nil {
+		s.webhookClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	for _, token := range defaultTokens {
+		s.RegisterToken(token)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /create-deposit", s.authenticated("/create-deposit", s.handleCreateDeposit))
+	mux.HandleFunc("POST /create-withdrawal", s.authenticated("/create-withdrawal", s.handleCreateWithdrawal))
+	mux.HandleFunc("GET /check-transaction-status", s.authenticated("/check-transaction-status", s.handleCheckTransactionStatus))
+	mux.HandleFunc("GET /fetch-wallet-balance", s.authenticated("/fetch-wallet-balance", s.handleFetchWalletBalance))
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// ClientConfig returns a client configuration pointing at the fake server
+func (s *Server) ClientConfig() sagapay.Config {
+	return sagapay.Config{
+		BaseURL:   s.URL,
+		APIKey:    s.apiKey,
+		APISecret: s.apiSecret,
+	}
+}
+
+// APISecret returns the secret the server signs webhooks with
+func (s *Server) APISecret() string {
+	return s.apiSecret
+}
+
+// RegisterToken makes a token known to the server so transactions and
+// balances report its symbol and decimals
+func (s *Server) RegisterToken(token sagapay.Token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[tokenKey{token.NetworkType, token.ContractAddress}] = token
+}
+
+// SetBalance sets the raw balance, in base units, reported for an address
+func (s *Server) SetBalance(address string, network sagapay.NetworkType, contractAddress, raw string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.balances[balanceKey{address, network, contractAddress}] = raw
+}
+
+// FailNext makes the next request to endpoint (e.g. "/create-deposit") fail
+// with the given status code. Calls queue up.
+func (s *Server) FailNext(endpoint string, statusCode int) {
+	body, _ := json.Marshal(map[string]string{
+		"error":   "INJECTED_FAILURE",
+		"message": http.StatusText(statusCode),
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[endpoint] = append(s.failures[endpoint], failure{statusCode, body})
+}
+
+// Deposit returns the deposit issued for an address
+func (s *Server) Deposit(address string) (*sagapay.DepositResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.deposits[address]
+	if !ok {
+		return nil, false
+	}
+	deposit := *d
+	return &deposit, true
+}
+
+// Transaction returns a transaction by ID
+func (s *Server) Transaction(id string) (*sagapay.Transaction, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.transactions[id]
+	if !ok {
+		return nil, false
+	}
+	tx := t.tx
+	return &tx, true
+}
+
+// Transactions returns all transactions in creation order
+func (s *Server) Transactions() []sagapay.Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	txs := make([]sagapay.Transaction, 0, len(s.order))
+	for _, id := range s.order {
+		txs = append(txs, s.transactions[id].tx)
+	}
+	return txs
+}
+
+// Deliveries returns every webhook delivery attempted so far
+func (s *Server) Deliveries() []Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Delivery(nil), s.deliveries...)
+}
+
+// Pay simulates an incoming payment of amount to a deposit address issued by
+// the server. The transaction starts as PENDING and a webhook is sent.
+func (s *Server) Pay(address, amount string) (*sagapay.Transaction, error) {
+	if _, err := sagapay.ParseAmount(amount); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	deposit, ok := s.deposits[address]
+	if !ok {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("sagapaytest: no deposit address %q", address)
+	}
+	token := s.depositToken[address]
+	now := s.now()
+	t := &transaction{
+		tx: sagapay.Transaction{
+			ID:              uuid.NewString(),
+			TransactionType: sagapay.TransactionTypeDeposit,
+			Status:          sagapay.TransactionStatusPending,
+			Amount:          amount,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+			TxHash:          txHash(token.NetworkType),
+			NetworkType:     token.NetworkType,
+			ContractAddress: token.ContractAddress,
+			Address:         deposit.Address,
+			Token:           token,
+		},
+		ipnURL: s.depositIPN[address],
+		udf:    s.depositUDF[address],
+	}
+	s.addTransaction(t)
+	tx := t.tx
+	s.mu.Unlock()
+
+	s.notify(t, tx)
+	return &tx, nil
+}
+
+// Advance moves a transaction one step along PENDING → PROCESSING → COMPLETED
+// and sends a webhook
+func (s *Server) Advance(id string) (*sagapay.Transaction, error) {
+	s.mu.Lock()
+	t, ok := s.transactions[id]
+	if !ok {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("sagapaytest: no transaction %q", id)
+	}
+	status := t.tx.Status
+	s.mu.Unlock()
+
+	switch status {
+	case sagapay.TransactionStatusPending:
+		return s.SetStatus(id, sagapay.TransactionStatusProcessing)
+	case sagapay.TransactionStatusProcessing:
+		return s.SetStatus(id, sagapay.TransactionStatusCompleted)
+	default:
+		return nil, fmt.Errorf("sagapaytest: transaction %q is already %s", id, status)
+	}
+}
+
+// Complete advances a transaction until it is COMPLETED, sending a webhook for every step
+func (s *Server) Complete(id string) (*sagapay.Transaction, error) {
+	for {
+		tx, ok := s.Transaction(id)
+		if !ok {
+			return nil, fmt.Errorf("sagapaytest: no transaction %q", id)
+		}
+		if tx.Status == sagapay.TransactionStatusCompleted {
+			return tx, nil
+		}
+		if _, err := s.Advance(id); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// SetStatus sets the status of a transaction and sends a webhook. Any status
+// may be set, e.g. FAILED or CANCELLED.
+func (s *Server) SetStatus(id string, status sagapay.TransactionStatus) (*sagapay.Transaction, error) {
+	s.mu.Lock()
+	t, ok := s.transactions[id]
+	if !ok {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("sagapaytest: no transaction %q", id)
+	}
+	t.tx.Status = status
+	t.tx.UpdatedAt = s.now()
+	if t.tx.TxHash == "" && status != sagapay.TransactionStatusPending {
+		t.tx.TxHash = txHash(t.tx.NetworkType)
+	}
+	if deposit, ok := s.deposits[t.tx.Address]; ok && t.tx.TransactionType == sagapay.TransactionTypeDeposit {
+		deposit.Status = status
+	}
+	tx := t.tx
+	s.mu.Unlock()
+
+	s.notify(t, tx)
+	return &tx, nil
+}
+
+// SendWebhook delivers a signed webhook for a transaction's current state
+func (s *Server) SendWebhook(id string) (Delivery, error) {
+	s.mu.Lock()
+	t, ok := s.transactions[id]
+	if !ok {
+		s.mu.Unlock()
+		return Delivery{}, fmt.Errorf("sagapaytest: no transaction %q", id)
+	}
+	tx := t.tx
+	s.mu.Unlock()
+
+	return s.deliver(t, tx), nil
+}
+
+// Sign returns the webhook signature for body, using the same HMAC-SHA256
+// scheme verified by sagapay.WebhookHandler
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// notify sends a webhook for a transaction if it has an IPN URL
+func (s *Server) notify(t *transaction, tx sagapay.Transaction) {
+	if t.ipnURL != "" {
+		s.deliver(t, tx)
+	}
+}
+
+// deliver posts a signed webhook to the transaction's IPN URL and records the outcome
+func (s *Server) deliver(t *transaction, tx sagapay.Transaction) Delivery {
+	payload := sagapay.WebhookPayload{
+		ID:          tx.ID,
+		Type:        tx.TransactionType,
+		Status:      tx.Status,
+		Address:     tx.Address,
+		NetworkType: tx.NetworkType,
+		Amount:      tx.Amount,
+		UDF:         t.udf,
+		TxHash:      tx.TxHash,
+		Timestamp:   s.now().UTC(),
+	}
+	body, _ := json.Marshal(payload)
+	delivery := Delivery{
+		URL:       t.ipnURL,
+		Payload:   payload,
+		Body:      body,
+		Signature: Sign(s.apiSecret, body),
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.ipnURL, bytes.NewReader(body))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("x-sagapay-signature", delivery.Signature)
+		var resp *http.Response
+		resp, err = s.webhookClient.Do(req)
+		if err == nil {
+			delivery.StatusCode = resp.StatusCode
+			resp.Body.Close()
+		}
+	}
+	delivery.Err = err
+
+	s.mu.Lock()
+	s.deliveries = append(s.deliveries, delivery)
+	s.mu.Unlock()
+
+	return delivery
+}
+
+// addTransaction stores a new transaction; the caller must hold s.mu
+func (s *Server) addTransaction(t *transaction) {
+	s.transactions[t.tx.ID] = t
+	s.order = append(s.order, t.tx.ID)
+}
+
+// token returns the registered token for a network and contract; the caller must hold s.mu
+func (s *Server) token(network sagapay.NetworkType, contract string) sagapay.Token {
+	if token, ok := s.tokens[tokenKey{network, contract}]; ok {
+		return token
+	}
+	return sagapay.Token{
+		NetworkType:     network,
+		ContractAddress: contract,
+		Symbol:          "TOKEN",
+		Name:            "Test Token",
+		Decimals:        18,
+	}
+}
+
+// authenticated wraps a handler with credential checks and scripted failures
+func (s *Server) authenticated(endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !hmac.Equal([]byte(r.Header.Get("x-api-key")), []byte(s.apiKey)) ||
+			!hmac.Equal([]byte(r.Header.Get("x-api-secret")), []byte(s.apiSecret)) {
+			writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid API credentials")
+			return
+		}
+
+		s.mu.Lock()
+		queued := s.failures[endpoint]
+		var injected *failure
+		if len(queued) > 0 {
+			injected = &queued[0]
+			s.failures[endpoint] = queued[1:]
+		}
+		s.mu.Unlock()
+
+		if injected != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(injected.statusCode)
+			w.Write(injected.body)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (s *Server) handleCreateDeposit(w http.ResponseWriter, r *http.Request) {
+	var params sagapay.CreateDepositParams
+	if !decodeParams(w, r, &params) {
+		return
+	}
+
+	s.replayOrRecord(w, r, "/create-deposit", func() (int, any) {
+		if err := params.Validate(); err != nil {
+			return http.StatusBadRequest, errorBody("VALIDATION_ERROR", err.Error())
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		now := s.now()
+		expiresAt := now.Add(s.depositTTL)
+		if params.Type == sagapay.AddressTypePermanent {
+			expiresAt = now.AddDate(100, 0, 0)
+		}
+		deposit := &sagapay.DepositResponse{
+			ID:        uuid.NewString(),
+			Address:   newAddress(params.NetworkType),
+			ExpiresAt: expiresAt.UTC(),
+			Amount:    params.Amount,
+			Status:    sagapay.TransactionStatusPending,
+		}
+		s.deposits[deposit.Address] = deposit
+		s.depositUDF[deposit.Address] = params.UDF
+		s.depositIPN[deposit.Address] = params.IPNUrl
+		s.depositToken[deposit.Address] = s.token(params.NetworkType, params.ContractAddress)
+
+		return http.StatusOK, deposit
+	})
+}
+
+func (s *Server) handleCreateWithdrawal(w http.ResponseWriter, r *http.Request) {
+	var params sagapay.CreateWithdrawalParams
+	if !decodeParams(w, r, &params) {
+		return
+	}
+
+	var created *transaction
+	s.replayOrRecord(w, r, "/create-withdrawal", func() (int, any) {
+		if err := params.Validate(); err != nil {
+			return http.StatusBadRequest, errorBody("VALIDATION_ERROR", err.Error())
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		now := s.now()
+		token := s.token(params.NetworkType, params.ContractAddress)
+		created = &transaction{
+			tx: sagapay.Transaction{
+				ID:              uuid.NewString(),
+				TransactionType: sagapay.TransactionTypeWithdrawal,
+				Status:          sagapay.TransactionStatusPending,
+				Amount:          params.Amount,
+				CreatedAt:       now,
+				UpdatedAt:       now,
+				NetworkType:     params.NetworkType,
+				ContractAddress: params.ContractAddress,
+				Address:         params.Address,
+				Token:           token,
+			},
+			ipnURL: params.IPNUrl,
+			udf:    params.UDF,
+		}
+		s.addTransaction(created)
+
+		return http.StatusOK, sagapay.WithdrawalResponse{
+			ID:     created.tx.ID,
+			Status: created.tx.Status,
+			Fee:    "0",
+		}
+	})
+
+	if created != nil {
+		s.notify(created, created.tx)
+	}
+}
+
+func (s *Server) handleCheckTransactionStatus(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	txType := sagapay.TransactionType(r.URL.Query().Get("type"))
+	if address == "" {
+		writeError(w, http.StatusBadRequest, "VALIDATION_ERROR", "address is required")
+		return
+	}
+
+	s.mu.Lock()
+	response := sagapay.TransactionStatusResponse{
+		Address:         address,
+		TransactionType: txType,
+		Transactions:    []sagapay.Transaction{},
+	}
+	for _, id := range s.order {
+		tx := s.transactions[id].tx
+		if tx.Address == address && (txType == "" || tx.TransactionType == txType) {
+			response.Transactions = append(response.Transactions, tx)
+		}
+	}
+	response.Count = len(response.Transactions)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleFetchWalletBalance(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	address := query.Get("address")
+	network := sagapay.NetworkType(query.Get("networkType"))
+	contract := query.Get("contractAddress")
+	if contract == "" {
+		contract = sagapay.NativeContractAddress
+	}
+	if address == "" {
+		writeError(w, http.StatusBadRequest, "VALIDATION_ERROR", "address is required")
+		return
+	}
+
+	s.mu.Lock()
+	token := s.token(network, contract)
+	raw, ok := s.balances[balanceKey{address, network, contract}]
+	s.mu.Unlock()
+	if !ok {
+		raw = "0"
+	}
+
+	formatted := raw
+	if amount, err := token.ParseBaseUnits(raw); err == nil {
+		formatted = amount.String()
+	}
+
+	writeJSON(w, http.StatusOK, sagapay.WalletBalanceResponse{
+		Address:         address,
+		NetworkType:     network,
+		ContractAddress: contract,
+		Token:           token,
+		Balance: sagapay.Balance{
+			Raw:       raw,
+			Formatted: formatted,
+		},
+	})
+}
+
+// replayOrRecord returns the stored response for a repeated idempotency key,
+// or runs create and stores its response under the key. Requests carrying
+// an idempotency key are serialized, so a concurrent retry waits for the
+// first request and replays its response.
+func (s *Server) replayOrRecord(w http.ResponseWriter, r *http.Request, endpoint string, create func() (int, any)) {
+	key := r.Header.Get(sagapay.IdempotencyKeyHeader)
+	if key != "" {
+		s.idempotencyMu.Lock()
+		defer s.idempotencyMu.Unlock()
+		if stored, ok := s.idempotent[endpoint+" "+key]; ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write(stored)
+			return
+		}
+	}
+
+	status, v := create()
+	body, _ := json.Marshal(v)
+	if key != "" && status == http.StatusOK {
+		s.idempotent[endpoint+" "+key] = body
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// decodeParams decodes a JSON request body, writing a 400 response on failure
+func decodeParams(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", err.Error())
+		return false
+	}
+	return true
+}
+
+func errorBody(code, message string) map[string]string {
+	return map[string]string{"error": code, "message": message}
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, errorBody(code, message))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// newAddress generates a random, well-formed address for a network
+func newAddress(network sagapay.NetworkType) string {
+	switch network {
+	case sagapay.NetworkTypeTRC20:
+		payload := append([]byte{0x41}, randomBytes(20)...)
+		first := sha256.Sum256(payload)
+		second := sha256.Sum256(first[:])
+		return base58Encode(append(payload, second[:4]...))
+	case sagapay.NetworkTypeSOLANA:
+		return base58Encode(randomBytes(32))
+	default:
+		addr, _ := sagapay.ChecksumAddress("0x" + hex.EncodeToString(randomBytes(20)))
+		return addr
+	}
+}
+
+// txHash generates a random transaction hash in the network's format
+func txHash(network sagapay.NetworkType) string {
+	switch network {
+	case sagapay.NetworkTypeTRC20:
+		return hex.EncodeToString(randomBytes(32))
+	case sagapay.NetworkTypeSOLANA:
+		return base58Encode(randomBytes(64))
+	default:
+		return "0x" + hex.EncodeToString(randomBytes(32))
+	}
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(errors.New("sagapaytest: crypto/rand failed: " + err.Error()))
+	}
+	return b
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58Encode encodes bytes using the Bitcoin base58 alphabet
+func base58Encode(b []byte) string {
+	n := new(big.Int).SetBytes(b)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	// Each leading zero byte is encoded as '1'
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		out = append(out, '1')
+	}
+
+	// Digits were produced least significant first
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
@@ -0,0 +1,52 @@
+package sagapaytest
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/halfindex/sagapay-go-sdk"
+)
+
+func TestServerIdempotencyConcurrent(t *testing.T) {
+	srv := NewServer(Config{})
+	defer srv.Close()
+	client, err := sagapay.NewClient(srv.ClientConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := sagapay.CreateWithdrawalParams{
+		NetworkType:     sagapay.NetworkTypeERC20,
+		ContractAddress: sagapay.NativeContractAddress,
+		Address:         "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		Amount:          "1",
+		IPNUrl:          "https://example.com/ipn",
+		IdempotencyKey:  "withdrawal-1",
+	}
+
+	var wg sync.WaitGroup
+	ids := make([]string, 20)
+	for i := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := client.CreateWithdrawal(context.Background(), params)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ids[i] = response.ID
+		}()
+	}
+	wg.Wait()
+
+	if n := len(srv.Transactions()); n != 1 {
+		t.Fatalf("%d withdrawals created, want 1", n)
+	}
+	for _, id := range ids {
+		if id != ids[0] {
+			t.Errorf("withdrawal ID %s, want %s for every request", id, ids[0])
+		}
+	}
+}
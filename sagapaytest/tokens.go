@@ -0,0 +1,17 @@
+package sagapaytest
+
+import "github.com/halfindex/sagapay-go-sdk"
+
+// defaultTokens are registered with every new server
+var defaultTokens = []sagapay.Token{
+	{NetworkType: sagapay.NetworkTypeERC20, ContractAddress: "0", Symbol: "ETH", Name: "Ethereum", Decimals: 18},
+	{NetworkType: sagapay.NetworkTypeBEP20, ContractAddress: "0", Symbol: "BNB", Name: "BNB", Decimals: 18},
+	{NetworkType: sagapay.NetworkTypeTRC20, ContractAddress: "0", Symbol: "TRX", Name: "TRON", Decimals: 6},
+	{NetworkType: sagapay.NetworkTypePOLYGON, ContractAddress: "0", Symbol: "POL", Name: "Polygon", Decimals: 18},
+	{NetworkType: sagapay.NetworkTypeSOLANA, ContractAddress: "0", Symbol: "SOL", Name: "Solana", Decimals: 9},
+	{NetworkType: sagapay.NetworkTypeERC20, ContractAddress: "0xdAC17F958D2ee523a2206206994597C13D831ec7", Symbol: "USDT", Name: "Tether USD", Decimals: 6},
+	{NetworkType: sagapay.NetworkTypeBEP20, ContractAddress: "0x55d398326f99059fF775485246999027B3197955", Symbol: "USDT", Name: "Tether USD", Decimals: 18},
+	{NetworkType: sagapay.NetworkTypeTRC20, ContractAddress: "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", Symbol: "USDT", Name: "Tether USD", Decimals: 6},
+	{NetworkType: sagapay.NetworkTypePOLYGON, ContractAddress: "0xc2132D05D31c914a87C6611C10748AEb04B58e8F", Symbol: "USDT", Name: "Tether USD", Decimals: 6},
+	{NetworkType: sagapay.NetworkTypeSOLANA, ContractAddress: "Es9vMFrzaCERmJfrF4H2FYD4KCoNkY11McCe8BenwNYB", Symbol: "USDT", Name: "Tether USD", Decimals: 6},
+}
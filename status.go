@@ -0,0 +1,160 @@
+package sagapay
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Status errors that can be matched with errors.Is
+var (
+	// ErrUnknownStatus is returned for a transaction status the SDK does not know
+	ErrUnknownStatus = errors.New("sagapay: unknown transaction status")
+
+	// ErrInvalidTransition is matched by every *TransitionError
+	ErrInvalidTransition = errors.New("sagapay: invalid status transition")
+)
+
+// transitions lists the statuses each non-terminal status may move to
+var transitions = map[TransactionStatus][]TransactionStatus{
+	TransactionStatusPending: {
+		TransactionStatusProcessing,
+		TransactionStatusCompleted,
+		TransactionStatusFailed,
+		TransactionStatusCancelled,
+	},
+	TransactionStatusProcessing: {
+		TransactionStatusCompleted,
+		TransactionStatusFailed,
+		TransactionStatusCancelled,
+	},
+}
+
+// ParseTransactionStatus parses a status string, rejecting statuses the SDK does not know
+func ParseTransactionStatus(s string) (TransactionStatus, error) {
+	status := TransactionStatus(s)
+	if !status.IsKnown() {
+		return "", fmt.Errorf("%w: %q", ErrUnknownStatus, s)
+	}
+	return status, nil
+}
+
+// IsKnown reports whether the status is one of the documented statuses
+func (s TransactionStatus) IsKnown() bool {
+	switch s {
+	case TransactionStatusPending, TransactionStatusProcessing,
+		TransactionStatusCompleted, TransactionStatusFailed, TransactionStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// IsTerminal reports whether the status is final: COMPLETED, FAILED or CANCELLED
+func (s TransactionStatus) IsTerminal() bool {
+	return s == TransactionStatusCompleted || s == TransactionStatusFailed || s == TransactionStatusCancelled
+}
+
+// IsSuccess reports whether the transaction completed successfully
+func (s TransactionStatus) IsSuccess() bool {
+	return s == TransactionStatusCompleted
+}
+
+// CanTransitionTo reports whether a transaction may move from s to next.
+// Transactions move forward through PENDING → PROCESSING → COMPLETED and may
+// fail or be cancelled before completing; terminal statuses never change.
+func (s TransactionStatus) CanTransitionTo(next TransactionStatus) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionError is returned when an update would move a transaction backwards
+// or out of a terminal status
+type TransitionError struct {
+	ID   string
+	From TransactionStatus
+	To   TransactionStatus
+}
+
+// Error implements the error interface
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("sagapay: transaction %s cannot move from %s to %s", e.ID, e.From, e.To)
+}
+
+// Is reports whether target is ErrInvalidTransition
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrInvalidTransition
+}
+
+// TrackedStatus is the last accepted status of a transaction
+type TrackedStatus struct {
+	Status    TransactionStatus
+	UpdatedAt time.Time
+}
+
+// Tracker applies status updates from webhooks and polling in order and
+// rejects updates that arrive out of order, such as a late PENDING webhook
+// for a transaction that is already COMPLETED. It is safe for concurrent use.
+type Tracker struct {
+	mu     sync.Mutex
+	states map[string]TrackedStatus
+}
+
+// NewTracker creates an empty tracker
+func NewTracker() *Tracker {
+	return &Tracker{states: make(map[string]TrackedStatus)}
+}
+
+// Apply records a status update for a transaction. It reports whether the
+// status changed; repeating the current status is a no-op. Unknown statuses
+// fail with ErrUnknownStatus and regressions with a *TransitionError.
+func (t *Tracker) Apply(id string, status TransactionStatus, at time.Time) (bool, error) {
+	if !status.IsKnown() {
+		return false, fmt.Errorf("%w: %q for transaction %s", ErrUnknownStatus, status, id)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current, ok := t.states[id]
+	switch {
+	case !ok:
+		// First update seen for this transaction
+	case current.Status == status:
+		return false, nil
+	case !current.Status.CanTransitionTo(status):
+		return false, &TransitionError{ID: id, From: current.Status, To: status}
+	}
+
+	t.states[id] = TrackedStatus{Status: status, UpdatedAt: at}
+	return true, nil
+}
+
+// ApplyWebhook records the status reported by a webhook
+func (t *Tracker) ApplyWebhook(payload *WebhookPayload) (bool, error) {
+	return t.Apply(payload.ID, payload.Status, payload.Timestamp)
+}
+
+// ApplyTransaction records the status of a polled transaction
+func (t *Tracker) ApplyTransaction(tx Transaction) (bool, error) {
+	return t.Apply(tx.ID, tx.Status, tx.UpdatedAt)
+}
+
+// Status returns the last accepted status of a transaction
+func (t *Tracker) Status(id string) (TrackedStatus, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, ok := t.states[id]
+	return state, ok
+}
+
+// Forget stops tracking a transaction
+func (t *Tracker) Forget(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.states, id)
+}
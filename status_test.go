@@ -0,0 +1,109 @@
+package sagapay
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseTransactionStatus(t *testing.T) {
+	for _, s := range []string{"PENDING", "PROCESSING", "COMPLETED", "FAILED", "CANCELLED"} {
+		if status, err := ParseTransactionStatus(s); err != nil || string(status) != s {
+			t.Errorf("ParseTransactionStatus(%q) = %q, %v", s, status, err)
+		}
+	}
+	for _, s := range []string{"", "completed", "REFUNDED"} {
+		if _, err := ParseTransactionStatus(s); !errors.Is(err, ErrUnknownStatus) {
+			t.Errorf("ParseTransactionStatus(%q) error = %v, want ErrUnknownStatus", s, err)
+		}
+	}
+}
+
+func TestCanTransitionTo(t *testing.T) {
+	statuses := []TransactionStatus{
+		TransactionStatusPending,
+		TransactionStatusProcessing,
+		TransactionStatusCompleted,
+		TransactionStatusFailed,
+		TransactionStatusCancelled,
+	}
+	allowed := map[[2]TransactionStatus]bool{
+		{TransactionStatusPending, TransactionStatusProcessing}:   true,
+		{TransactionStatusPending, TransactionStatusCompleted}:    true,
+		{TransactionStatusPending, TransactionStatusFailed}:       true,
+		{TransactionStatusPending, TransactionStatusCancelled}:    true,
+		{TransactionStatusProcessing, TransactionStatusCompleted}: true,
+		{TransactionStatusProcessing, TransactionStatusFailed}:    true,
+		{TransactionStatusProcessing, TransactionStatusCancelled}: true,
+	}
+	for _, from := range statuses {
+		for _, to := range statuses {
+			if got, want := from.CanTransitionTo(to), allowed[[2]TransactionStatus{from, to}]; got != want {
+				t.Errorf("%s.CanTransitionTo(%s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestTracker(t *testing.T) {
+	at := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewTracker()
+
+	steps := []struct {
+		status      TransactionStatus
+		wantChanged bool
+		wantErr     error
+	}{
+		{TransactionStatusProcessing, true, nil},
+		{TransactionStatusProcessing, false, nil},
+		{TransactionStatusPending, false, ErrInvalidTransition},
+		{TransactionStatusCompleted, true, nil},
+		{TransactionStatusFailed, false, ErrInvalidTransition},
+		{"REFUNDED", false, ErrUnknownStatus},
+		{TransactionStatusCompleted, false, nil},
+	}
+	for i, step := range steps {
+		changed, err := tracker.Apply("tx-1", step.status, at.Add(time.Duration(i)*time.Minute))
+		if changed != step.wantChanged || !errors.Is(err, step.wantErr) || (step.wantErr == nil && err != nil) {
+			t.Errorf("step %d: Apply(%s) = %v, %v, want %v, %v", i, step.status, changed, err, step.wantChanged, step.wantErr)
+		}
+	}
+
+	// Only accepted updates are recorded
+	state, ok := tracker.Status("tx-1")
+	if !ok || state.Status != TransactionStatusCompleted || !state.UpdatedAt.Equal(at.Add(3*time.Minute)) {
+		t.Errorf("Status = %+v, %v", state, ok)
+	}
+
+	var terr *TransitionError
+	_, err := tracker.Apply("tx-1", TransactionStatusPending, at)
+	if !errors.As(err, &terr) || terr.ID != "tx-1" || terr.From != TransactionStatusCompleted || terr.To != TransactionStatusPending {
+		t.Errorf("Apply error = %#v, want a TransitionError from COMPLETED to PENDING", err)
+	}
+
+	tracker.Forget("tx-1")
+	if _, ok := tracker.Status("tx-1"); ok {
+		t.Error("Status after Forget still reports the transaction")
+	}
+	// A forgotten transaction starts over at any status
+	if changed, err := tracker.Apply("tx-1", TransactionStatusPending, at); !changed || err != nil {
+		t.Errorf("Apply after Forget = %v, %v", changed, err)
+	}
+}
+
+func TestTrackerSources(t *testing.T) {
+	tracker := NewTracker()
+	at := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	// A polled COMPLETED is not undone by a late PENDING webhook
+	if _, err := tracker.ApplyTransaction(Transaction{ID: "tx-1", Status: TransactionStatusCompleted, UpdatedAt: at}); err != nil {
+		t.Fatal(err)
+	}
+	late := &WebhookPayload{ID: "tx-1", Status: TransactionStatusPending, Timestamp: at.Add(-time.Minute)}
+	if changed, err := tracker.ApplyWebhook(late); changed || !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("ApplyWebhook of a late PENDING = %v, %v", changed, err)
+	}
+	if state, _ := tracker.Status("tx-1"); state.Status != TransactionStatusCompleted || !state.UpdatedAt.Equal(at) {
+		t.Errorf("Status = %+v, want COMPLETED at %v", state, at)
+	}
+}
@@ -0,0 +1,325 @@
+package sagapay
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWatchMinInterval is the default shortest delay between polls of an address
+	DefaultWatchMinInterval = 5 * time.Second
+
+	// DefaultWatchMaxInterval is the default longest delay between polls of an address
+	DefaultWatchMaxInterval = 2 * time.Minute
+
+	// DefaultWatchRequestsPerSecond is the default global polling budget
+	DefaultWatchRequestsPerSecond = 2
+)
+
+// WatchEventKind identifies the kind of watch event
+type WatchEventKind string
+
+// Watch event kinds
+const (
+	// WatchEventStatusChanged is sent when a transaction appears or its status changes
+	WatchEventStatusChanged WatchEventKind = "status_changed"
+
+	// WatchEventExpired is sent when an address stops being watched because it expired
+	WatchEventExpired WatchEventKind = "expired"
+
+	// WatchEventError is sent when polling an address fails
+	WatchEventError WatchEventKind = "error"
+)
+
+// WatchEvent is emitted by a Watcher
+type WatchEvent struct {
+	Kind WatchEventKind
+
+	// Address is the watched address
+	Address string
+
+	// DepositID is the ID of the deposit the address was issued for, if known
+	DepositID string
+
+	// Transaction is the transaction whose status changed
+	Transaction Transaction
+
+	// PreviousStatus is the last status seen for the transaction, or empty for a new transaction
+	PreviousStatus TransactionStatus
+
+	// Err is the polling error for WatchEventError
+	Err error
+}
+
+// WatcherConfig contains the configuration options for a Watcher
+type WatcherConfig struct {
+	// TransactionType is the type of transactions to poll for (default deposit)
+	TransactionType TransactionType
+
+	// MinInterval is the delay between polls after a change is seen
+	MinInterval time.Duration
+
+	// MaxInterval caps the delay between polls of an idle address. The delay
+	// grows from MinInterval towards MaxInterval while nothing changes.
+	MaxInterval time.Duration
+
+	// RequestsPerSecond is the global polling budget shared by all addresses
+	RequestsPerSecond float64
+
+	// ExpiryGrace keeps polling an address for this long after it expires,
+	// to catch payments that arrive late
+	ExpiryGrace time.Duration
+
+	// OnEvent receives events synchronously. If nil, events are sent on the
+	// channel returned by Events.
+	OnEvent func(WatchEvent)
+
+	// EventBuffer is the size of the Events channel (default 64)
+	EventBuffer int
+}
+
+// watchEntry is an address tracked by a Watcher
+type watchEntry struct {
+	address   string
+	depositID string
+	expiresAt time.Time
+	interval  time.Duration
+	nextPoll  time.Time
+	statuses  map[string]TransactionStatus
+}
+
+// Watcher polls CheckTransactionStatus for a set of addresses and emits an
+// event whenever a transaction appears or changes status. It is a fallback for
+// when webhooks cannot be delivered.
+type Watcher struct {
+	client API
+	config WatcherConfig
+	events chan WatchEvent
+	wake   chan struct{}
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*watchEntry
+}
+
+// NewWatcher creates a watcher that polls with the given client
+func NewWatcher(client API, config WatcherConfig) *Watcher {
+	if config.TransactionType == "" {
+		config.TransactionType = TransactionTypeDeposit
+	}
+	if config.MinInterval <= 0 {
+		config.MinInterval = DefaultWatchMinInterval
+	}
+	if config.MaxInterval < config.MinInterval {
+		config.MaxInterval = max(DefaultWatchMaxInterval, config.MinInterval)
+	}
+	if config.RequestsPerSecond <= 0 {
+		config.RequestsPerSecond = DefaultWatchRequestsPerSecond
+	}
+	if config.EventBuffer <= 0 {
+		config.EventBuffer = 64
+	}
+
+	return &Watcher{
+		client:  client,
+		config:  config,
+		events:  make(chan WatchEvent, config.EventBuffer),
+		wake:    make(chan struct{}, 1),
+		now:     time.Now,
+		entries: make(map[string]*watchEntry),
+	}
+}
+
+// Events returns the channel events are sent on when no OnEvent callback is
+// configured. It is closed when Run returns.
+func (w *Watcher) Events() <-chan WatchEvent {
+	return w.events
+}
+
+// Watch starts watching the address of a deposit until it expires
+func (w *Watcher) Watch(deposit *DepositResponse) {
+	w.watch(deposit.Address, deposit.ID, deposit.ExpiresAt)
+}
+
+// WatchAddress starts watching an address until expiresAt. A zero expiresAt
+// watches the address until Unwatch is called.
+func (w *Watcher) WatchAddress(address string, expiresAt time.Time) {
+	w.watch(address, "", expiresAt)
+}
+
+// Unwatch stops watching an address
+func (w *Watcher) Unwatch(address string) {
+	w.mu.Lock()
+	delete(w.entries, address)
+	w.mu.Unlock()
+}
+
+// Len returns the number of watched addresses
+func (w *Watcher) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.entries)
+}
+
+func (w *Watcher) watch(address, depositID string, expiresAt time.Time) {
+	w.mu.Lock()
+	if _, ok := w.entries[address]; !ok {
+		w.entries[address] = &watchEntry{
+			address:   address,
+			depositID: depositID,
+			expiresAt: expiresAt,
+			interval:  w.config.MinInterval,
+			nextPoll:  w.now(),
+			statuses:  make(map[string]TransactionStatus),
+		}
+	}
+	w.mu.Unlock()
+
+	// Wake up Run so the new address is polled right away
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run polls the watched addresses until ctx is cancelled. Polls are made one
+// at a time and never exceed the configured requests per second.
+func (w *Watcher) Run(ctx context.Context) error {
+	defer close(w.events)
+
+	budget := time.Duration(float64(time.Second) / w.config.RequestsPerSecond)
+	var lastPoll time.Time
+
+	for {
+		entry, wait := w.next()
+		if entry != nil {
+			// Respect the global budget
+			wait = max(wait, budget-w.now().Sub(lastPoll))
+		}
+		if entry == nil || wait > 0 {
+			// Sleep until the next poll is due, or indefinitely if nothing is
+			// watched; re-evaluate when an address is added
+			if err := w.sleep(ctx, wait, entry != nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		lastPoll = w.now()
+		if err := w.poll(ctx, entry); err != nil {
+			return err
+		}
+	}
+}
+
+// sleep blocks until d elapses (if timed), an address is added or ctx is done
+func (w *Watcher) sleep(ctx context.Context, d time.Duration, timed bool) error {
+	var timeout <-chan time.Time
+	if timed {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-w.wake:
+	case <-timeout:
+	}
+	return nil
+}
+
+// next returns the entry due to be polled first and how long until it is due
+func (w *Watcher) next() (*watchEntry, time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var next *watchEntry
+	for _, entry := range w.entries {
+		if next == nil || entry.nextPoll.Before(next.nextPoll) {
+			next = entry
+		}
+	}
+	if next == nil {
+		return nil, 0
+	}
+	return next, next.nextPoll.Sub(w.now())
+}
+
+// poll checks an address, emits events for changes and reschedules it.
+// It only returns an error when ctx is cancelled.
+func (w *Watcher) poll(ctx context.Context, entry *watchEntry) error {
+	resp, err := w.client.CheckTransactionStatus(ctx, entry.address, w.config.TransactionType)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	w.mu.Lock()
+	if w.entries[entry.address] != entry {
+		// Unwatched while polling
+		w.mu.Unlock()
+		return nil
+	}
+
+	var events []WatchEvent
+	if err != nil {
+		events = append(events, WatchEvent{Kind: WatchEventError, Address: entry.address, DepositID: entry.depositID, Err: err})
+	} else {
+		for _, tx := range resp.Transactions {
+			previous, seen := entry.statuses[tx.ID]
+			if seen && previous == tx.Status {
+				continue
+			}
+			entry.statuses[tx.ID] = tx.Status
+			events = append(events, WatchEvent{
+				Kind:           WatchEventStatusChanged,
+				Address:        entry.address,
+				DepositID:      entry.depositID,
+				Transaction:    tx,
+				PreviousStatus: previous,
+			})
+		}
+	}
+
+	// Poll quickly while things change and back off while the address is idle
+	if len(events) > 0 && err == nil {
+		entry.interval = w.config.MinInterval
+	} else {
+		entry.interval = min(entry.interval*3/2, w.config.MaxInterval)
+	}
+	now := w.now()
+	entry.nextPoll = now.Add(entry.interval)
+
+	// Stop watching once the address has expired, after a final poll
+	if !entry.expiresAt.IsZero() && !now.Before(entry.expiresAt.Add(w.config.ExpiryGrace)) {
+		delete(w.entries, entry.address)
+		events = append(events, WatchEvent{Kind: WatchEventExpired, Address: entry.address, DepositID: entry.depositID})
+	} else if !entry.expiresAt.IsZero() && entry.nextPoll.After(entry.expiresAt.Add(w.config.ExpiryGrace)) {
+		entry.nextPoll = entry.expiresAt.Add(w.config.ExpiryGrace)
+	}
+	w.mu.Unlock()
+
+	for _, event := range events {
+		if err := w.emit(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emit delivers an event to the callback or the events channel
+func (w *Watcher) emit(ctx context.Context, event WatchEvent) error {
+	if w.config.OnEvent != nil {
+		w.config.OnEvent(event)
+		return nil
+	}
+
+	select {
+	case w.events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
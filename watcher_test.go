@@ -0,0 +1,153 @@
+package sagapay_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/halfindex/sagapay-go-sdk"
+	"github.com/halfindex/sagapay-go-sdk/sagapaytest"
+)
+
+// fastWatcherConfig polls every millisecond or two
+var fastWatcherConfig = sagapay.WatcherConfig{
+	MinInterval:       time.Millisecond,
+	MaxInterval:       2 * time.Millisecond,
+	RequestsPerSecond: 1000,
+}
+
+// runWatcher runs w until the test ends and returns a channel with Run's result
+func runWatcher(t *testing.T, w *sagapay.Watcher) (context.CancelFunc, <-chan error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	stopped := make(chan struct{})
+	go func() {
+		done <- w.Run(ctx)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	return cancel, done
+}
+
+// nextEvent waits for the next watcher event
+func nextEvent(t *testing.T, w *sagapay.Watcher) sagapay.WatchEvent {
+	t.Helper()
+	select {
+	case event := <-w.Events():
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a watch event")
+		return sagapay.WatchEvent{}
+	}
+}
+
+func TestWatcherStatusChanges(t *testing.T) {
+	srv := sagapaytest.NewServer(sagapaytest.Config{})
+	defer srv.Close()
+	client, err := sagapay.NewClient(srv.ClientConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	deposit, err := client.CreateDeposit(context.Background(), depositParams(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := sagapay.NewWatcher(client, fastWatcherConfig)
+	w.Watch(deposit)
+	runWatcher(t, w)
+
+	tx, err := srv.Pay(deposit.Address, "10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := nextEvent(t, w)
+	if event.Kind != sagapay.WatchEventStatusChanged || event.Transaction.ID != tx.ID ||
+		event.DepositID != deposit.ID || event.PreviousStatus != "" {
+		t.Fatalf("first event = %+v, want a new transaction", event)
+	}
+
+	if _, err := srv.Complete(tx.ID); err != nil {
+		t.Fatal(err)
+	}
+	for event.Transaction.Status != sagapay.TransactionStatusCompleted {
+		previous := event.Transaction.Status
+		event = nextEvent(t, w)
+		if event.Kind != sagapay.WatchEventStatusChanged || event.PreviousStatus != previous {
+			t.Fatalf("event = %+v, want a change from %s", event, previous)
+		}
+	}
+}
+
+func TestWatcherErrorsAndExpiry(t *testing.T) {
+	mock := &sagapaytest.MockAPI{}
+	mock.ReturnTransactionStatus(nil, errors.New("connection reset"))
+	mock.CheckTransactionStatusFunc = func(ctx context.Context, address string, transactionType sagapay.TransactionType) (*sagapay.TransactionStatusResponse, error) {
+		return &sagapay.TransactionStatusResponse{}, nil
+	}
+
+	w := sagapay.NewWatcher(mock, fastWatcherConfig)
+	w.WatchAddress("0xabc", time.Now().Add(20*time.Millisecond))
+	runWatcher(t, w)
+
+	if event := nextEvent(t, w); event.Kind != sagapay.WatchEventError || event.Err == nil {
+		t.Errorf("first event = %+v, want an error", event)
+	}
+	if event := nextEvent(t, w); event.Kind != sagapay.WatchEventExpired || event.Address != "0xabc" {
+		t.Errorf("second event = %+v, want the address to expire", event)
+	}
+	if w.Len() != 0 {
+		t.Errorf("Len() = %d after expiry, want 0", w.Len())
+	}
+}
+
+func TestWatcherUnwatchAndStop(t *testing.T) {
+	var polls atomic.Int32
+	var once sync.Once
+	firstPoll := make(chan struct{})
+	mock := &sagapaytest.MockAPI{
+		CheckTransactionStatusFunc: func(ctx context.Context, address string, transactionType sagapay.TransactionType) (*sagapay.TransactionStatusResponse, error) {
+			polls.Add(1)
+			once.Do(func() { close(firstPoll) })
+			return &sagapay.TransactionStatusResponse{}, nil
+		},
+	}
+
+	w := sagapay.NewWatcher(mock, fastWatcherConfig)
+	cancel, done := runWatcher(t, w)
+	w.WatchAddress("0xabc", time.Time{})
+	select {
+	case <-firstPoll:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the address was never polled")
+	}
+
+	// No more polls are made once the address is unwatched
+	w.Unwatch("0xabc")
+	time.Sleep(5 * time.Millisecond)
+	stopped := polls.Load()
+	time.Sleep(20 * time.Millisecond)
+	if n := polls.Load(); n != stopped {
+		t.Errorf("%d polls after Unwatch", n-stopped)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Run = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	if _, ok := <-w.Events(); ok {
+		t.Error("Events is still open after Run returned")
+	}
+}
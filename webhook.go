@@ -8,74 +8,209 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 )
 
-// WebhookHandler handles SagaPay webhook notifications
+// SignatureHeader is the request header carrying the webhook signature
+const SignatureHeader = "x-sagapay-signature"
+
+// DefaultMaxWebhookBodySize is the default limit for webhook request bodies
+const DefaultMaxWebhookBodySize = 1 << 20
+
+// Webhook errors that can be matched with errors.Is
+var (
+	// ErrMissingSignature is returned when a webhook has no signature header
+	ErrMissingSignature = errors.New("missing SagaPay signature in headers")
+
+	// ErrInvalidSignature is returned when a webhook signature does not match
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+
+	// ErrInvalidPayload is returned when a webhook body cannot be parsed
+	ErrInvalidPayload = errors.New("failed to parse webhook payload")
+
+	// ErrStaleWebhook is returned when a webhook timestamp is outside the tolerance window
+	ErrStaleWebhook = errors.New("webhook timestamp outside tolerance")
+
+	// ErrDuplicateWebhook is returned by Dispatch when an event was already handled
+	ErrDuplicateWebhook = errors.New("duplicate webhook")
+)
+
+// WebhookHandler handles SagaPay webhook notifications.
+// It can be used directly as an http.Handler that verifies each request and
+// routes the payload to the handlers registered with On and its shortcuts.
+// It is safe for concurrent use, and may be configured while it serves.
 type WebhookHandler struct {
-	apiSecret string
+	mu          sync.RWMutex
+	secrets     []WebhookSecret
+	maxBodySize int64
+	routes      []webhookRoute
+	unhandled   WebhookHandlerFunc
+
+	// Replay protection
+	tolerance time.Duration
+	dedup     DedupStore
+	now       func() time.Time
+
+	// logger receives verification failures
+	logger *slog.Logger
+
+	// metrics receives webhook outcomes
+	metrics Metrics
 }
 
-// NewWebhookHandler creates a new webhook handler
-func NewWebhookHandler(apiSecret string) *WebhookHandler {
+// WebhookSecret is a secret webhooks may be signed with
+type WebhookSecret struct {
+	// ID identifies the secret when reporting which one verified a webhook
+	ID string
+
+	// Secret is the API secret used as the HMAC key
+	Secret string
+
+	// ExpiresAt retires the secret; webhooks are no longer accepted with it
+	// after this time. Zero means the secret never expires.
+	ExpiresAt time.Time
+}
+
+// NewWebhookHandler creates a new webhook handler. Several secrets can be
+// given in priority order while API credentials are being rotated; a webhook
+// signed with any of them is accepted. The secrets are identified by their
+// position: "0" for the first, "1" for the second, and so on.
+func NewWebhookHandler(apiSecrets ...string) *WebhookHandler {
+	secrets := make([]WebhookSecret, len(apiSecrets))
+	for i, secret := range apiSecrets {
+		secrets[i] = WebhookSecret{ID: strconv.Itoa(i), Secret: secret}
+	}
+	return NewWebhookHandlerWithSecrets(secrets...)
+}
+
+// NewWebhookHandlerWithSecrets creates a new webhook handler accepting
+// webhooks signed with any of the given secrets
+func NewWebhookHandlerWithSecrets(secrets ...WebhookSecret) *WebhookHandler {
 	return &WebhookHandler{
-		apiSecret: apiSecret,
+		secrets:     append([]WebhookSecret(nil), secrets...),
+		maxBodySize: DefaultMaxWebhookBodySize,
+		now:         time.Now,
 	}
 }
 
+// RetireSecret stops accepting webhooks signed with the secret identified by
+// id after the given time
+func (h *WebhookHandler) RetireSecret(id string, at time.Time) *WebhookHandler {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := range h.secrets {
+		if h.secrets[i].ID == id {
+			h.secrets[i].ExpiresAt = at
+		}
+	}
+	return h
+}
+
 // HandleRequest processes a webhook notification from an HTTP request
 func (h *WebhookHandler) HandleRequest(r *http.Request) (*WebhookPayload, error) {
+	payload, _, err := h.readRequest(r)
+	return payload, err
+}
+
+// readRequest reads and verifies a webhook request and returns the payload
+// with the ID of the secret that verified it
+func (h *WebhookHandler) readRequest(r *http.Request) (*WebhookPayload, string, error) {
 	// Get the signature from the headers
-	signature := r.Header.Get("x-sagapay-signature")
+	signature := r.Header.Get(SignatureHeader)
 	if signature == "" {
-		return nil, errors.New("missing SagaPay signature in headers")
+		h.rejected(ErrMissingSignature, signature, 0)
+		return nil, "", ErrMissingSignature
 	}
 
 	// Read the request body
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read request body: %w", err)
+		err = fmt.Errorf("failed to read request body: %w", err)
+		h.rejected(err, signature, len(body))
+		return nil, "", err
 	}
 
-	// Verify the signature
-	if !h.VerifySignature(body, signature) {
-		return nil, errors.New("invalid webhook signature")
-	}
+	return h.parse(body, signature)
+}
 
-	// Parse the webhook payload
-	var payload WebhookPayload
-	if err := json.Unmarshal(body, &payload); err != nil {
-		return nil, fmt.Errorf("failed to parse webhook payload: %w", err)
-	}
+// ProcessWebhook processes a webhook notification from raw body and signature.
+// If a tolerance is configured, payloads whose timestamp falls outside it are rejected.
+func (h *WebhookHandler) ProcessWebhook(body []byte, signature string) (*WebhookPayload, error) {
+	payload, _, err := h.parse(body, signature)
+	return payload, err
+}
 
-	return &payload, nil
+// parse verifies and parses a webhook body, returning the ID of the secret that
+// verified it. Failures are logged if a logger is set.
+func (h *WebhookHandler) parse(body []byte, signature string) (*WebhookPayload, string, error) {
+	payload, keyID, err := h.verify(body, signature)
+	if err != nil {
+		h.rejected(err, signature, len(body))
+	}
+	return payload, keyID, err
 }
 
-// ProcessWebhook processes a webhook notification from raw body and signature
-func (h *WebhookHandler) ProcessWebhook(body []byte, signature string) (*WebhookPayload, error) {
+// verify checks the signature, payload and timestamp of a webhook body
+func (h *WebhookHandler) verify(body []byte, signature string) (*WebhookPayload, string, error) {
 	// Verify the signature
-	if !h.VerifySignature(body, signature) {
-		return nil, errors.New("invalid webhook signature")
+	keyID, ok := h.MatchSignature(body, signature)
+	if !ok {
+		return nil, "", ErrInvalidSignature
 	}
 
 	// Parse the webhook payload
 	var payload WebhookPayload
 	if err := json.Unmarshal(body, &payload); err != nil {
-		return nil, fmt.Errorf("failed to parse webhook payload: %w", err)
+		return nil, keyID, fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+	}
+
+	// Reject replays of old webhooks
+	if err := h.checkTimestamp(&payload); err != nil {
+		return nil, keyID, err
 	}
 
-	return &payload, nil
+	return &payload, keyID, nil
 }
 
-// VerifySignature verifies the HMAC signature of a webhook payload
+// VerifySignature verifies the HMAC signature of a webhook payload against every active secret
 func (h *WebhookHandler) VerifySignature(payload []byte, signature string) bool {
-	// Calculate the HMAC-SHA256
-	mac := hmac.New(sha256.New, []byte(h.apiSecret))
-	mac.Write(payload)
-	expectedSignature := hex.EncodeToString(mac.Sum(nil))
+	_, ok := h.MatchSignature(payload, signature)
+	return ok
+}
+
+// MatchSignature verifies the HMAC signature of a webhook payload and reports
+// the ID of the secret that matched. Every active secret is checked, in
+// constant time, so the result does not leak which secret matched through timing.
+func (h *WebhookHandler) MatchSignature(payload []byte, signature string) (string, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 
-	// Compare with the provided signature
-	return hmac.Equal([]byte(expectedSignature), []byte(signature))
+	now := h.now()
+	matched := ""
+	ok := false
+	for _, secret := range h.secrets {
+		if !secret.ExpiresAt.IsZero() && !now.Before(secret.ExpiresAt) {
+			continue
+		}
+
+		// Calculate the HMAC-SHA256
+		mac := hmac.New(sha256.New, []byte(secret.Secret))
+		mac.Write(payload)
+		expectedSignature := hex.EncodeToString(mac.Sum(nil))
+
+		// Compare with the provided signature, keeping the first match in priority order
+		if hmac.Equal([]byte(expectedSignature), []byte(signature)) && !ok {
+			matched = secret.ID
+			ok = true
+		}
+	}
+
+	return matched, ok
 }
 
 // SendSuccessResponse sends a success response for a webhook
@@ -85,7 +220,8 @@ func SendSuccessResponse(w http.ResponseWriter) {
 	json.NewEncoder(w).Encode(map[string]bool{"received": true})
 }
 
-// SendErrorResponse sends an error response for a webhook
+// SendErrorResponse sends an error response for a webhook.
+// It answers 200 OK so SagaPay does not redeliver the webhook.
 func SendErrorResponse(w http.ResponseWriter, err error) {
 	w.Header().Set("Content-Type", "application/json")
 	// Still return 200 OK to prevent retries
@@ -94,4 +230,4 @@ func SendErrorResponse(w http.ResponseWriter, err error) {
 		"received": false,
 		"error":    err.Error(),
 	})
-}
\ No newline at end of file
+}
@@ -0,0 +1,233 @@
+package sagapay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// WebhookHandlerFunc handles a verified webhook payload. Returning an error
+// reports the failure to SagaPay; wrap it with Redeliver to have the webhook
+// sent again.
+type WebhookHandlerFunc func(ctx context.Context, payload *WebhookPayload) error
+
+// webhookRoute is a handler registered for a transaction type and status
+type webhookRoute struct {
+	txType TransactionType
+	status TransactionStatus
+	fn     WebhookHandlerFunc
+}
+
+// matches reports whether the route applies to the payload; empty fields match anything
+func (r webhookRoute) matches(payload *WebhookPayload) bool {
+	return (r.txType == "" || r.txType == payload.Type) &&
+		(r.status == "" || r.status == payload.Status)
+}
+
+// On registers fn for webhooks with the given transaction type and status.
+// An empty type or status matches any value. Every matching handler is
+// called in registration order until one returns an error.
+func (h *WebhookHandler) On(txType TransactionType, status TransactionStatus, fn WebhookHandlerFunc) *WebhookHandler {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.routes = append(h.routes, webhookRoute{txType: txType, status: status, fn: fn})
+	return h
+}
+
+// OnDepositCompleted registers fn for completed deposits
+func (h *WebhookHandler) OnDepositCompleted(fn WebhookHandlerFunc) *WebhookHandler {
+	return h.On(TransactionTypeDeposit, TransactionStatusCompleted, fn)
+}
+
+// OnDepositFailed registers fn for failed deposits
+func (h *WebhookHandler) OnDepositFailed(fn WebhookHandlerFunc) *WebhookHandler {
+	return h.On(TransactionTypeDeposit, TransactionStatusFailed, fn)
+}
+
+// OnWithdrawalCompleted registers fn for completed withdrawals
+func (h *WebhookHandler) OnWithdrawalCompleted(fn WebhookHandlerFunc) *WebhookHandler {
+	return h.On(TransactionTypeWithdrawal, TransactionStatusCompleted, fn)
+}
+
+// OnWithdrawalFailed registers fn for failed withdrawals
+func (h *WebhookHandler) OnWithdrawalFailed(fn WebhookHandlerFunc) *WebhookHandler {
+	return h.On(TransactionTypeWithdrawal, TransactionStatusFailed, fn)
+}
+
+// OnUnhandled registers a catch-all for webhooks that no other handler matches
+func (h *WebhookHandler) OnUnhandled(fn WebhookHandlerFunc) *WebhookHandler {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.unhandled = fn
+	return h
+}
+
+// SetMaxBodySize limits the size of webhook request bodies accepted by ServeHTTP
+func (h *WebhookHandler) SetMaxBodySize(n int64) *WebhookHandler {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxBodySize = n
+	return h
+}
+
+// Dispatch calls the handlers registered for a verified payload. If a dedup
+// store is configured, the event is claimed first, and events that were
+// already claimed return ErrDuplicateWebhook without reaching any handler.
+// The claim is released if a handler fails.
+func (h *WebhookHandler) Dispatch(ctx context.Context, payload *WebhookPayload) error {
+	h.mu.RLock()
+	dedup := h.dedup
+	h.mu.RUnlock()
+
+	var key string
+	if dedup != nil {
+		key = WebhookEventKey(payload)
+		claimed, err := dedup.Claim(ctx, key)
+		if err != nil {
+			h.observeWebhook(WebhookHandlerError)
+			return Redeliver(fmt.Errorf("failed to claim webhook in dedup store: %w", err))
+		}
+		if !claimed {
+			h.observeWebhook(WebhookDuplicate)
+			return ErrDuplicateWebhook
+		}
+	}
+
+	if err := h.dispatch(ctx, payload); err != nil {
+		h.observeWebhook(WebhookHandlerError)
+		if dedup != nil {
+			if releaseErr := dedup.Release(ctx, key); releaseErr != nil {
+				return errors.Join(err, fmt.Errorf("failed to release webhook in dedup store: %w", releaseErr))
+			}
+		}
+		return err
+	}
+
+	h.observeWebhook(WebhookAccepted)
+	return nil
+}
+
+// dispatch calls every matching handler, or the catch-all if none matches
+func (h *WebhookHandler) dispatch(ctx context.Context, payload *WebhookPayload) error {
+	// Handlers run without the lock, so they may register other handlers
+	h.mu.RLock()
+	routes, unhandled := h.routes, h.unhandled
+	h.mu.RUnlock()
+
+	handled := false
+	for _, route := range routes {
+		if !route.matches(payload) {
+			continue
+		}
+		handled = true
+		if err := route.fn(ctx, payload); err != nil {
+			return err
+		}
+	}
+
+	if !handled && unhandled != nil {
+		return unhandled(ctx, payload)
+	}
+	return nil
+}
+
+// ServeHTTP implements http.Handler. It accepts POST requests only, limits the
+// body size, verifies the signature and dispatches the payload. The response
+// status is set automatically:
+//   - 405 for methods other than POST
+//   - 413 for bodies larger than the configured limit
+//   - 401 for a missing or invalid signature
+//   - 400 for a payload that cannot be parsed or is outside the tolerance window
+//   - 500 for handler errors wrapped with Redeliver, so SagaPay retries
+//   - 200 otherwise, including duplicates and other handler errors
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		sendWebhookResponse(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	h.mu.RLock()
+	maxBodySize := h.maxBodySize
+	h.mu.RUnlock()
+	if maxBodySize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	}
+
+	payload, keyID, err := h.readRequest(r)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			sendWebhookResponse(w, http.StatusRequestEntityTooLarge, err)
+		case errors.Is(err, ErrMissingSignature), errors.Is(err, ErrInvalidSignature):
+			sendWebhookResponse(w, http.StatusUnauthorized, err)
+		case errors.Is(err, ErrInvalidPayload), errors.Is(err, ErrStaleWebhook):
+			sendWebhookResponse(w, http.StatusBadRequest, err)
+		default:
+			sendWebhookResponse(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), webhookKeyIDContextKey{}, keyID)
+	if err := h.Dispatch(ctx, payload); err != nil {
+		if errors.Is(err, ErrDuplicateWebhook) {
+			SendSuccessResponse(w)
+			return
+		}
+		if IsRedelivery(err) {
+			sendWebhookResponse(w, http.StatusInternalServerError, err)
+			return
+		}
+		SendErrorResponse(w, err)
+		return
+	}
+
+	SendSuccessResponse(w)
+}
+
+// webhookKeyIDContextKey is the context key for the ID of the secret that verified a webhook
+type webhookKeyIDContextKey struct{}
+
+// WebhookKeyID returns the ID of the secret that verified the webhook being
+// handled, for use inside handlers dispatched by ServeHTTP
+func WebhookKeyID(ctx context.Context) string {
+	id, _ := ctx.Value(webhookKeyIDContextKey{}).(string)
+	return id
+}
+
+// redeliveryError marks a handler error that should make SagaPay resend the webhook
+type redeliveryError struct {
+	err error
+}
+
+func (e *redeliveryError) Error() string { return e.err.Error() }
+func (e *redeliveryError) Unwrap() error { return e.err }
+
+// Redeliver wraps a handler error so that ServeHTTP answers with a 5xx status
+// and SagaPay delivers the webhook again, e.g. when the database is unavailable
+func Redeliver(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &redeliveryError{err: err}
+}
+
+// IsRedelivery reports whether err requests a webhook redelivery
+func IsRedelivery(err error) bool {
+	var r *redeliveryError
+	return errors.As(err, &r)
+}
+
+// sendWebhookResponse sends an error response with the given status
+func sendWebhookResponse(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"received": false,
+		"error":    err.Error(),
+	})
+}
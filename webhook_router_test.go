@@ -0,0 +1,174 @@
+package sagapay
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sign returns the webhook signature of body under secret
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookRequest builds a signed webhook request for a payload
+func webhookRequest(t *testing.T, secret string, payload WebhookPayload) *http.Request {
+	t.Helper()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(string(body)))
+	r.Header.Set(SignatureHeader, sign(secret, body))
+	return r
+}
+
+func testPayload(txType TransactionType, status TransactionStatus) WebhookPayload {
+	return WebhookPayload{
+		ID:        "tx-1",
+		Type:      txType,
+		Status:    status,
+		Address:   "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		Amount:    "10",
+		TxHash:    "0xabc",
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+func TestWebhookRouting(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload WebhookPayload
+		want    string
+	}{
+		{"deposit completed", testPayload(TransactionTypeDeposit, TransactionStatusCompleted), "deposit-completed,any-completed"},
+		{"deposit failed", testPayload(TransactionTypeDeposit, TransactionStatusFailed), "deposit-failed"},
+		{"withdrawal completed", testPayload(TransactionTypeWithdrawal, TransactionStatusCompleted), "any-completed"},
+		{"unmatched", testPayload(TransactionTypeWithdrawal, TransactionStatusPending), "unhandled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			record := func(name string) WebhookHandlerFunc {
+				return func(ctx context.Context, payload *WebhookPayload) error {
+					calls = append(calls, name)
+					return nil
+				}
+			}
+			h := NewWebhookHandler("secret").
+				OnDepositCompleted(record("deposit-completed")).
+				OnDepositFailed(record("deposit-failed")).
+				On("", TransactionStatusCompleted, record("any-completed")).
+				OnUnhandled(record("unhandled"))
+
+			if err := h.Dispatch(context.Background(), &tt.payload); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(calls, ","); got != tt.want {
+				t.Errorf("handlers called: %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookRoutingStopsAtError(t *testing.T) {
+	failed := errors.New("database down")
+	second := false
+	h := NewWebhookHandler("secret").
+		OnDepositCompleted(func(ctx context.Context, payload *WebhookPayload) error { return failed }).
+		OnDepositCompleted(func(ctx context.Context, payload *WebhookPayload) error { second = true; return nil })
+
+	payload := testPayload(TransactionTypeDeposit, TransactionStatusCompleted)
+	if err := h.Dispatch(context.Background(), &payload); !errors.Is(err, failed) {
+		t.Errorf("Dispatch = %v, want %v", err, failed)
+	}
+	if second {
+		t.Error("the handler after a failing one was called")
+	}
+}
+
+func TestWebhookServeHTTP(t *testing.T) {
+	completed := testPayload(TransactionTypeDeposit, TransactionStatusCompleted)
+	tests := []struct {
+		name    string
+		request func(t *testing.T) *http.Request
+		handler WebhookHandlerFunc
+		status  int
+	}{
+		{"accepted", func(t *testing.T) *http.Request {
+			return webhookRequest(t, "secret", completed)
+		}, nil, http.StatusOK},
+		{"wrong method", func(t *testing.T) *http.Request {
+			return httptest.NewRequest(http.MethodGet, "/webhook", nil)
+		}, nil, http.StatusMethodNotAllowed},
+		{"missing signature", func(t *testing.T) *http.Request {
+			r := webhookRequest(t, "secret", completed)
+			r.Header.Del(SignatureHeader)
+			return r
+		}, nil, http.StatusUnauthorized},
+		{"wrong secret", func(t *testing.T) *http.Request {
+			return webhookRequest(t, "other", completed)
+		}, nil, http.StatusUnauthorized},
+		{"invalid JSON", func(t *testing.T) *http.Request {
+			r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader("{"))
+			r.Header.Set(SignatureHeader, sign("secret", []byte("{")))
+			return r
+		}, nil, http.StatusBadRequest},
+		{"too large", func(t *testing.T) *http.Request {
+			payload := completed
+			payload.UDF = strings.Repeat("x", 2048)
+			return webhookRequest(t, "secret", payload)
+		}, nil, http.StatusRequestEntityTooLarge},
+		{"handler error", func(t *testing.T) *http.Request {
+			return webhookRequest(t, "secret", completed)
+		}, func(ctx context.Context, payload *WebhookPayload) error {
+			return errors.New("order not found")
+		}, http.StatusOK},
+		{"redelivery", func(t *testing.T) *http.Request {
+			return webhookRequest(t, "secret", completed)
+		}, func(ctx context.Context, payload *WebhookPayload) error {
+			return Redeliver(errors.New("database down"))
+		}, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewWebhookHandler("secret").SetMaxBodySize(1024)
+			if tt.handler != nil {
+				h.OnDepositCompleted(tt.handler)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, tt.request(t))
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
+
+// Run with -race: configuring the handler while it serves must not race
+func TestWebhookConfigureWhileServing(t *testing.T) {
+	h := NewWebhookHandler("secret")
+	payload := testPayload(TransactionTypeDeposit, TransactionStatusCompleted)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			h.OnDepositCompleted(func(ctx context.Context, payload *WebhookPayload) error { return nil })
+			h.SetMaxBodySize(DefaultMaxWebhookBodySize).SetTolerance(time.Hour).SetDedupStore(NewMemoryDedupStore(10))
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), webhookRequest(t, "secret", payload))
+	}
+	<-done
+}
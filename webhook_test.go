@@ -0,0 +1,106 @@
+package sagapay
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMatchSignature(t *testing.T) {
+	body := []byte(`{"id":"tx-1"}`)
+	h := NewWebhookHandler("new", "old")
+
+	tests := []struct {
+		name   string
+		secret string
+		wantID string
+		wantOK bool
+	}{
+		{"first secret", "new", "0", true},
+		{"second secret", "old", "1", true},
+		{"unknown secret", "other", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, ok := h.MatchSignature(body, sign(tt.secret, body))
+			if id != tt.wantID || ok != tt.wantOK {
+				t.Errorf("MatchSignature = %q, %v, want %q, %v", id, ok, tt.wantID, tt.wantOK)
+			}
+		})
+	}
+
+	// A secret listed twice is reported by its first position
+	h = NewWebhookHandlerWithSecrets(WebhookSecret{ID: "a", Secret: "same"}, WebhookSecret{ID: "b", Secret: "same"})
+	if id, _ := h.MatchSignature(body, sign("same", body)); id != "a" {
+		t.Errorf("MatchSignature = %q, want a", id)
+	}
+}
+
+func TestRetireSecret(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"id":"tx-1"}`)
+	h := NewWebhookHandlerWithSecrets(
+		WebhookSecret{ID: "current", Secret: "new"},
+		WebhookSecret{ID: "previous", Secret: "old"},
+	).RetireSecret("previous", now.Add(time.Hour))
+
+	h.now = func() time.Time { return now }
+	if !h.VerifySignature(body, sign("old", body)) {
+		t.Error("secret rejected before its retirement")
+	}
+
+	h.now = func() time.Time { return now.Add(time.Hour) }
+	if h.VerifySignature(body, sign("old", body)) {
+		t.Error("secret accepted after its retirement")
+	}
+	if !h.VerifySignature(body, sign("new", body)) {
+		t.Error("current secret rejected after the previous one retired")
+	}
+
+	// Retiring an unknown ID leaves the secrets alone
+	h.RetireSecret("missing", now)
+	if !h.VerifySignature(body, sign("new", body)) {
+		t.Error("retiring an unknown ID affected another secret")
+	}
+}
+
+func TestWebhookKeyID(t *testing.T) {
+	got := make(chan string, 1)
+	h := NewWebhookHandler("new", "old").
+		OnDepositCompleted(func(ctx context.Context, payload *WebhookPayload) error {
+			got <- WebhookKeyID(ctx)
+			return nil
+		})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, webhookRequest(t, "old", testPayload(TransactionTypeDeposit, TransactionStatusCompleted)))
+	if w.Code != 200 {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if id := <-got; id != "1" {
+		t.Errorf("WebhookKeyID = %q, want 1", id)
+	}
+
+	if id := WebhookKeyID(context.Background()); id != "" {
+		t.Errorf("WebhookKeyID outside a webhook = %q, want empty", id)
+	}
+}
+
+func TestProcessWebhook(t *testing.T) {
+	h := NewWebhookHandler("secret")
+	body := []byte(`{"id":"tx-1","type":"deposit","status":"COMPLETED"}`)
+
+	if _, err := h.ProcessWebhook(body, sign("other", body)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong secret: err = %v, want ErrInvalidSignature", err)
+	}
+	bad := []byte(`{"id":`)
+	if _, err := h.ProcessWebhook(bad, sign("secret", bad)); !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("bad body: err = %v, want ErrInvalidPayload", err)
+	}
+	payload, err := h.ProcessWebhook(body, sign("secret", body))
+	if err != nil || payload.ID != "tx-1" {
+		t.Errorf("ProcessWebhook = %+v, %v", payload, err)
+	}
+}